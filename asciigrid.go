@@ -0,0 +1,124 @@
+package contour
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/flywave/go-geo"
+)
+
+type AsciiGridHeader struct {
+	NCols    int
+	NRows    int
+	XLL      float64
+	YLL      float64
+	CellSize [2]float64
+	NoData   *float64
+}
+
+func (h *AsciiGridHeader) GeoTransform() [6]float64 {
+	return [6]float64{h.XLL, h.CellSize[0], 0, h.YLL + float64(h.NRows)*h.CellSize[1], 0, -h.CellSize[1]}
+}
+
+type AsciiGridRaster struct {
+	MemoryRaster
+	Header AsciiGridHeader
+}
+
+func NewAsciiGridRaster(fileName string, srs geo.Proj) *AsciiGridRaster {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	header, data, err := readAsciiGrid(f)
+	if err != nil {
+		return nil
+	}
+	mem := NewMemoryRaster(data, header.NCols, header.NRows, header.GeoTransform(), srs, header.NoData)
+	if mem == nil {
+		return nil
+	}
+	return &AsciiGridRaster{MemoryRaster: *mem, Header: *header}
+}
+
+func readAsciiGrid(f *os.File) (*AsciiGridHeader, []float64, error) {
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	scanner.Split(bufio.ScanWords)
+
+	header := &AsciiGridHeader{}
+	var xCenter, yCenter bool
+	var token string
+	for scanner.Scan() {
+		token = scanner.Text()
+		if _, err := strconv.ParseFloat(token, 64); err == nil {
+			break
+		}
+		key := strings.ToLower(token)
+		if !scanner.Scan() {
+			return nil, nil, fmt.Errorf("missing value for %s", token)
+		}
+		value, err := strconv.ParseFloat(scanner.Text(), 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid value for %s: %v", token, err)
+		}
+		switch key {
+		case "ncols":
+			header.NCols = int(value)
+		case "nrows":
+			header.NRows = int(value)
+		case "xllcorner":
+			header.XLL = value
+		case "yllcorner":
+			header.YLL = value
+		case "xllcenter":
+			header.XLL, xCenter = value, true
+		case "yllcenter":
+			header.YLL, yCenter = value, true
+		case "cellsize":
+			header.CellSize = [2]float64{value, value}
+		case "dx":
+			header.CellSize[0] = value
+		case "dy":
+			header.CellSize[1] = value
+		case "nodata_value":
+			header.NoData = &value
+		}
+		token = ""
+	}
+	if header.NCols <= 0 || header.NRows <= 0 || header.CellSize[0] <= 0 || header.CellSize[1] <= 0 {
+		return nil, nil, errors.New("invalid ascii grid header")
+	}
+	if xCenter {
+		header.XLL -= header.CellSize[0] / 2
+	}
+	if yCenter {
+		header.YLL -= header.CellSize[1] / 2
+	}
+
+	data := make([]float64, 0, header.NCols*header.NRows)
+	for token != "" {
+		v, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = append(data, v)
+		if len(data) == cap(data) || !scanner.Scan() {
+			break
+		}
+		token = scanner.Text()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(data) < header.NCols*header.NRows {
+		return nil, nil, errors.New("ascii grid has too few values")
+	}
+	return header, data, nil
+}
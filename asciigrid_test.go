@@ -0,0 +1,49 @@
+package contour
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 测试 ESRI ASCII Grid 解析
+func TestAsciiGridRaster(t *testing.T) {
+	dir := t.TempDir()
+	content := `ncols 4
+nrows 3
+xllcenter 100.5
+yllcenter 200.5
+cellsize 1
+NODATA_value -9999
+1 2 3 4
+5 -9999 7 8
+9 10 11 12
+`
+	if err := os.WriteFile(filepath.Join(dir, "10_2_3.asc"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := NewAsciiGridLoader(dir, "{z}_{x}_{y}.asc", nil)
+	r, ok := loader.Load([3]int{2, 3, 10}).(*AsciiGridRaster)
+	if !ok || r == nil {
+		t.Fatal("failed to load ascii grid")
+	}
+	if w, h := r.Size(); w != 4 || h != 3 {
+		t.Errorf("unexpected size %dx%d", w, h)
+	}
+	if gt := r.GeoTransform(); gt != [6]float64{100, 1, 0, 203, 0, -1} {
+		t.Errorf("unexpected geotransform %v", gt)
+	}
+	if nd := r.NoData(); nd == nil || *nd != -9999 {
+		t.Errorf("unexpected nodata %v", nd)
+	}
+	if r.Elevation(2, 1) != 7 {
+		t.Errorf("expected 7, got %f", r.Elevation(2, 1))
+	}
+	if rng := r.Range(); rng[0] != 1 || rng[1] != 12 {
+		t.Errorf("unexpected range %v", rng)
+	}
+	if loader.Load([3]int{0, 0, 0}) != nil {
+		t.Error("expected nil raster for missing file")
+	}
+}
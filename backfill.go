@@ -0,0 +1,106 @@
+package contour
+
+import (
+	"sync"
+
+	"github.com/flywave/go-mapbox/raster"
+)
+
+const defaultBackfillCacheSize = 16
+
+// BackfillLoader fills the padding ring of each MapBoxDemRaster from its eight
+// neighbours, so contours of adjacent tiles meet at the seams.
+type BackfillLoader struct {
+	loader RasterLoader
+	cache  *lruCache[[3]int, *MapBoxDemRaster]
+	lock   sync.Mutex
+}
+
+func NewBackfillLoader(loader RasterLoader, cacheSize int) RasterLoader {
+	if loader == nil {
+		return nil
+	}
+	if cacheSize < 9 {
+		cacheSize = defaultBackfillCacheSize
+	}
+	return &BackfillLoader{loader: loader, cache: newLRUCache[[3]int, *MapBoxDemRaster](cacheSize)}
+}
+
+func (l *BackfillLoader) tile(coord [3]int) (*MapBoxDemRaster, Raster) {
+	if dem, ok := l.cache.get(coord); ok {
+		return dem, nil
+	}
+	r := l.loader.Load(coord)
+	dem, ok := r.(*MapBoxDemRaster)
+	if !ok {
+		return nil, r
+	}
+	l.cache.put(coord, dem)
+	return dem, nil
+}
+
+func (l *BackfillLoader) Load(coord [3]int) Raster {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	center, other := l.tile(coord)
+	if center == nil {
+		return other
+	}
+
+	n := 1 << uint(coord[2])
+	for dy := -1; dy <= 1; dy++ {
+		y := coord[1] + dy
+		if y < 0 || y >= n {
+			continue
+		}
+		for dx := -1; dx <= 1; dx++ {
+			if dx == 0 && dy == 0 {
+				continue
+			}
+			x := (coord[0] + dx + n) % n
+			neighbor, _ := l.tile([3]int{x, y, coord[2]})
+			if neighbor == nil || neighbor.data.Dim != center.data.Dim || neighbor.border != center.border {
+				continue
+			}
+			backfillBorder(center.data, neighbor.data, dx, dy, center.TileSize())
+		}
+	}
+	return center
+}
+
+// backfillBorder copies the padding pixels of d that fall inside the neighbour
+// at dx, dy. Only the padding ring is written, and only data inside the image
+// is read, so tiles can be shared between neighbours.
+func backfillBorder(d, data *raster.DEMData, dx, dy, tileSize int) {
+	xMin, xMax := 0, d.Dim
+	yMin, yMax := 0, d.Dim
+
+	if dx == -1 {
+		xMin, xMax = -1, 0
+	} else if dx == 1 {
+		xMin, xMax = d.Dim, d.Dim+1
+	}
+
+	if dy == -1 {
+		yMin, yMax = -1, 0
+	} else if dy == 1 {
+		yMin, yMax = d.Dim, d.Dim+1
+	}
+
+	ox := -dx * tileSize
+	oy := -dy * tileSize
+
+	for y := yMin; y < yMax; y++ {
+		for x := xMin; x < xMax; x++ {
+			if y != -1 && y != d.Dim && x != -1 && x != d.Dim {
+				continue
+			}
+			sx, sy := x+ox, y+oy
+			if sx < 0 || sy < 0 || sx >= data.Dim || sy >= data.Dim {
+				continue
+			}
+			d.Data[(y+1)*d.Stride+x+1] = data.Data[(sy+1)*data.Stride+sx+1]
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package contour
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/flywave/go-mapbox/raster"
+)
+
+// 测试从相邻瓦片回填边框
+func TestBackfillLoader(t *testing.T) {
+	dir := t.TempDir()
+	dim := 4
+	for tx := 0; tx < 3; tx++ {
+		for ty := 0; ty < 3; ty++ {
+			tx, ty := tx, ty
+			writeTestDemTile(t, dir, tileFileName("", "{z}_{x}_{y}.png", [3]int{tx, ty, 2}), dim, func(x, y int) color.NRGBA {
+				return color.NRGBA{128, uint8(tx*dim + x), uint8(ty*dim + y), 255}
+			})
+		}
+	}
+	loader := NewMapBoxDemLoaderWithOptions(dir, "{z}_{x}_{y}.png", MapBoxDemOptions{Encoding: raster.DEM_ENCODING_TERRARIUM})
+	value := func(gx, gy int) float64 {
+		return float64(gx) + float64(gy)/256
+	}
+
+	plain := loader.Load([3]int{1, 1, 2})
+	if v := plain.Elevation(0, 1); v != value(dim, dim) {
+		t.Errorf("expected duplicated edge, got %f", v)
+	}
+
+	r := NewBackfillLoader(loader, 0).Load([3]int{1, 1, 2})
+	if r == nil {
+		t.Fatal("failed to load backfilled tile")
+	}
+	for _, c := range []struct{ x, y, gx, gy int }{
+		{0, 1, dim - 1, dim},
+		{dim + 1, 2, 2 * dim, dim + 1},
+		{2, 0, dim + 1, dim - 1},
+		{3, dim + 1, dim + 2, 2 * dim},
+		{0, 0, dim - 1, dim - 1},
+		{dim + 1, dim + 1, 2 * dim, 2 * dim},
+		{1, 1, dim, dim},
+	} {
+		if v := r.Elevation(c.x, c.y); v != value(c.gx, c.gy) {
+			t.Errorf("pixel %d,%d: expected %f, got %f", c.x, c.y, value(c.gx, c.gy), v)
+		}
+	}
+
+	edge := NewBackfillLoader(loader, 0).Load([3]int{0, 0, 2})
+	if v := edge.Elevation(0, 1); v != value(0, 0) {
+		t.Errorf("expected duplicated edge without neighbour, got %f", v)
+	}
+	if v := edge.Elevation(dim+1, 1); v != value(dim, 0) {
+		t.Errorf("expected backfilled edge, got %f", v)
+	}
+}
@@ -0,0 +1,393 @@
+package contour
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/flywave/go-geo"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+const (
+	BIL_LAYOUT_BIL = "BIL"
+	BIL_LAYOUT_BIP = "BIP"
+	BIL_LAYOUT_BSQ = "BSQ"
+)
+
+type BilHeader struct {
+	NCols         int
+	NRows         int
+	NBands        int
+	NBits         int
+	SampleFormat  uint16
+	ByteOrder     binary.ByteOrder
+	Layout        string
+	SkipBytes     int64
+	BandRowBytes  int64
+	TotalRowBytes int64
+	GeoTransform  [6]float64
+	NoData        *float64
+}
+
+type BilRaster struct {
+	file   *os.File
+	header *BilHeader
+	band   int
+	row    []byte
+	rng    *[2]float64
+	srs    geo.Proj
+	lock   sync.Mutex
+}
+
+// NewBilRaster opens a raw BIL/BIP/BSQ/FLT raster described by an ESRI or ENVI .hdr sidecar.
+func NewBilRaster(fileName string, band int, srs geo.Proj) *BilRaster {
+	header, err := ReadBilHeader(fileName)
+	if err != nil || band < 0 || band >= header.NBands {
+		return nil
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil
+	}
+	return &BilRaster{file: f, header: header, band: band, srs: srs}
+}
+
+func bilHeaderFile(fileName string) (string, error) {
+	ext := filepath.Ext(fileName)
+	candidates := []string{strings.TrimSuffix(fileName, ext) + ".hdr", strings.TrimSuffix(fileName, ext) + ".HDR", fileName + ".hdr"}
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("no header found for %s", fileName)
+}
+
+func ReadBilHeader(fileName string) (*BilHeader, error) {
+	hdr, err := bilHeaderFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(hdr)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	first, _ := reader.Peek(4)
+	var header *BilHeader
+	if strings.EqualFold(string(first), "ENVI") {
+		header, err = parseEnviHeader(reader)
+	} else {
+		header, err = parseEsriHeader(reader, strings.EqualFold(filepath.Ext(fileName), ".flt"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if header.NCols <= 0 || header.NRows <= 0 || header.NBands <= 0 {
+		return nil, errors.New("invalid raster dimensions in header")
+	}
+	if err := checkSampleType(header.NBits, header.SampleFormat); err != nil {
+		return nil, err
+	}
+	bps := int64(header.NBits / 8)
+	if header.BandRowBytes == 0 {
+		header.BandRowBytes = int64(header.NCols) * bps
+	}
+	if header.TotalRowBytes == 0 {
+		header.TotalRowBytes = header.BandRowBytes * int64(header.NBands)
+	}
+	return header, nil
+}
+
+func parseEsriHeader(reader *bufio.Reader, flt bool) (*BilHeader, error) {
+	header := &BilHeader{NBands: 1, NBits: 8, SampleFormat: tiffSampleFormatUint, ByteOrder: binary.LittleEndian, Layout: BIL_LAYOUT_BIL}
+	if flt {
+		header.NBits, header.SampleFormat = 32, tiffSampleFormatFloat
+	}
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 {
+			values[strings.ToLower(fields[0])] = fields[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	num := func(key string) (float64, bool) {
+		s, ok := values[key]
+		if !ok {
+			return 0, false
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		return v, err == nil
+	}
+
+	if v, ok := num("ncols"); ok {
+		header.NCols = int(v)
+	}
+	if v, ok := num("nrows"); ok {
+		header.NRows = int(v)
+	}
+	if v, ok := num("nbands"); ok {
+		header.NBands = int(v)
+	}
+	if v, ok := num("nbits"); ok {
+		header.NBits = int(v)
+	}
+	if v, ok := num("skipbytes"); ok {
+		header.SkipBytes = int64(v)
+	}
+	if v, ok := num("bandrowbytes"); ok {
+		header.BandRowBytes = int64(v)
+	}
+	if v, ok := num("totalrowbytes"); ok {
+		header.TotalRowBytes = int64(v)
+	}
+	if v, ok := num("nodata"); ok {
+		header.NoData = &v
+	} else if v, ok := num("nodata_value"); ok {
+		header.NoData = &v
+	}
+	if s, ok := values["layout"]; ok {
+		header.Layout = strings.ToUpper(s)
+	} else if s, ok := values["interleaving"]; ok {
+		header.Layout = strings.ToUpper(s)
+	}
+	if s, ok := values["byteorder"]; ok {
+		switch strings.ToUpper(s) {
+		case "M", "MSBFIRST":
+			header.ByteOrder = binary.BigEndian
+		}
+	}
+	if s, ok := values["pixeltype"]; ok {
+		switch strings.ToUpper(s) {
+		case "SIGNEDINT":
+			header.SampleFormat = tiffSampleFormatInt
+		case "FLOAT":
+			header.SampleFormat = tiffSampleFormatFloat
+		default:
+			header.SampleFormat = tiffSampleFormatUint
+		}
+	}
+
+	xdim, ydim := 1.0, 1.0
+	if v, ok := num("cellsize"); ok {
+		xdim, ydim = v, v
+	}
+	if v, ok := num("xdim"); ok {
+		xdim = v
+	}
+	if v, ok := num("ydim"); ok {
+		ydim = v
+	}
+	header.GeoTransform = [6]float64{0, xdim, 0, float64(header.NRows) * ydim, 0, -ydim}
+	if x, ok := num("ulxmap"); ok {
+		header.GeoTransform[0] = x - xdim/2
+	} else if x, ok := num("xllcorner"); ok {
+		header.GeoTransform[0] = x
+	} else if x, ok := num("xllcenter"); ok {
+		header.GeoTransform[0] = x - xdim/2
+	}
+	if y, ok := num("ulymap"); ok {
+		header.GeoTransform[3] = y + ydim/2
+	} else if y, ok := num("yllcorner"); ok {
+		header.GeoTransform[3] = y + float64(header.NRows)*ydim
+	} else if y, ok := num("yllcenter"); ok {
+		header.GeoTransform[3] = y - ydim/2 + float64(header.NRows)*ydim
+	}
+	return header, nil
+}
+
+func parseEnviHeader(reader *bufio.Reader) (*BilHeader, error) {
+	header := &BilHeader{NBands: 1, ByteOrder: binary.LittleEndian, Layout: BIL_LAYOUT_BSQ}
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(reader)
+	var key, value string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if key != "" {
+			value += " " + strings.TrimSpace(line)
+			if strings.Contains(line, "}") {
+				values[key], key = strings.Trim(value, "{} "), ""
+			}
+			continue
+		}
+		idx := strings.Index(line, "=")
+		if idx < 0 {
+			continue
+		}
+		k := strings.ToLower(strings.TrimSpace(line[:idx]))
+		v := strings.TrimSpace(line[idx+1:])
+		if strings.HasPrefix(v, "{") && !strings.Contains(v, "}") {
+			key, value = k, v
+			continue
+		}
+		values[k] = strings.Trim(v, "{} ")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	atoi := func(key string) int {
+		v, _ := strconv.Atoi(values[key])
+		return v
+	}
+	header.NCols, header.NRows = atoi("samples"), atoi("lines")
+	if b := atoi("bands"); b > 0 {
+		header.NBands = b
+	}
+	header.SkipBytes = int64(atoi("header offset"))
+	if atoi("byte order") == 1 {
+		header.ByteOrder = binary.BigEndian
+	}
+	if s, ok := values["interleave"]; ok {
+		header.Layout = strings.ToUpper(s)
+	}
+
+	switch atoi("data type") {
+	case 1:
+		header.NBits, header.SampleFormat = 8, tiffSampleFormatUint
+	case 2:
+		header.NBits, header.SampleFormat = 16, tiffSampleFormatInt
+	case 3:
+		header.NBits, header.SampleFormat = 32, tiffSampleFormatInt
+	case 4:
+		header.NBits, header.SampleFormat = 32, tiffSampleFormatFloat
+	case 5:
+		header.NBits, header.SampleFormat = 64, tiffSampleFormatFloat
+	case 12:
+		header.NBits, header.SampleFormat = 16, tiffSampleFormatUint
+	case 13:
+		header.NBits, header.SampleFormat = 32, tiffSampleFormatUint
+	default:
+		return nil, fmt.Errorf("unsupported envi data type %s", values["data type"])
+	}
+
+	if s, ok := values["data ignore value"]; ok {
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			header.NoData = &v
+		}
+	}
+
+	header.GeoTransform = [6]float64{0, 1, 0, 0, 0, 1}
+	if s, ok := values["map info"]; ok {
+		parts := strings.Split(s, ",")
+		if len(parts) >= 7 {
+			var info [6]float64
+			for i := range info {
+				info[i], _ = strconv.ParseFloat(strings.TrimSpace(parts[i+1]), 64)
+			}
+			header.GeoTransform = [6]float64{info[2] - (info[0]-1)*info[4], info[4], 0, info[3] + (info[1]-1)*info[5], 0, -info[5]}
+		}
+	}
+	return header, nil
+}
+
+func (r *BilRaster) Header() *BilHeader {
+	return r.header
+}
+
+func (r *BilRaster) Close() error {
+	return r.file.Close()
+}
+
+func (r *BilRaster) Size() (w, h int) {
+	return r.header.NCols, r.header.NRows
+}
+
+func (r *BilRaster) rowLayout(y int) (offset int64, length int, stride int) {
+	h := r.header
+	bps := h.NBits / 8
+	switch h.Layout {
+	case BIL_LAYOUT_BIP:
+		return h.SkipBytes + int64(y)*h.TotalRowBytes + int64(r.band*bps), (h.NCols-1)*h.NBands*bps + bps, h.NBands * bps
+	case BIL_LAYOUT_BSQ:
+		return h.SkipBytes + int64(r.band)*int64(h.NRows)*h.BandRowBytes + int64(y)*h.BandRowBytes, h.NCols * bps, bps
+	default:
+		return h.SkipBytes + int64(y)*h.TotalRowBytes + int64(r.band)*h.BandRowBytes, h.NCols * bps, bps
+	}
+}
+
+func (r *BilRaster) Elevation(x, y int) float64 {
+	if x < 0 || y < 0 || x >= r.header.NCols || y >= r.header.NRows {
+		return math.NaN()
+	}
+	offset, _, stride := r.rowLayout(y)
+	buf := make([]byte, r.header.NBits/8)
+	if _, err := r.file.ReadAt(buf, offset+int64(x*stride)); err != nil {
+		return math.NaN()
+	}
+	return sampleValue(buf, r.header.ByteOrder, r.header.NBits, r.header.SampleFormat)
+}
+
+func (r *BilRaster) FetchLine(y int, line []float64) error {
+	if y < 0 || y >= r.header.NRows {
+		return fmt.Errorf("line %d out of range", y)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	offset, length, stride := r.rowLayout(y)
+	if len(r.row) < length {
+		r.row = make([]byte, length)
+	}
+	if _, err := r.file.ReadAt(r.row[:length], offset); err != nil {
+		return err
+	}
+	bps := r.header.NBits / 8
+	for i := 0; i < r.header.NCols && i < len(line); i++ {
+		line[i] = sampleValue(r.row[i*stride:i*stride+bps], r.header.ByteOrder, r.header.NBits, r.header.SampleFormat)
+	}
+	return nil
+}
+
+func (r *BilRaster) Srs() geo.Proj {
+	return r.srs
+}
+
+func (r *BilRaster) Bounds() vec2d.Rect {
+	return geoTransformBounds(r.header.GeoTransform, r.header.NCols, r.header.NRows)
+}
+
+func (r *BilRaster) NoData() *float64 {
+	return r.header.NoData
+}
+
+func (r *BilRaster) GeoTransform() [6]float64 {
+	return r.header.GeoTransform
+}
+
+func (r *BilRaster) Range() [2]float64 {
+	if r.rng != nil {
+		return *r.rng
+	}
+	min, max := math.MaxFloat64, -math.MaxFloat64
+	line := make([]float64, r.header.NCols)
+	for y := 0; y < r.header.NRows; y++ {
+		if err := r.FetchLine(y, line); err != nil {
+			return [2]float64{}
+		}
+		for _, d := range line {
+			if isNoData(d, r.header.NoData) {
+				continue
+			}
+			min, max = math.Min(min, d), math.Max(max, d)
+		}
+	}
+	r.rng = &[2]float64{min, max}
+	return *r.rng
+}
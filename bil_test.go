@@ -0,0 +1,108 @@
+package contour
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 测试 ESRI BIL 头文件与大端整型数据
+func TestBilRasterEsri(t *testing.T) {
+	dir := t.TempDir()
+	header := `BYTEORDER M
+LAYOUT BIL
+NROWS 2
+NCOLS 3
+NBANDS 2
+NBITS 16
+PIXELTYPE SIGNEDINT
+ULXMAP 10.5
+ULYMAP 49.5
+XDIM 1
+YDIM 1
+NODATA -32768
+`
+	values := []int16{
+		1, 2, 3, -1, -2, -3,
+		4, -32768, 6, -4, -5, -6,
+	}
+	data := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint16(data[2*i:], uint16(v))
+	}
+	os.WriteFile(filepath.Join(dir, "dem.hdr"), []byte(header), 0644)
+	os.WriteFile(filepath.Join(dir, "dem.bil"), data, 0644)
+
+	r := NewBilRaster(filepath.Join(dir, "dem.bil"), 0, nil)
+	if r == nil {
+		t.Fatal("failed to open bil")
+	}
+	defer r.Close()
+	if gt := r.GeoTransform(); gt != [6]float64{10, 1, 0, 50, 0, -1} {
+		t.Errorf("unexpected geotransform %v", gt)
+	}
+	line := make([]float64, 3)
+	if err := r.FetchLine(1, line); err != nil || line[0] != 4 || line[1] != -32768 || line[2] != 6 {
+		t.Errorf("unexpected line %v, %v", line, err)
+	}
+	if rng := r.Range(); rng[0] != 1 || rng[1] != 6 {
+		t.Errorf("unexpected range %v", rng)
+	}
+
+	r1 := NewBilRaster(filepath.Join(dir, "dem.bil"), 1, nil)
+	if r1 == nil {
+		t.Fatal("failed to open bil band 1")
+	}
+	defer r1.Close()
+	if r1.Elevation(2, 1) != -6 {
+		t.Errorf("expected -6, got %f", r1.Elevation(2, 1))
+	}
+}
+
+// 测试 ENVI 头文件与 BIP 浮点数据
+func TestBilRasterEnvi(t *testing.T) {
+	dir := t.TempDir()
+	header := `ENVI
+samples = 2
+lines = 2
+bands = 2
+header offset = 0
+data type = 4
+interleave = bip
+byte order = 0
+data ignore value = -9999
+map info = {UTM, 1.000, 1.000, 500000.000, 4000000.000, 
+ 30.000, 30.000, 50, North, WGS-84, units=Meters}
+`
+	values := []float32{1.5, 10, 2.5, 20, 3.5, 30, -9999, 40}
+	data := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+	}
+	os.WriteFile(filepath.Join(dir, "image.dat.hdr"), []byte(header), 0644)
+	os.WriteFile(filepath.Join(dir, "image.dat"), data, 0644)
+
+	r := NewBilRaster(filepath.Join(dir, "image.dat"), 1, nil)
+	if r == nil {
+		t.Fatal("failed to open envi raster")
+	}
+	defer r.Close()
+	if gt := r.GeoTransform(); gt != [6]float64{500000, 30, 0, 4000000, 0, -30} {
+		t.Errorf("unexpected geotransform %v", gt)
+	}
+	line := make([]float64, 2)
+	if err := r.FetchLine(1, line); err != nil || line[0] != 30 || line[1] != 40 {
+		t.Errorf("unexpected line %v, %v", line, err)
+	}
+
+	r0 := NewBilRaster(filepath.Join(dir, "image.dat"), 0, nil)
+	if r0 == nil {
+		t.Fatal("failed to open envi raster")
+	}
+	defer r0.Close()
+	if rng := r0.Range(); rng[0] != 1.5 || rng[1] != 3.5 {
+		t.Errorf("unexpected range %v", rng)
+	}
+}
@@ -0,0 +1,194 @@
+package contour
+
+import (
+	"math"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+// CurvilinearGrid is implemented by rasters whose nodes are located by
+// coordinate arrays rather than by an affine geotransform.
+type CurvilinearGrid interface {
+	NodeCoordinates() *NodeCoordinates
+}
+
+// NodeCoordinates holds the x/y (or lon/lat) of every pixel center in row
+// major order. Geographic longitudes are unwrapped within each cell, so grids
+// crossing the antimeridian interpolate across it.
+type NodeCoordinates struct {
+	x          []float64
+	y          []float64
+	width      int
+	height     int
+	geographic bool
+}
+
+func NewNodeCoordinates(x, y []float64, width, height int) *NodeCoordinates {
+	if width <= 0 || height <= 0 || len(x) < width*height || len(y) < width*height {
+		return nil
+	}
+	return &NodeCoordinates{x: x, y: y, width: width, height: height}
+}
+
+func (c *NodeCoordinates) Size() (w, h int) {
+	return c.width, c.height
+}
+
+func (c *NodeCoordinates) Node(i, j int) (float64, float64) {
+	k := j*c.width + i
+	return c.x[k], c.y[k]
+}
+
+// coordinateCell returns the lower node index of the cell holding the pixel center
+// offset f and the fraction within it, beyond the outer nodes the edge cell
+// is extrapolated.
+func coordinateCell(f float64, n int) (int, float64) {
+	if n < 2 {
+		return 0, 0
+	}
+	i := int(math.Floor(f))
+	if i < 0 {
+		i = 0
+	} else if i > n-2 {
+		i = n - 2
+	}
+	return i, f - float64(i)
+}
+
+// Transform maps a pixel space position, with pixel centers at +0.5, by
+// bilinear interpolation of the surrounding nodes.
+func (c *NodeCoordinates) Transform(px, py float64) (float64, float64) {
+	i, tx := coordinateCell(px-0.5, c.width)
+	j, ty := coordinateCell(py-0.5, c.height)
+	i1, j1 := minInt(i+1, c.width-1), minInt(j+1, c.height-1)
+	x00, y00 := c.Node(i, j)
+	x10, y10 := c.Node(i1, j)
+	x01, y01 := c.Node(i, j1)
+	x11, y11 := c.Node(i1, j1)
+	if c.geographic {
+		x10, x01, x11 = unwrapLongitude(x10, x00), unwrapLongitude(x01, x00), unwrapLongitude(x11, x00)
+	}
+	x := (1-ty)*((1-tx)*x00+tx*x10) + ty*((1-tx)*x01+tx*x11)
+	y := (1-ty)*((1-tx)*y00+tx*y10) + ty*((1-tx)*y01+tx*y11)
+	if c.geographic {
+		x = unwrapLongitude(x, 0)
+	}
+	return x, y
+}
+
+// unwrapLongitude shifts lon by whole turns to within 180 degrees of ref.
+func unwrapLongitude(lon, ref float64) float64 {
+	return ref + math.Remainder(lon-ref, 360)
+}
+
+// Bounds covers all nodes and the outer pixel edges.
+func (c *NodeCoordinates) Bounds() vec2d.Rect {
+	b := vec2d.Rect{Min: vec2d.MaxVal, Max: vec2d.MinVal}
+	for k := 0; k < c.width*c.height; k++ {
+		b.Extend(&vec2d.T{c.x[k], c.y[k]})
+	}
+	w, h := float64(c.width), float64(c.height)
+	for i := 0; i <= c.width; i++ {
+		for _, py := range []float64{0, h} {
+			x, y := c.Transform(float64(i), py)
+			b.Extend(&vec2d.T{x, y})
+		}
+	}
+	for j := 0; j <= c.height; j++ {
+		for _, px := range []float64{0, w} {
+			x, y := c.Transform(px, float64(j))
+			b.Extend(&vec2d.T{x, y})
+		}
+	}
+	return b
+}
+
+// cellSize returns the spacing of the nodes around node i, j along both grid
+// axes, geographic spacings are converted to meters.
+func (c *NodeCoordinates) cellSize(i, j int) (float64, float64) {
+	distance := func(i0, j0, i1, j1 int) float64 {
+		if i0 == i1 && j0 == j1 {
+			return 0
+		}
+		x0, y0 := c.Node(i0, j0)
+		x1, y1 := c.Node(i1, j1)
+		dx, dy := x1-x0, y1-y0
+		if c.geographic {
+			dx = math.Remainder(dx, 360) * metersPerDegree * math.Cos((y0+y1)/2*math.Pi/180)
+			dy *= metersPerDegree
+		}
+		return math.Hypot(dx, dy) / float64(i1-i0+j1-j0)
+	}
+	i0, i1 := maxInt(i-1, 0), minInt(i+1, c.width-1)
+	j0, j1 := maxInt(j-1, 0), minInt(j+1, c.height-1)
+	return distance(i0, j, i1, j), distance(i, j0, i, j1)
+}
+
+// pixelToGeo maps a contour vertex through the node coordinates when given,
+// otherwise through the geotransform.
+func pixelToGeo(gt [6]float64, coords *NodeCoordinates, p Point) (float64, float64) {
+	if coords != nil {
+		return coords.Transform(p[0], p[1])
+	}
+	return gt[0] + gt[1]*p[0] + gt[2]*p[1], gt[3] + gt[4]*p[0] + gt[5]*p[1]
+}
+
+// rasterNodeCoordinates looks through the wrappers that keep the grid of
+// their source, so filtered, filled, masked and derived curvilinear rasters
+// are still placed by their nodes.
+func rasterNodeCoordinates(r Raster) *NodeCoordinates {
+	for r != nil {
+		switch s := r.(type) {
+		case CurvilinearGrid:
+			return s.NodeCoordinates()
+		case *FilteredRaster:
+			r = s.Source()
+		case *FilledRaster:
+			r = s.Source()
+		case *MaskedRaster:
+			r = s.Source()
+		case *TerrainRaster:
+			r = s.Source()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// CurvilinearRaster attaches node coordinates to the values of another
+// raster, GeoTransform only approximates the extent of the grid.
+type CurvilinearRaster struct {
+	Raster
+	coords *NodeCoordinates
+	bounds vec2d.Rect
+}
+
+func NewCurvilinearRaster(src Raster, x, y []float64) *CurvilinearRaster {
+	if src == nil {
+		return nil
+	}
+	w, h := src.Size()
+	coords := NewNodeCoordinates(x, y, w, h)
+	if coords == nil {
+		return nil
+	}
+	if srs := src.Srs(); srs != nil && srs.IsLatLong() {
+		coords.geographic = true
+	}
+	return &CurvilinearRaster{Raster: src, coords: coords, bounds: coords.Bounds()}
+}
+
+func (r *CurvilinearRaster) NodeCoordinates() *NodeCoordinates {
+	return r.coords
+}
+
+func (r *CurvilinearRaster) Bounds() vec2d.Rect {
+	return r.bounds
+}
+
+func (r *CurvilinearRaster) GeoTransform() [6]float64 {
+	w, h := r.Size()
+	b := r.bounds
+	return [6]float64{b.Min[0], (b.Max[0] - b.Min[0]) / float64(w), 0, b.Max[1], 0, -(b.Max[1] - b.Min[1]) / float64(h)}
+}
@@ -0,0 +1,263 @@
+package contour
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/flywave/go-geom/general"
+)
+
+// rotatedNodes 返回绕原点旋转 30 度的像元中心坐标
+func rotatedNodes(w, h int) ([]float64, []float64) {
+	x, y := make([]float64, w*h), make([]float64, w*h)
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			x[j*w+i], y[j*w+i] = rotatePoint(float64(i)+0.5, float64(j)+0.5)
+		}
+	}
+	return x, y
+}
+
+func rotatePoint(x, y float64) (float64, float64) {
+	s, c := math.Sincos(math.Pi / 6)
+	return c*x - s*y, s*x + c*y
+}
+
+func geometryVertices(g interface{}) [][]float64 {
+	switch d := g.(type) {
+	case interface{ Data() [][]float64 }:
+		return d.Data()
+	case interface{ Data() [][][]float64 }:
+		var out [][]float64
+		for _, ring := range d.Data() {
+			out = append(out, ring...)
+		}
+		return out
+	}
+	return nil
+}
+
+// 测试节点坐标的双线性插值和边缘外推
+func TestNodeCoordinatesTransform(t *testing.T) {
+	x, y := rotatedNodes(4, 3)
+	c := NewNodeCoordinates(x, y, 4, 3)
+	for _, p := range [][2]float64{{0.5, 0.5}, {2.25, 1.75}, {0, 0}, {4, 3}, {4, 0}} {
+		gx, gy := c.Transform(p[0], p[1])
+		wx, wy := rotatePoint(p[0], p[1])
+		if math.Abs(gx-wx) > 1e-9 || math.Abs(gy-wy) > 1e-9 {
+			t.Fatalf("pixel %v: expected %v %v, got %v %v", p, wx, wy, gx, gy)
+		}
+	}
+	b := c.Bounds()
+	if wx, _ := rotatePoint(4, 0); math.Abs(b.Max[0]-wx) > 1e-9 {
+		t.Fatalf("unexpected bounds %v", b)
+	}
+	if NewNodeCoordinates(x[:5], y, 4, 3) != nil {
+		t.Fatal("expected nil for short coordinate arrays")
+	}
+}
+
+// 测试曲线网格上的等值线和多边形顶点与仿射结果旋转后一致
+func TestCurvilinearContourGenerate(t *testing.T) {
+	w, h := 6, 5
+	data := make([]float64, w*h)
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			data[j*w+i] = float64(i*i + j)
+		}
+	}
+	plain := NewMemoryRaster(data, w, h, [6]float64{0, 1, 0, 0, 0, 1}, nil, nil)
+	x, y := rotatedNodes(w, h)
+	curved := NewCurvilinearRaster(NewMemoryRaster(data, w, h, [6]float64{0, 1, 0, 0, 0, 1}, nil, nil), x, y)
+	if curved.NodeCoordinates() == nil || curved.GeoTransform()[1] <= 0 {
+		t.Fatal("expected node coordinates")
+	}
+
+	want, got := NewMockGeometryWriter(), NewMockGeometryWriter()
+	if err := ContourGenerate(plain, want, ContourGenerateOptions{Interval: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ContourGenerate(curved, got, ContourGenerateOptions{Interval: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if len(want.writtenGeom) == 0 || len(want.writtenGeom) != len(got.writtenGeom) {
+		t.Fatalf("expected %d lines, got %d", len(want.writtenGeom), len(got.writtenGeom))
+	}
+	// 每个等值线级别只有一条线, 按级别对应
+	expected := make(map[float64][][]float64)
+	for i, g := range want.writtenGeom {
+		expected[want.writtenMaxLevel[i]] = geometryVertices(g)
+	}
+	for i, g := range got.writtenGeom {
+		wv, gv := expected[got.writtenMaxLevel[i]], geometryVertices(g)
+		if len(wv) == 0 || len(wv) != len(gv) {
+			t.Fatalf("level %v: vertex count %d != %d", got.writtenMaxLevel[i], len(wv), len(gv))
+		}
+		for k := range wv {
+			rx, ry := rotatePoint(wv[k][0], wv[k][1])
+			if math.Abs(rx-gv[k][0]) > 1e-9 || math.Abs(ry-gv[k][1]) > 1e-9 {
+				t.Fatalf("level %v vertex %d: expected %v %v, got %v", got.writtenMaxLevel[i], k, rx, ry, gv[k])
+			}
+		}
+	}
+
+	polys := NewMockGeometryWriter()
+	pw := &GeomPolygonContourWriter{polyWriter: polys, coords: curved.NodeCoordinates()}
+	pw.StartPolygon(10)
+	pw.AddPart(LineString{{0, 0}, {6, 0}, {6, 5}, {0, 0}})
+	pw.AddInteriorRing(LineString{{1.5, 1.5}, {2.5, 1.5}, {2.5, 2.5}, {1.5, 1.5}})
+	pw.EndPolygon()
+	if len(polys.writtenGeom) != 1 {
+		t.Fatalf("expected one polygon, got %d", len(polys.writtenGeom))
+	}
+	for k, v := range geometryVertices(polys.writtenGeom[0]) {
+		p := []Point{{0, 0}, {6, 0}, {6, 5}, {0, 0}, {1.5, 1.5}, {2.5, 1.5}, {2.5, 2.5}, {1.5, 1.5}}[k]
+		rx, ry := rotatePoint(p[0], p[1])
+		if math.Abs(rx-v[0]) > 1e-9 || math.Abs(ry-v[1]) > 1e-9 {
+			t.Fatalf("polygon vertex %d: expected %v %v, got %v", k, rx, ry, v)
+		}
+	}
+}
+
+// 测试跨越 ±180 度经线的网格在单元内展开经度插值, 等值线不会跨越整个地球
+func TestCurvilinearAntimeridian(t *testing.T) {
+	w, h := 4, 3
+	lons := []float64{178.5, 179.5, -179.5, -178.5}
+	x, y, data := make([]float64, w*h), make([]float64, w*h), make([]float64, w*h)
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			x[j*w+i], y[j*w+i], data[j*w+i] = lons[i], float64(12-j), float64(i*10)
+		}
+	}
+	r := NewCurvilinearRaster(NewMemoryRaster(data, w, h, [6]float64{0, 1, 0, 0, 0, 1}, srs4326, nil), x, y)
+	if lon, _ := r.NodeCoordinates().Transform(2, 1.5); math.Abs(math.Abs(lon)-180) > 1e-9 {
+		t.Fatalf("expected the antimeridian between the middle nodes, got %v", lon)
+	}
+	if lon, _ := r.NodeCoordinates().Transform(2.25, 1.5); math.Abs(lon+179.75) > 1e-9 {
+		t.Fatalf("expected -179.75, got %v", lon)
+	}
+
+	lines := NewMockGeometryWriter()
+	if err := ContourGenerate(r, lines, ContourGenerateOptions{Base: 5, Interval: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines.writtenGeom) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines.writtenGeom))
+	}
+	for i, g := range lines.writtenGeom {
+		for _, v := range geometryVertices(g) {
+			if math.Abs(v[0]) < 178.5 {
+				t.Fatalf("level %v: vertex %v is off the antimeridian", lines.writtenMaxLevel[i], v)
+			}
+		}
+	}
+}
+
+// 测试包装在滤波、掩膜和地形栅格里的曲线网格仍按节点坐标定位, 重采样和重投影拒绝曲线网格
+func TestCurvilinearWrappedRasters(t *testing.T) {
+	w, h := 6, 5
+	data := make([]float64, w*h)
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			data[j*w+i] = float64(i*i + j)
+		}
+	}
+	x, y := rotatedNodes(w, h)
+	newSrc := func() *MemoryRaster {
+		return NewMemoryRaster(append([]float64{}, data...), w, h, [6]float64{0, 1, 0, 0, 0, 1}, nil, nil)
+	}
+	filtered := NewMeanFilterRaster(NewCurvilinearRaster(newSrc(), x, y), 3)
+	expected := NewCurvilinearRaster(NewMeanFilterRaster(newSrc(), 3), x, y)
+	if rasterNodeCoordinates(filtered) == nil {
+		t.Fatal("expected the node coordinates of the wrapped raster")
+	}
+
+	want, got := NewMockGeometryWriter(), NewMockGeometryWriter()
+	if err := ContourGenerate(expected, want, ContourGenerateOptions{Interval: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ContourGenerate(filtered, got, ContourGenerateOptions{Interval: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if len(want.writtenGeom) == 0 || len(want.writtenGeom) != len(got.writtenGeom) {
+		t.Fatalf("expected %d lines, got %d", len(want.writtenGeom), len(got.writtenGeom))
+	}
+	lines := make(map[float64][][]float64)
+	for i, g := range want.writtenGeom {
+		lines[want.writtenMaxLevel[i]] = geometryVertices(g)
+	}
+	for i, g := range got.writtenGeom {
+		level := got.writtenMaxLevel[i]
+		wv, gv := lines[level], geometryVertices(g)
+		if len(wv) == 0 || len(wv) != len(gv) {
+			t.Fatalf("level %v: vertex count %d != %d", level, len(wv), len(gv))
+		}
+		for k := range wv {
+			if math.Abs(wv[k][0]-gv[k][0]) > 1e-9 || math.Abs(wv[k][1]-gv[k][1]) > 1e-9 {
+				t.Fatalf("level %v vertex %d: expected %v, got %v", level, k, wv[k], gv[k])
+			}
+		}
+	}
+
+	// 掩膜只覆盖像元 (1, 0) 的节点
+	cx, cy := rotatePoint(1.5, 0.5)
+	cut := general.NewPolygon([][][]float64{{{cx - 0.2, cy - 0.2}, {cx + 0.2, cy - 0.2}, {cx + 0.2, cy + 0.2}, {cx - 0.2, cy + 0.2}, {cx - 0.2, cy - 0.2}}})
+	masked := NewMaskedRaster(NewCurvilinearRaster(newSrc(), x, y), cut, nil)
+	line := make([]float64, w)
+	if err := masked.FetchLine(0, line); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range line {
+		if (i == 1) == math.IsNaN(v) {
+			t.Fatalf("unexpected masked line %v", line)
+		}
+	}
+	if math.IsNaN(masked.Elevation(1, 0)) || !math.IsNaN(masked.Elevation(1, 1)) {
+		t.Fatal("expected only the node of pixel 1, 0 inside the mask")
+	}
+
+	// 节点间距为 1, 沿列方向坡度为 1
+	plane := make([]float64, w*h)
+	for k := range plane {
+		plane[k] = float64(k % w)
+	}
+	slope := NewTerrainRaster(NewCurvilinearRaster(NewMemoryRaster(plane, w, h, [6]float64{0, 1, 0, 0, 0, 1}, nil, nil), x, y), TERRAIN_SLOPE_DEGREES, TerrainOptions{})
+	if v := slope.Elevation(2, 2); math.Abs(v-45) > 1e-9 {
+		t.Fatalf("expected a slope of 45 degrees from the node spacing, got %v", v)
+	}
+
+	if NewResampledRaster(filtered, 2, RESAMPLE_BILINEAR) != nil || NewWarpedRasterWithGrid(filtered, srs4326, [6]float64{0, 1, 0, 0, 0, -1}, 2, 2, RESAMPLE_BILINEAR) != nil {
+		t.Fatal("expected curvilinear sources to be rejected")
+	}
+}
+
+// 测试从 netCDF 的二维经纬度变量构建曲线网格
+func TestNetCDFCurvilinearRaster(t *testing.T) {
+	dims := []NetCDFDimension{{Name: "eta", Length: 2}, {Name: "xi", Length: 3}}
+	vars := []testNCVar{
+		{name: "lon_rho", dims: []int{0, 1}, typ: NC_DOUBLE, data: []float64{120, 121, 122, 120.5, 121.5, 122.5},
+			attrs: []testNCAttr{{name: "units", typ: NC_CHAR, text: "degree_east"}}},
+		{name: "lat_rho", dims: []int{0, 1}, typ: NC_DOUBLE, data: []float64{30, 30.2, 30.4, 31, 31.2, 31.4},
+			attrs: []testNCAttr{{name: "units", typ: NC_CHAR, text: "degree_north"}}},
+		{name: "h", dims: []int{0, 1}, typ: NC_FLOAT, data: []float64{10, 20, 30, 40, 50, 60},
+			attrs: []testNCAttr{{name: "coordinates", typ: NC_CHAR, text: "lon_rho lat_rho"}}},
+	}
+	nc, err := ReadNetCDF(bytes.NewReader(buildTestNetCDF(1, 0, dims, vars)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := nc.CurvilinearRaster(NetCDFOptions{Variable: "h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lon, lat := r.NodeCoordinates().Node(2, 1); lon != 122.5 || lat != 31.4 {
+		t.Fatalf("unexpected node %v %v", lon, lat)
+	}
+	if r.Elevation(2, 1) != 60 || r.Srs() == nil {
+		t.Fatalf("unexpected raster %v %v", r.Elevation(2, 1), r.Srs())
+	}
+	if _, err := nc.CurvilinearRaster(NetCDFOptions{Variable: "lon_rho"}); err == nil {
+		t.Fatal("expected error without coordinates attribute")
+	}
+}
@@ -0,0 +1,275 @@
+package contour
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/flywave/go-geo"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+type FillMethod uint8
+
+const (
+	FILL_IDW FillMethod = iota
+	FILL_LAPLACIAN
+)
+
+const laplacianIterations = 64
+
+// FilledRaster fills nodata pixels from the valid pixels within maxDistance.
+// A pixel is only filled when valid pixels are found in all four quadrants
+// around it, so small holes close while large voids and the raster edges stay
+// nodata.
+type FilledRaster struct {
+	src         Raster
+	maxDistance int
+	method      FillMethod
+	width       int
+	height      int
+	nodata      *float64
+	cache       *lineCache
+	rows        [][]float64
+	block       int
+	filled      [][]float64
+	rng         *[2]float64
+	lock        sync.Mutex
+}
+
+func NewFilledRaster(src Raster, maxDistance int, method FillMethod) *FilledRaster {
+	if src == nil || maxDistance < 1 {
+		return nil
+	}
+	w, h := src.Size()
+	n := 2*maxDistance + 1
+	if method == FILL_LAPLACIAN {
+		// a block of rows plus the fillable margin and its idw neighbourhood
+		n += 4 * maxDistance
+	}
+	return &FilledRaster{src: src, maxDistance: maxDistance, method: method, width: w, height: h, nodata: src.NoData(), cache: newLineCache(src, n+1), rows: make([][]float64, n), block: -1}
+}
+
+func (r *FilledRaster) Source() Raster {
+	return r.src
+}
+
+// window loads the rows from top on into r.rows, rows outside the raster are
+// nil.
+func (r *FilledRaster) window(top int) error {
+	for i := range r.rows {
+		r.rows[i] = nil
+		if top+i < 0 || top+i >= r.height {
+			continue
+		}
+		line, err := r.cache.line(top + i)
+		if err != nil {
+			return err
+		}
+		r.rows[i] = line
+	}
+	return nil
+}
+
+func (r *FilledRaster) valid(row, x int) (float64, bool) {
+	if row < 0 || row >= len(r.rows) || r.rows[row] == nil || x < 0 || x >= r.width {
+		return 0, false
+	}
+	v := r.rows[row][x]
+	return v, !isNoData(v, r.nodata)
+}
+
+// idw interpolates the pixel at x in window row c by inverse squared distance.
+func (r *FilledRaster) idw(c, x int) (float64, bool) {
+	d := r.maxDistance
+	var quadrants [4]bool
+	sum, wsum := 0.0, 0.0
+	for dy := -d; dy <= d; dy++ {
+		for dx := -d; dx <= d; dx++ {
+			dist := dx*dx + dy*dy
+			if dist == 0 || dist > d*d {
+				continue
+			}
+			v, ok := r.valid(c+dy, x+dx)
+			if !ok {
+				continue
+			}
+			q := 0
+			if dx > 0 || (dx == 0 && dy > 0) {
+				q++
+			}
+			if dy > 0 || (dy == 0 && dx < 0) {
+				q += 2
+			}
+			quadrants[q] = true
+			w := 1 / float64(dist)
+			sum += v * w
+			wsum += w
+		}
+	}
+	if !quadrants[0] || !quadrants[1] || !quadrants[2] || !quadrants[3] {
+		return 0, false
+	}
+	return sum / wsum, true
+}
+
+// fillBlock fills the rows of the block starting at top. The fillable
+// pixels of the block and a margin of maxDistance rows are relaxed towards
+// the average of their four neighbours in row major order, starting from the
+// idw estimate.
+func (r *FilledRaster) fillBlock(top int) error {
+	d := r.maxDistance
+	n := 2*d + 1
+	if err := r.window(top - 2*d); err != nil {
+		return err
+	}
+	grid := make([][]float64, len(r.rows))
+	for row, line := range r.rows {
+		if line == nil {
+			continue
+		}
+		grid[row] = make([]float64, r.width)
+		for x, v := range line {
+			if isNoData(v, r.nodata) {
+				v = math.NaN()
+			}
+			grid[row][x] = v
+		}
+	}
+	var holes [][2]int
+	for row := d; row < len(r.rows)-d; row++ {
+		for x := 0; grid[row] != nil && x < r.width; x++ {
+			if !math.IsNaN(grid[row][x]) {
+				continue
+			}
+			if v, ok := r.idw(row, x); ok {
+				grid[row][x] = v
+				holes = append(holes, [2]int{row, x})
+			}
+		}
+	}
+	for i := 0; i < laplacianIterations && len(holes) > 0; i++ {
+		for _, k := range holes {
+			sum, cnt := 0.0, 0
+			for _, o := range [4][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}} {
+				row, x := k[0]+o[0], k[1]+o[1]
+				if row < 0 || row >= len(grid) || grid[row] == nil || x < 0 || x >= r.width || math.IsNaN(grid[row][x]) {
+					continue
+				}
+				sum += grid[row][x]
+				cnt++
+			}
+			if cnt > 0 {
+				grid[k[0]][k[1]] = sum / float64(cnt)
+			}
+		}
+	}
+
+	if r.filled == nil {
+		r.filled = make([][]float64, n)
+	}
+	for i := range r.filled {
+		src := r.rows[2*d+i]
+		if src == nil {
+			r.filled[i] = nil
+			continue
+		}
+		if r.filled[i] == nil {
+			r.filled[i] = make([]float64, r.width)
+		}
+		for x, v := range grid[2*d+i] {
+			if math.IsNaN(v) {
+				v = src[x]
+			}
+			r.filled[i][x] = v
+		}
+	}
+	r.block = top
+	return nil
+}
+
+func (r *FilledRaster) Size() (w, h int) {
+	return r.width, r.height
+}
+
+func (r *FilledRaster) Elevation(x, y int) float64 {
+	if x < 0 || y < 0 || x >= r.width || y >= r.height {
+		return math.NaN()
+	}
+	line := make([]float64, r.width)
+	if err := r.FetchLine(y, line); err != nil {
+		return math.NaN()
+	}
+	return line[x]
+}
+
+func (r *FilledRaster) FetchLine(y int, line []float64) error {
+	if y < 0 || y >= r.height {
+		return errors.New("line out of range")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.method == FILL_LAPLACIAN {
+		// blocks are aligned so the result does not depend on the access order
+		top := y / (2*r.maxDistance + 1) * (2*r.maxDistance + 1)
+		if r.block != top {
+			if err := r.fillBlock(top); err != nil {
+				return err
+			}
+		}
+		copy(line, r.filled[y-top])
+		return nil
+	}
+	c := r.maxDistance
+	if err := r.window(y - c); err != nil {
+		return err
+	}
+	copy(line, r.rows[c])
+	for x := 0; x < r.width && x < len(line); x++ {
+		if !isNoData(line[x], r.nodata) {
+			continue
+		}
+		if v, ok := r.idw(c, x); ok {
+			line[x] = v
+		}
+	}
+	return nil
+}
+
+func (r *FilledRaster) Srs() geo.Proj {
+	return r.src.Srs()
+}
+
+func (r *FilledRaster) Bounds() vec2d.Rect {
+	return r.src.Bounds()
+}
+
+func (r *FilledRaster) NoData() *float64 {
+	return r.nodata
+}
+
+func (r *FilledRaster) GeoTransform() [6]float64 {
+	return r.src.GeoTransform()
+}
+
+func (r *FilledRaster) Range() [2]float64 {
+	if r.rng != nil {
+		return *r.rng
+	}
+	min, max := math.MaxFloat64, -math.MaxFloat64
+	line := make([]float64, r.width)
+	for y := 0; y < r.height; y++ {
+		if err := r.FetchLine(y, line); err != nil {
+			return [2]float64{}
+		}
+		for _, d := range line {
+			if isNoData(d, r.nodata) {
+				continue
+			}
+			min, max = math.Min(min, d), math.Max(max, d)
+		}
+	}
+	r.rng = &[2]float64{min, max}
+	return *r.rng
+}
@@ -0,0 +1,96 @@
+package contour
+
+import (
+	"math"
+	"testing"
+)
+
+// 测试小空洞被填补而大片空白保持无效值
+func TestFilledRaster(t *testing.T) {
+	nodata := -9999.0
+	size := 20
+	data := make([]float64, size*size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			data[y*size+x] = float64(x) + 2*float64(y)
+			hole := x >= 4 && x <= 6 && y >= 4 && y <= 6
+			void := x >= 12 && y >= 12
+			if hole || void {
+				data[y*size+x] = nodata
+			}
+		}
+	}
+	src := NewMemoryRaster(data, size, size, [6]float64{0, 1, 0, 20, 0, -1}, nil, &nodata)
+
+	for _, c := range []struct {
+		method FillMethod
+		tol    float64
+	}{
+		{FILL_IDW, 1.5},
+		{FILL_LAPLACIAN, 1e-3},
+	} {
+		r := NewFilledRaster(src, 3, c.method)
+		if r == nil {
+			t.Fatal("failed to create filled raster")
+		}
+		line := make([]float64, size)
+		for y := 0; y < size; y++ {
+			if err := r.FetchLine(y, line); err != nil {
+				t.Fatal(err)
+			}
+			for x := 0; x < size; x++ {
+				expected := float64(x) + 2*float64(y)
+				switch {
+				case x >= 12 && y >= 12:
+					if line[x] != nodata {
+						t.Errorf("method %d pixel %d,%d: expected void to stay nodata, got %f", c.method, x, y, line[x])
+					}
+				case math.Abs(line[x]-expected) > c.tol:
+					t.Errorf("method %d pixel %d,%d: expected %f, got %f", c.method, x, y, expected, line[x])
+				}
+			}
+		}
+		if v := r.Elevation(5, 5); math.Abs(v-15) > c.tol {
+			t.Errorf("method %d: expected 15 at hole center, got %f", c.method, v)
+		}
+	}
+}
+
+// 测试拉普拉斯填补对同一空洞的结果可重复且与读取顺序无关
+func TestFilledRasterLaplacianDeterministic(t *testing.T) {
+	nodata := -9999.0
+	size := 16
+	data := make([]float64, size*size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			data[y*size+x] = math.Sin(float64(x)/3) * float64(y*y)
+			if x >= 5 && x <= 8 && y >= 6 && y <= 9 {
+				data[y*size+x] = nodata
+			}
+		}
+	}
+	fill := func(reverse bool) []float64 {
+		src := NewMemoryRaster(data, size, size, [6]float64{0, 1, 0, 16, 0, -1}, nil, &nodata)
+		r := NewFilledRaster(src, 3, FILL_LAPLACIAN)
+		out := make([]float64, size*size)
+		for i := 0; i < size; i++ {
+			y := i
+			if reverse {
+				y = size - 1 - i
+			}
+			if err := r.FetchLine(y, out[y*size:(y+1)*size]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return out
+	}
+	first, second, reversed := fill(false), fill(false), fill(true)
+	for i := range first {
+		if first[i] != second[i] || first[i] != reversed[i] {
+			t.Fatalf("pixel %d differs: %v %v %v", i, first[i], second[i], reversed[i])
+		}
+	}
+	if first[7*size+6] == nodata {
+		t.Fatal("expected the gap to be filled")
+	}
+}
@@ -0,0 +1,280 @@
+package contour
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/flywave/go-geo"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+// filterKernel computes a filtered value from the rows around a pixel, rows
+// outside the raster are nil. The center value is never nodata.
+type filterKernel interface {
+	radius() int
+	apply(rows [][]float64, x int, nodata *float64) float64
+}
+
+type weightedKernel struct {
+	r       int
+	weights [][]float64
+}
+
+func (k *weightedKernel) radius() int {
+	return k.r
+}
+
+func (k *weightedKernel) apply(rows [][]float64, x int, nodata *float64) float64 {
+	sum, wsum := 0.0, 0.0
+	for dy, row := range rows {
+		if row == nil {
+			continue
+		}
+		for dx := -k.r; dx <= k.r; dx++ {
+			i := x + dx
+			if i < 0 || i >= len(row) || isNoData(row[i], nodata) {
+				continue
+			}
+			w := k.weights[dy][dx+k.r]
+			sum += row[i] * w
+			wsum += w
+		}
+	}
+	return sum / wsum
+}
+
+func newMeanKernel(size int) *weightedKernel {
+	r := size / 2
+	k := &weightedKernel{r: r, weights: make([][]float64, 2*r+1)}
+	for i := range k.weights {
+		k.weights[i] = make([]float64, 2*r+1)
+		for j := range k.weights[i] {
+			k.weights[i][j] = 1
+		}
+	}
+	return k
+}
+
+func newGaussianKernel(sigma float64) *weightedKernel {
+	r := int(math.Ceil(3 * sigma))
+	k := &weightedKernel{r: r, weights: make([][]float64, 2*r+1)}
+	for i := range k.weights {
+		k.weights[i] = make([]float64, 2*r+1)
+		for j := range k.weights[i] {
+			dx, dy := float64(j-r), float64(i-r)
+			k.weights[i][j] = math.Exp(-(dx*dx + dy*dy) / (2 * sigma * sigma))
+		}
+	}
+	return k
+}
+
+type medianKernel struct {
+	r      int
+	values []float64
+}
+
+func (k *medianKernel) radius() int {
+	return k.r
+}
+
+func (k *medianKernel) apply(rows [][]float64, x int, nodata *float64) float64 {
+	k.values = k.values[:0]
+	for _, row := range rows {
+		if row == nil {
+			continue
+		}
+		for i := maxInt(0, x-k.r); i <= x+k.r && i < len(row); i++ {
+			if !isNoData(row[i], nodata) {
+				k.values = append(k.values, row[i])
+			}
+		}
+	}
+	sort.Float64s(k.values)
+	n := len(k.values)
+	if n%2 == 1 {
+		return k.values[n/2]
+	}
+	return (k.values[n/2-1] + k.values[n/2]) / 2
+}
+
+// bilateralKernel weights neighbours by distance and by the difference to the
+// center value, so steps such as cliffs and breaklines are kept.
+type bilateralKernel struct {
+	weightedKernel
+	sigmaRange float64
+}
+
+func (k *bilateralKernel) apply(rows [][]float64, x int, nodata *float64) float64 {
+	center := rows[k.r][x]
+	sum, wsum := 0.0, 0.0
+	for dy, row := range rows {
+		if row == nil {
+			continue
+		}
+		for dx := -k.r; dx <= k.r; dx++ {
+			i := x + dx
+			if i < 0 || i >= len(row) || isNoData(row[i], nodata) {
+				continue
+			}
+			d := row[i] - center
+			w := k.weights[dy][dx+k.r] * math.Exp(-d*d/(2*k.sigmaRange*k.sigmaRange))
+			sum += row[i] * w
+			wsum += w
+		}
+	}
+	return sum / wsum
+}
+
+// FilteredRaster smooths another raster while streaming its lines. Nodata
+// pixels stay nodata and are left out of the window of their neighbours.
+type FilteredRaster struct {
+	src    Raster
+	kernel filterKernel
+	width  int
+	height int
+	cache  *lineCache
+	rows   [][]float64
+	rng    *[2]float64
+	lock   sync.Mutex
+}
+
+func newFilteredRaster(src Raster, kernel filterKernel) *FilteredRaster {
+	w, h := src.Size()
+	r := kernel.radius()
+	return &FilteredRaster{src: src, kernel: kernel, width: w, height: h, cache: newLineCache(src, 2*r+2), rows: make([][]float64, 2*r+1)}
+}
+
+// NewMeanFilterRaster averages a size x size window, size should be odd.
+func NewMeanFilterRaster(src Raster, size int) *FilteredRaster {
+	if src == nil || size < 1 {
+		return nil
+	}
+	return newFilteredRaster(src, newMeanKernel(size))
+}
+
+func NewGaussianFilterRaster(src Raster, sigma float64) *FilteredRaster {
+	if src == nil || sigma <= 0 {
+		return nil
+	}
+	return newFilteredRaster(src, newGaussianKernel(sigma))
+}
+
+func NewMedianFilterRaster(src Raster, size int) *FilteredRaster {
+	if src == nil || size < 1 {
+		return nil
+	}
+	return newFilteredRaster(src, &medianKernel{r: size / 2})
+}
+
+// NewBilateralFilterRaster uses sigmaSpace in pixels and sigmaRange in elevation units.
+func NewBilateralFilterRaster(src Raster, sigmaSpace, sigmaRange float64) *FilteredRaster {
+	if src == nil || sigmaSpace <= 0 || sigmaRange <= 0 {
+		return nil
+	}
+	return newFilteredRaster(src, &bilateralKernel{weightedKernel: *newGaussianKernel(sigmaSpace), sigmaRange: sigmaRange})
+}
+
+func (r *FilteredRaster) Source() Raster {
+	return r.src
+}
+
+// window loads the rows around y into r.rows.
+func (r *FilteredRaster) window(y int) error {
+	k := r.kernel.radius()
+	for dy := -k; dy <= k; dy++ {
+		r.rows[dy+k] = nil
+		if y+dy < 0 || y+dy >= r.height {
+			continue
+		}
+		line, err := r.cache.line(y + dy)
+		if err != nil {
+			return err
+		}
+		r.rows[dy+k] = line
+	}
+	return nil
+}
+
+func (r *FilteredRaster) Size() (w, h int) {
+	return r.width, r.height
+}
+
+func (r *FilteredRaster) Elevation(x, y int) float64 {
+	if x < 0 || y < 0 || x >= r.width || y >= r.height {
+		return math.NaN()
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err := r.window(y); err != nil {
+		return math.NaN()
+	}
+	center := r.rows[r.kernel.radius()][x]
+	if isNoData(center, r.src.NoData()) {
+		return center
+	}
+	return r.kernel.apply(r.rows, x, r.src.NoData())
+}
+
+func (r *FilteredRaster) FetchLine(y int, line []float64) error {
+	if y < 0 || y >= r.height {
+		return errors.New("line out of range")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err := r.window(y); err != nil {
+		return err
+	}
+	nodata := r.src.NoData()
+	center := r.rows[r.kernel.radius()]
+	for x := range line {
+		if x >= r.width {
+			break
+		}
+		if isNoData(center[x], nodata) {
+			line[x] = center[x]
+			continue
+		}
+		line[x] = r.kernel.apply(r.rows, x, nodata)
+	}
+	return nil
+}
+
+func (r *FilteredRaster) Srs() geo.Proj {
+	return r.src.Srs()
+}
+
+func (r *FilteredRaster) Bounds() vec2d.Rect {
+	return r.src.Bounds()
+}
+
+func (r *FilteredRaster) NoData() *float64 {
+	return r.src.NoData()
+}
+
+func (r *FilteredRaster) GeoTransform() [6]float64 {
+	return r.src.GeoTransform()
+}
+
+func (r *FilteredRaster) Range() [2]float64 {
+	if r.rng != nil {
+		return *r.rng
+	}
+	min, max := math.MaxFloat64, -math.MaxFloat64
+	line := make([]float64, r.width)
+	for y := 0; y < r.height; y++ {
+		if err := r.FetchLine(y, line); err != nil {
+			return [2]float64{}
+		}
+		for _, d := range line {
+			if isNoData(d, r.src.NoData()) {
+				continue
+			}
+			min, max = math.Min(min, d), math.Max(max, d)
+		}
+	}
+	r.rng = &[2]float64{min, max}
+	return *r.rng
+}
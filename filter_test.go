@@ -0,0 +1,94 @@
+package contour
+
+import (
+	"math"
+	"testing"
+)
+
+// 测试均值、中值、高斯和双边滤波以及无效值处理
+func TestFilteredRaster(t *testing.T) {
+	nodata := -1.0
+	data := []float64{
+		1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1,
+		1, 1, 10, 1, 1,
+		1, 1, 1, -1, 1,
+		1, 1, 1, 1, 1,
+	}
+	src := NewMemoryRaster(data, 5, 5, [6]float64{0, 1, 0, 5, 0, -1}, nil, &nodata)
+
+	mean := NewMeanFilterRaster(src, 3)
+	if v := mean.Elevation(1, 1); math.Abs(v-2) > 1e-9 {
+		t.Errorf("mean: expected 2, got %f", v)
+	}
+	// 右下邻域有一个无效值，只平均其余 8 个像元
+	if v := mean.Elevation(2, 2); math.Abs(v-17.0/8) > 1e-9 {
+		t.Errorf("mean: expected %f, got %f", 17.0/8, v)
+	}
+	if v := mean.Elevation(0, 0); v != 1 {
+		t.Errorf("mean: expected 1 at corner, got %f", v)
+	}
+	if v := mean.Elevation(3, 3); v != -1 {
+		t.Errorf("mean: expected nodata to be kept, got %f", v)
+	}
+
+	median := NewMedianFilterRaster(src, 3)
+	line := make([]float64, 5)
+	if err := median.FetchLine(2, line); err != nil {
+		t.Fatal(err)
+	}
+	for x, v := range line {
+		if v != 1 {
+			t.Errorf("median: pixel %d expected 1, got %f", x, v)
+		}
+	}
+
+	gauss := NewGaussianFilterRaster(src, 1)
+	if v := gauss.Elevation(2, 2); v >= 10 || v <= 1 {
+		t.Errorf("gaussian: expected smoothed peak, got %f", v)
+	}
+	if gauss.Elevation(2, 2) <= gauss.Elevation(1, 2) {
+		t.Error("gaussian: expected peak to remain highest")
+	}
+
+	bilateral := NewBilateralFilterRaster(src, 1, 0.5)
+	if v := bilateral.Elevation(2, 2); math.Abs(v-10) > 1e-6 {
+		t.Errorf("bilateral: expected step to be kept, got %f", v)
+	}
+	if v := bilateral.Elevation(1, 2); math.Abs(v-1) > 1e-6 {
+		t.Errorf("bilateral: expected flat area to be kept, got %f", v)
+	}
+
+	// 链式组合滤波器
+	chained := NewMeanFilterRaster(NewMedianFilterRaster(src, 3), 3)
+	if rng := chained.Range(); rng[0] != 1 || rng[1] != 1 {
+		t.Errorf("unexpected chained range %v", rng)
+	}
+}
+
+// 测试流式读取时行缓冲保持有界
+func TestFilteredRasterStreaming(t *testing.T) {
+	cone := newConeRaster(64, nil)
+	r := NewGaussianFilterRaster(cone, 2)
+	w, h := r.Size()
+	line := make([]float64, w)
+	for y := 0; y < h; y++ {
+		if err := r.FetchLine(y, line); err != nil {
+			t.Fatal(err)
+		}
+		if r.cache.lines.len() > 2*r.kernel.radius()+2 {
+			t.Fatalf("line cache holds %d lines", r.cache.lines.len())
+		}
+		if line[w/2] != r.Elevation(w/2, y) {
+			t.Fatalf("line %d differs from elevation", y)
+		}
+	}
+
+	writer := NewMockGeometryWriter()
+	if err := ContourGenerate(r, writer, ContourGenerateOptions{Base: 0, Interval: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.writtenGeom) == 0 {
+		t.Error("expected contours from filtered raster")
+	}
+}
@@ -8,16 +8,24 @@ type ContourGenerateOptions struct {
 	ExpBase     float64
 	FixedLevels []float64
 	Polygonize  bool
+	// Statistics keeps the value range of rasters whose Range reports
+	// nodata, so it is scanned once. Without it the range is scanned once per
+	// call.
+	Statistics *StatisticsCache
 }
 
 func ContourGenerate(r Raster, wf GeometryWriter, options ContourGenerateOptions) error {
 	nodata := r.NoData()
 	w, h := r.Size()
+	var rng [2]float64
+	if options.Polygonize || len(options.FixedLevels) > 0 {
+		rng = rasterRange(r, options.Statistics)
+	}
 	if options.Polygonize {
-		wr := &GeomPolygonContourWriter{polyWriter: wf, geoTransform: r.GeoTransform(), srs: r.Srs(), previousLevel: r.Range()[0]}
+		wr := &GeomPolygonContourWriter{polyWriter: wf, geoTransform: r.GeoTransform(), coords: rasterNodeCoordinates(r), srs: r.Srs(), previousLevel: rng[0]}
 		appender := newPolygonRingWriter(wr)
 		if len(options.FixedLevels) > 0 {
-			levels := newFixedLevelRangeIterator(options.FixedLevels, r.Range()[1])
+			levels := newFixedLevelRangeIterator(options.FixedLevels, rng[1])
 			writer := &SegmentMerger{lineWriter: appender, levelGenerator: levels, polygonize: true, lines: make(map[int]*list.List)}
 			cg := newContourGenerator(w, h, nodata, writer, levels, false)
 			cg.Process(r)
@@ -39,9 +47,9 @@ func ContourGenerate(r Raster, wf GeometryWriter, options ContourGenerateOptions
 			appender.Flush()
 		}
 	} else {
-		appender := &GeomLineStringContourWriter{lsWriter: wf, geoTransform: r.GeoTransform(), srs: r.Srs()}
+		appender := &GeomLineStringContourWriter{lsWriter: wf, geoTransform: r.GeoTransform(), coords: rasterNodeCoordinates(r), srs: r.Srs()}
 		if len(options.FixedLevels) > 0 {
-			levels := newFixedLevelRangeIterator(options.FixedLevels, r.Range()[1])
+			levels := newFixedLevelRangeIterator(options.FixedLevels, rng[1])
 			writer := &SegmentMerger{lineWriter: appender, levelGenerator: levels, polygonize: false, lines: make(map[int]*list.List)}
 			cg := newContourGenerator(w, h, nodata, writer, levels, false)
 			cg.Process(r)
@@ -62,3 +70,13 @@ func ContourGenerate(r Raster, wf GeometryWriter, options ContourGenerateOptions
 	}
 	return nil
 }
+
+func contourLevelGenerator(options ContourGenerateOptions, max float64) LevelGenerator {
+	if len(options.FixedLevels) > 0 {
+		return newFixedLevelRangeIterator(options.FixedLevels, max)
+	}
+	if options.ExpBase > 0.0 {
+		return newExponentialLevelRangeIterator(options.ExpBase)
+	}
+	return newIntervalLevelRangeIterator(options.Base, options.Interval)
+}
@@ -10,6 +10,7 @@ type GeomPolygonContourWriter struct {
 	poly3d          bool
 	srs             geo.Proj
 	geoTransform    [6]float64
+	coords          *NodeCoordinates
 	currentGeometry [][][][]float64
 	currentPart     [][][]float64
 	currentLevel    float64
@@ -27,8 +28,7 @@ func (w *GeomPolygonContourWriter) AddInteriorRing(ring LineString) {
 	newRing := make([][]float64, len(ring))
 
 	for ip, p := range ring {
-		dfX := w.geoTransform[0] + w.geoTransform[1]*p[0] + w.geoTransform[2]*p[1]
-		dfY := w.geoTransform[3] + w.geoTransform[4]*p[0] + w.geoTransform[5]*p[1]
+		dfX, dfY := pixelToGeo(w.geoTransform, w.coords, p)
 
 		newRing[ip] = []float64{dfX, dfY, w.currentLevel}
 	}
@@ -44,8 +44,7 @@ func (w *GeomPolygonContourWriter) AddPart(part LineString) {
 	newRing := make([][]float64, len(part))
 
 	for ip, p := range part {
-		dfX := w.geoTransform[0] + w.geoTransform[1]*p[0] + w.geoTransform[2]*p[1]
-		dfY := w.geoTransform[3] + w.geoTransform[4]*p[0] + w.geoTransform[5]*p[1]
+		dfX, dfY := pixelToGeo(w.geoTransform, w.coords, p)
 
 		newRing[ip] = []float64{dfX, dfY, w.currentLevel}
 	}
@@ -77,6 +76,7 @@ type GeomLineStringContourWriter struct {
 	ls3d         bool
 	srs          geo.Proj
 	geoTransform [6]float64
+	coords       *NodeCoordinates
 	lsWriter     GeometryWriter
 }
 
@@ -84,8 +84,7 @@ func (w *GeomLineStringContourWriter) AddLine(level float64, ls LineString, clos
 	newRing := make([][]float64, len(ls))
 
 	for ip, p := range ls {
-		dfX := w.geoTransform[0] + w.geoTransform[1]*p[0] + w.geoTransform[2]*p[1]
-		dfY := w.geoTransform[3] + w.geoTransform[4]*p[0] + w.geoTransform[5]*p[1]
+		dfX, dfY := pixelToGeo(w.geoTransform, w.coords, p)
 
 		newRing[ip] = []float64{dfX, dfY, level}
 	}
@@ -2,51 +2,79 @@ package contour
 
 import (
 	"errors"
-	"image"
 	"math"
 
-	"github.com/flywave/go-cog"
 	"github.com/flywave/go-geo"
 
 	vec2d "github.com/flywave/go3d/float64/vec2"
 )
 
 type GeoTiffRaster struct {
-	reader  *cog.Reader
-	rawData []float64
-	rect    image.Rectangle
+	reader *geoTiffReader
+	band   int
+	scale  float64
+	offset float64
+	nodata *float64
+	rng    *[2]float64
 }
 
 func NewGeoTiffRaster(fileName string) *GeoTiffRaster {
-	r := &GeoTiffRaster{reader: cog.Read(fileName)}
-	if r.reader != nil {
-		if len(r.reader.Data) == 0 {
-			return nil
-		}
-		r.rect = r.reader.Rects[0]
-		return r
+	return NewGeoTiffRasterBand(fileName, 0)
+}
+
+// band is zero based, matching the sample index of the GDAL metadata.
+func NewGeoTiffRasterBand(fileName string, band int) *GeoTiffRaster {
+	reader, err := openGeoTiffReader(fileName)
+	if err != nil {
+		return nil
 	}
-	return nil
+	if band < 0 || band >= reader.samples {
+		reader.Close()
+		return nil
+	}
+	r := &GeoTiffRaster{reader: reader, band: band}
+	r.scale, r.offset = reader.scaleOffset(band)
+	if nodata := reader.noData(); nodata != nil {
+		v := r.scaleValue(*nodata)
+		r.nodata = &v
+	}
+	return r
 }
 
-func (r *GeoTiffRaster) convertFloat64() []float64 {
-	switch d := r.reader.Data[0].(type) {
-	case []float64:
-		return d
-	case []float32:
-		res := []float64{}
-		for _, e := range d {
-			res = append(res, float64(e))
-		}
-		return res
+func (r *GeoTiffRaster) Close() error {
+	if r.reader == nil {
+		return nil
+	}
+	err := r.reader.Close()
+	r.reader = nil
+	return err
+}
+
+func (r *GeoTiffRaster) Band() int {
+	return r.band
+}
+
+func (r *GeoTiffRaster) ScaleOffset() (float64, float64) {
+	return r.scale, r.offset
+}
+
+func (r *GeoTiffRaster) scaleValue(v float64) float64 {
+	if r.scale == 1 && r.offset == 0 {
+		return v
+	}
+	return v*r.scale + r.offset
+}
+
+// SetCacheRows sets how many rows of strips or tiles are kept decoded in memory.
+func (r *GeoTiffRaster) SetCacheRows(rows int) {
+	if r.reader != nil {
+		r.reader.setCacheRows(rows)
 	}
-	return nil
 }
 
 func (r *GeoTiffRaster) Size() (w, h int) {
 	if r.reader != nil {
-		si := r.reader.GetSize(0)
-		return int(si[0]), int(si[1])
+		return r.reader.width, r.reader.height
 	}
 	return 0, 0
 }
@@ -55,26 +83,34 @@ func (r *GeoTiffRaster) Elevation(x, y int) float64 {
 	if r.reader == nil {
 		return math.NaN()
 	}
-	if r.rawData == nil {
-		r.rawData = r.convertFloat64()
+	v, err := r.reader.value(r.band, x, y)
+	if err != nil {
+		return math.NaN()
 	}
-	return r.rawData[y*r.rect.Dx()+x]
+	return r.scaleValue(v)
 }
 
 func (r *GeoTiffRaster) FetchLine(y int, line []float64) error {
 	if r.reader == nil {
 		return errors.New("not open")
 	}
-	if r.rawData == nil {
-		r.rawData = r.convertFloat64()
+	if err := r.reader.readLine(r.band, y, line); err != nil {
+		return err
+	}
+	if r.scale != 1 || r.offset != 0 {
+		for i := range line {
+			line[i] = r.scaleValue(line[i])
+		}
 	}
-	copy(line, r.rawData[y*r.rect.Dx():(y+1)*r.rect.Dx()])
 	return nil
 }
 
 func (r *GeoTiffRaster) Srs() geo.Proj {
-	code, err := r.reader.GetEPSGCode(0)
-	if err != nil {
+	if r.reader == nil {
+		return nil
+	}
+	code := r.reader.epsgCode()
+	if code == 0 {
 		return nil
 	}
 	return geo.NewProj(code)
@@ -82,35 +118,49 @@ func (r *GeoTiffRaster) Srs() geo.Proj {
 
 func (r *GeoTiffRaster) Bounds() vec2d.Rect {
 	if r.reader != nil {
-		return r.reader.GetBounds(0)
+		return geoTransformBounds(r.GeoTransform(), r.reader.width, r.reader.height)
 	}
 	return vec2d.Rect{}
 }
 
 func (r *GeoTiffRaster) NoData() *float64 {
-	if r.reader != nil {
-		return r.reader.GetNoData(0)
-	}
-	return nil
+	return r.nodata
 }
 
 func (r *GeoTiffRaster) GeoTransform() [6]float64 {
 	if r.reader != nil {
-		return r.reader.GetGeoTransform(0)
+		return r.reader.geoTransform()
 	}
 	return [6]float64{0., 1., 0., 0., 0., 1.}
 }
 
 func (r *GeoTiffRaster) Range() [2]float64 {
+	if r.rng != nil {
+		return *r.rng
+	}
 	if r.reader == nil {
 		return [2]float64{}
 	}
-	if r.rawData == nil {
-		r.rawData = r.reader.Data[0].([]float64)
+	smin, okMin := r.reader.metadataItem("STATISTICS_MINIMUM", r.band)
+	smax, okMax := r.reader.metadataItem("STATISTICS_MAXIMUM", r.band)
+	if okMin && okMax {
+		r.rng = &[2]float64{r.scaleValue(smin), r.scaleValue(smax)}
+		return *r.rng
 	}
+
 	min, max := math.MaxFloat64, -math.MaxFloat64
-	for _, d := range r.rawData {
-		min, max = math.Min(min, d), math.Max(max, d)
+	line := make([]float64, r.reader.width)
+	for y := 0; y < r.reader.height; y++ {
+		if err := r.FetchLine(y, line); err != nil {
+			return [2]float64{}
+		}
+		for _, d := range line {
+			if isNoData(d, r.nodata) {
+				continue
+			}
+			min, max = math.Min(min, d), math.Max(max, d)
+		}
 	}
-	return [2]float64{min, max}
+	r.rng = &[2]float64{min, max}
+	return *r.rng
 }
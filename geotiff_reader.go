@@ -0,0 +1,571 @@
+package contour
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/tiff"
+	_ "github.com/google/tiff/bigtiff"
+	"github.com/hhrutter/lzw"
+)
+
+const (
+	tiffCompressionNone       = 1
+	tiffCompressionLZW        = 5
+	tiffCompressionDeflate    = 8
+	tiffCompressionPackBits   = 32773
+	tiffCompressionDeflateOld = 32946
+
+	tiffPredictorNone          = 1
+	tiffPredictorHorizontal    = 2
+	tiffPredictorFloatingPoint = 3
+
+	tiffSampleFormatUint  = 1
+	tiffSampleFormatInt   = 2
+	tiffSampleFormatFloat = 3
+
+	tiffPlanarContig   = 1
+	tiffPlanarSeparate = 2
+
+	geoKeyRasterType      = 1025
+	geoKeyGeographicType  = 2048
+	geoKeyProjectedCSType = 3072
+	geoKeyUserDefined     = 32767
+
+	geoRasterPixelIsPoint = 2
+
+	tiffSubfileReduced = 1
+	tiffSubfileMask    = 4
+
+	defaultBlockCacheRows = 2
+)
+
+type geoTiffIFD struct {
+	NewSubfileType      uint32    `tiff:"field,tag=254"`
+	ImageWidth          uint64    `tiff:"field,tag=256"`
+	ImageLength         uint64    `tiff:"field,tag=257"`
+	BitsPerSample       []uint16  `tiff:"field,tag=258"`
+	Compression         uint16    `tiff:"field,tag=259"`
+	StripOffsets        []uint64  `tiff:"field,tag=273"`
+	SamplesPerPixel     uint16    `tiff:"field,tag=277"`
+	RowsPerStrip        uint64    `tiff:"field,tag=278"`
+	StripByteCounts     []uint64  `tiff:"field,tag=279"`
+	PlanarConfiguration uint16    `tiff:"field,tag=284"`
+	Predictor           uint16    `tiff:"field,tag=317"`
+	TileWidth           uint64    `tiff:"field,tag=322"`
+	TileLength          uint64    `tiff:"field,tag=323"`
+	TileOffsets         []uint64  `tiff:"field,tag=324"`
+	TileByteCounts      []uint64  `tiff:"field,tag=325"`
+	SampleFormat        []uint16  `tiff:"field,tag=339"`
+	ModelPixelScale     []float64 `tiff:"field,tag=33550"`
+	ModelTiePoint       []float64 `tiff:"field,tag=33922"`
+	ModelTransformation []float64 `tiff:"field,tag=34264"`
+	GeoKeyDirectory     []uint16  `tiff:"field,tag=34735"`
+	GDALMetadata        string    `tiff:"field,tag=42112"`
+	GDALNoData          string    `tiff:"field,tag=42113"`
+}
+
+type gdalMetadataItem struct {
+	Name   string `xml:"name,attr"`
+	Sample string `xml:"sample,attr"`
+	Role   string `xml:"role,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type gdalMetadata struct {
+	Items []gdalMetadataItem `xml:"Item"`
+}
+
+type geoTiffBlock struct {
+	buf   []byte
+	order binary.ByteOrder
+}
+
+type geoTiffReader struct {
+	file     *os.File
+	order    binary.ByteOrder
+	ifd      *geoTiffIFD
+	metadata *gdalMetadata
+
+	width         int
+	height        int
+	samples       int
+	bitsPerSample int
+	sampleFormat  uint16
+
+	blockWidth   int
+	blockHeight  int
+	blocksAcross int
+	blocksDown   int
+	offsets      []uint64
+	byteCounts   []uint64
+
+	cache *lruCache[int, *geoTiffBlock]
+	lock  sync.Mutex
+}
+
+func openGeoTiffReader(fileName string) (*geoTiffReader, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newGeoTiffReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func newGeoTiffReader(f *os.File) (*geoTiffReader, error) {
+	t, err := tiff.Parse(f, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	tifds := t.IFDs()
+	if len(tifds) == 0 {
+		return nil, errors.New("tiff has no image directory")
+	}
+	// overviews and masks may come first, the image is the first directory
+	// that is neither
+	var ifd *geoTiffIFD
+	for _, d := range tifds {
+		candidate := &geoTiffIFD{}
+		if err := tiff.UnmarshalIFD(d, candidate); err != nil {
+			return nil, err
+		}
+		if candidate.NewSubfileType&(tiffSubfileReduced|tiffSubfileMask) == 0 {
+			ifd = candidate
+			break
+		}
+	}
+	if ifd == nil {
+		return nil, errors.New("tiff has no full resolution image")
+	}
+
+	r := &geoTiffReader{file: f, order: t.R().ByteOrder(), ifd: ifd}
+	r.width, r.height = int(ifd.ImageWidth), int(ifd.ImageLength)
+	r.samples = int(ifd.SamplesPerPixel)
+	if r.samples == 0 {
+		r.samples = 1
+	}
+	if len(ifd.BitsPerSample) == 0 {
+		return nil, errors.New("tiff has no bits per sample")
+	}
+	r.bitsPerSample = int(ifd.BitsPerSample[0])
+	r.sampleFormat = tiffSampleFormatUint
+	if len(ifd.SampleFormat) > 0 {
+		r.sampleFormat = ifd.SampleFormat[0]
+	}
+	if err := checkSampleType(r.bitsPerSample, r.sampleFormat); err != nil {
+		return nil, err
+	}
+
+	if ifd.TileWidth != 0 && ifd.TileLength != 0 {
+		r.blockWidth, r.blockHeight = int(ifd.TileWidth), int(ifd.TileLength)
+		r.offsets, r.byteCounts = ifd.TileOffsets, ifd.TileByteCounts
+	} else {
+		r.blockWidth, r.blockHeight = r.width, int(ifd.RowsPerStrip)
+		if r.blockHeight == 0 || r.blockHeight > r.height {
+			r.blockHeight = r.height
+		}
+		r.offsets, r.byteCounts = ifd.StripOffsets, ifd.StripByteCounts
+	}
+	r.blocksAcross = (r.width + r.blockWidth - 1) / r.blockWidth
+	r.blocksDown = (r.height + r.blockHeight - 1) / r.blockHeight
+
+	planes := 1
+	if r.planar() {
+		planes = r.samples
+	}
+	if len(r.offsets) < r.blocksAcross*r.blocksDown*planes || len(r.byteCounts) < len(r.offsets) {
+		return nil, errors.New("tiff block offsets are incomplete")
+	}
+
+	r.setCacheRows(defaultBlockCacheRows)
+
+	if ifd.GDALMetadata != "" {
+		meta := &gdalMetadata{}
+		if err := xml.Unmarshal([]byte(strings.Trim(ifd.GDALMetadata, "\x00")), meta); err == nil {
+			r.metadata = meta
+		}
+	}
+	return r, nil
+}
+
+func checkSampleType(bits int, format uint16) error {
+	switch format {
+	case tiffSampleFormatUint, tiffSampleFormatInt:
+		if bits == 8 || bits == 16 || bits == 32 {
+			return nil
+		}
+	case tiffSampleFormatFloat:
+		if bits == 32 || bits == 64 {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported sample type: %d bits, format %d", bits, format)
+}
+
+func (r *geoTiffReader) Close() error {
+	return r.file.Close()
+}
+
+// setCacheRows bounds the decoded block cache to the given number of block rows.
+func (r *geoTiffReader) setCacheRows(rows int) {
+	if rows < 1 {
+		rows = 1
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	capacity := rows * r.blocksAcross
+	if r.planar() {
+		capacity *= r.samples
+	}
+	r.cache = newLRUCache[int, *geoTiffBlock](capacity)
+}
+
+func (r *geoTiffReader) planar() bool {
+	return r.ifd.PlanarConfiguration == tiffPlanarSeparate && r.samples > 1
+}
+
+func (r *geoTiffReader) bytesPerSample() int {
+	return r.bitsPerSample / 8
+}
+
+func (r *geoTiffReader) blockSamples() int {
+	if r.planar() {
+		return 1
+	}
+	return r.samples
+}
+
+func (r *geoTiffReader) blockRowBytes() int {
+	return r.blockWidth * r.blockSamples() * r.bytesPerSample()
+}
+
+func (r *geoTiffReader) readBlock(band, bx, by int) ([]byte, binary.ByteOrder, error) {
+	idx := by*r.blocksAcross + bx
+	if r.planar() {
+		idx += band * r.blocksAcross * r.blocksDown
+	}
+	offset, n := int64(r.offsets[idx]), int64(r.byteCounts[idx])
+	src := io.NewSectionReader(r.file, offset, n)
+
+	var buf []byte
+	var err error
+	switch r.ifd.Compression {
+	case 0, tiffCompressionNone:
+		buf = make([]byte, n)
+		_, err = io.ReadFull(src, buf)
+	case tiffCompressionLZW:
+		lr := lzw.NewReader(src, true)
+		buf, err = io.ReadAll(lr)
+		lr.Close()
+	case tiffCompressionDeflate, tiffCompressionDeflateOld:
+		var zr io.ReadCloser
+		zr, err = zlib.NewReader(src)
+		if err == nil {
+			buf, err = io.ReadAll(zr)
+			zr.Close()
+		}
+	case tiffCompressionPackBits:
+		buf, err = unpackBits(src)
+	default:
+		err = fmt.Errorf("unsupported compression value %d", r.ifd.Compression)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows := r.blockHeight
+	if r.ifd.TileWidth == 0 && (by+1)*r.blockHeight > r.height {
+		rows = r.height - by*r.blockHeight
+	}
+	if len(buf) < rows*r.blockRowBytes() {
+		return nil, nil, errors.New("tiff block is truncated")
+	}
+
+	order := r.order
+	switch r.ifd.Predictor {
+	case 0, tiffPredictorNone:
+	case tiffPredictorHorizontal:
+		for y := 0; y < rows; y++ {
+			row := buf[y*r.blockRowBytes() : (y+1)*r.blockRowBytes()]
+			horizontalAccumulate(row, r.blockSamples(), r.bytesPerSample(), order)
+		}
+	case tiffPredictorFloatingPoint:
+		tmp := make([]byte, r.blockRowBytes())
+		for y := 0; y < rows; y++ {
+			row := buf[y*r.blockRowBytes() : (y+1)*r.blockRowBytes()]
+			floatingPointAccumulate(row, tmp, r.blockSamples(), r.bytesPerSample())
+		}
+		order = binary.LittleEndian
+	default:
+		return nil, nil, fmt.Errorf("unsupported predictor %d", r.ifd.Predictor)
+	}
+	return buf, order, nil
+}
+
+func (r *geoTiffReader) decodeBlockRow(buf []byte, order binary.ByteOrder, band, row int, line []float64) {
+	bps := r.bytesPerSample()
+	step := r.blockSamples() * bps
+	off := row * r.blockRowBytes()
+	if !r.planar() {
+		off += band * bps
+	}
+	for i := range line {
+		line[i] = sampleValue(buf[off:off+bps], order, r.bitsPerSample, r.sampleFormat)
+		off += step
+	}
+}
+
+func (r *geoTiffReader) block(band, bx, by int) (*geoTiffBlock, error) {
+	key := by*r.blocksAcross + bx
+	if r.planar() {
+		key += band * r.blocksAcross * r.blocksDown
+	}
+	if b, ok := r.cache.get(key); ok {
+		return b, nil
+	}
+	buf, order, err := r.readBlock(band, bx, by)
+	if err != nil {
+		return nil, err
+	}
+	b := &geoTiffBlock{buf: buf, order: order}
+	r.cache.put(key, b)
+	return b, nil
+}
+
+func (r *geoTiffReader) readLine(band, y int, line []float64) error {
+	if band < 0 || band >= r.samples {
+		return fmt.Errorf("band %d out of range", band)
+	}
+	if y < 0 || y >= r.height {
+		return fmt.Errorf("line %d out of range", y)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	by, row := y/r.blockHeight, y%r.blockHeight
+	blockLine := make([]float64, r.blockWidth)
+	for bx := 0; bx < r.blocksAcross; bx++ {
+		b, err := r.block(band, bx, by)
+		if err != nil {
+			return err
+		}
+		x0 := bx * r.blockWidth
+		w := minInt(minInt(r.blockWidth, r.width-x0), len(line)-x0)
+		if w <= 0 {
+			break
+		}
+		r.decodeBlockRow(b.buf, b.order, band, row, blockLine)
+		copy(line[x0:x0+w], blockLine[:w])
+	}
+	return nil
+}
+
+func (r *geoTiffReader) value(band, x, y int) (float64, error) {
+	if x < 0 || y < 0 || x >= r.width || y >= r.height {
+		return math.NaN(), fmt.Errorf("pixel %d,%d out of range", x, y)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	b, err := r.block(band, x/r.blockWidth, y/r.blockHeight)
+	if err != nil {
+		return math.NaN(), err
+	}
+	bps := r.bytesPerSample()
+	off := (y%r.blockHeight)*r.blockRowBytes() + (x%r.blockWidth)*r.blockSamples()*bps
+	if !r.planar() {
+		off += band * bps
+	}
+	return sampleValue(b.buf[off:off+bps], b.order, r.bitsPerSample, r.sampleFormat), nil
+}
+
+// geoTransform follows GDAL in moving the origin of PixelIsPoint rasters from
+// the center to the corner of the first pixel.
+func (r *geoTiffReader) geoTransform() [6]float64 {
+	ifd := r.ifd
+	gt := [6]float64{0., 1., 0., 0., 0., 1.}
+	switch {
+	case len(ifd.ModelPixelScale) >= 2 && ifd.ModelPixelScale[0] != 0 && ifd.ModelPixelScale[1] != 0:
+		gt = [6]float64{0, ifd.ModelPixelScale[0], 0, 0, 0, -ifd.ModelPixelScale[1]}
+		if len(ifd.ModelTiePoint) >= 6 {
+			gt[0] = ifd.ModelTiePoint[3] - ifd.ModelTiePoint[0]*gt[1]
+			gt[3] = ifd.ModelTiePoint[4] - ifd.ModelTiePoint[1]*gt[5]
+		}
+	case len(ifd.ModelTransformation) == 16:
+		m := ifd.ModelTransformation
+		gt = [6]float64{m[3], m[0], m[1], m[7], m[4], m[5]}
+	default:
+		return gt
+	}
+	if v, ok := r.geoKey(geoKeyRasterType); ok && v == geoRasterPixelIsPoint {
+		gt[0] -= (gt[1] + gt[2]) / 2
+		gt[3] -= (gt[4] + gt[5]) / 2
+	}
+	return gt
+}
+
+// geoKey returns a short value stored directly in the geokey directory.
+func (r *geoTiffReader) geoKey(key uint16) (uint16, bool) {
+	d := r.ifd.GeoKeyDirectory
+	for i := 4; i+3 < len(d); i += 4 {
+		if d[i] == key && d[i+1] == 0 {
+			return d[i+3], true
+		}
+	}
+	return 0, false
+}
+
+func (r *geoTiffReader) epsgCode() int {
+	for _, key := range []uint16{geoKeyProjectedCSType, geoKeyGeographicType} {
+		if code, ok := r.geoKey(key); ok && code != geoKeyUserDefined {
+			return int(code)
+		}
+	}
+	return 0
+}
+
+func (r *geoTiffReader) noData() *float64 {
+	s := strings.Trim(r.ifd.GDALNoData, "\x00 ")
+	if s == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+func (r *geoTiffReader) metadataItem(name string, band int) (float64, bool) {
+	if r.metadata == nil {
+		return 0, false
+	}
+	for _, item := range r.metadata.Items {
+		if !strings.EqualFold(item.Name, name) && !strings.EqualFold(item.Role, name) {
+			continue
+		}
+		if item.Sample != "" && item.Sample != strconv.Itoa(band) {
+			continue
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(item.Value), 64)
+		if err != nil {
+			return 0, false
+		}
+		return f, true
+	}
+	return 0, false
+}
+
+func (r *geoTiffReader) scaleOffset(band int) (float64, float64) {
+	scale, ok := r.metadataItem("scale", band)
+	if !ok || scale == 0 {
+		scale = 1
+	}
+	offset, _ := r.metadataItem("offset", band)
+	return scale, offset
+}
+
+func sampleValue(b []byte, order binary.ByteOrder, bits int, format uint16) float64 {
+	switch format {
+	case tiffSampleFormatInt:
+		switch bits {
+		case 8:
+			return float64(int8(b[0]))
+		case 16:
+			return float64(int16(order.Uint16(b)))
+		case 32:
+			return float64(int32(order.Uint32(b)))
+		}
+	case tiffSampleFormatFloat:
+		switch bits {
+		case 32:
+			return float64(math.Float32frombits(order.Uint32(b)))
+		case 64:
+			return math.Float64frombits(order.Uint64(b))
+		}
+	default:
+		switch bits {
+		case 8:
+			return float64(b[0])
+		case 16:
+			return float64(order.Uint16(b))
+		case 32:
+			return float64(order.Uint32(b))
+		}
+	}
+	return math.NaN()
+}
+
+func horizontalAccumulate(row []byte, samples, size int, order binary.ByteOrder) {
+	stride := samples * size
+	for i := stride; i+size <= len(row); i += size {
+		prev, cur := row[i-stride:i-stride+size], row[i:i+size]
+		switch size {
+		case 1:
+			cur[0] += prev[0]
+		case 2:
+			order.PutUint16(cur, order.Uint16(cur)+order.Uint16(prev))
+		case 4:
+			order.PutUint32(cur, order.Uint32(cur)+order.Uint32(prev))
+		case 8:
+			order.PutUint64(cur, order.Uint64(cur)+order.Uint64(prev))
+		}
+	}
+}
+
+func floatingPointAccumulate(row, tmp []byte, samples, size int) {
+	for i := samples; i < len(row); i++ {
+		row[i] += row[i-samples]
+	}
+	copy(tmp, row)
+	wc := len(row) / size
+	for i := 0; i < wc; i++ {
+		for b := 0; b < size; b++ {
+			row[size*i+b] = tmp[(size-b-1)*wc+i]
+		}
+	}
+}
+
+func unpackBits(r io.Reader) ([]byte, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var dst bytes.Buffer
+	for i := 0; i < len(src); {
+		n := int(int8(src[i]))
+		i++
+		switch {
+		case n >= 0:
+			if i+n+1 > len(src) {
+				return nil, errors.New("packbits run is truncated")
+			}
+			dst.Write(src[i : i+n+1])
+			i += n + 1
+		case n != -128:
+			if i >= len(src) {
+				return nil, errors.New("packbits run is truncated")
+			}
+			for j := 0; j < 1-n; j++ {
+				dst.WriteByte(src[i])
+			}
+			i++
+		}
+	}
+	return dst.Bytes(), nil
+}
@@ -0,0 +1,522 @@
+package contour
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flywave/go-cog"
+	"github.com/hhrutter/lzw"
+)
+
+type testTiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+type testTiffOptions struct {
+	metadata     string
+	nodata       string
+	compression  uint16
+	predictor    uint16
+	rowsPerStrip int
+	pixelIsPoint bool
+	// subfileType adds a half size directory of that NewSubfileType in front
+	// of the image, sharing its strips.
+	subfileType uint32
+}
+
+// 生成每行一个条带、未压缩的测试 GeoTIFF
+func writeTestTiff(t *testing.T, width, height, bits int, format uint16, bands [][]float64, metadata, nodata string) string {
+	t.Helper()
+	return writeTestTiffOptions(t, width, height, bits, format, bands, testTiffOptions{metadata: metadata, nodata: nodata})
+}
+
+// encodeTestStrip 对条带做预测编码并压缩
+func encodeTestStrip(t *testing.T, strip []byte, rowBytes, samples, size int, opts testTiffOptions) []byte {
+	t.Helper()
+	bo := binary.LittleEndian
+	for off := 0; off < len(strip); off += rowBytes {
+		row := strip[off : off+rowBytes]
+		switch opts.predictor {
+		case tiffPredictorHorizontal:
+			stride := samples * size
+			for i := len(row) - size; i >= stride; i -= size {
+				cur, prev := row[i:i+size], row[i-stride:i-stride+size]
+				switch size {
+				case 1:
+					cur[0] -= prev[0]
+				case 2:
+					bo.PutUint16(cur, bo.Uint16(cur)-bo.Uint16(prev))
+				case 4:
+					bo.PutUint32(cur, bo.Uint32(cur)-bo.Uint32(prev))
+				case 8:
+					bo.PutUint64(cur, bo.Uint64(cur)-bo.Uint64(prev))
+				}
+			}
+		case tiffPredictorFloatingPoint:
+			wc := len(row) / size
+			tmp := make([]byte, len(row))
+			for i := 0; i < wc; i++ {
+				for p := 0; p < size; p++ {
+					tmp[p*wc+i] = row[size*i+size-1-p]
+				}
+			}
+			for i := len(tmp) - 1; i >= samples; i-- {
+				tmp[i] -= tmp[i-samples]
+			}
+			copy(row, tmp)
+		}
+	}
+
+	var out bytes.Buffer
+	switch opts.compression {
+	case tiffCompressionLZW:
+		w := lzw.NewWriter(&out, true)
+		w.Write(strip)
+		w.Close()
+	case tiffCompressionDeflate:
+		w := zlib.NewWriter(&out)
+		w.Write(strip)
+		w.Close()
+	case tiffCompressionPackBits:
+		for i := 0; i < len(strip); {
+			n := 1
+			for i+n < len(strip) && n < 128 && strip[i+n] == strip[i] {
+				n++
+			}
+			if n > 2 {
+				out.WriteByte(byte(int8(1 - n)))
+				out.WriteByte(strip[i])
+				i += n
+				continue
+			}
+			n = minInt(len(strip)-i, 128)
+			out.WriteByte(byte(n - 1))
+			out.Write(strip[i : i+n])
+			i += n
+		}
+	default:
+		out.Write(strip)
+	}
+	return out.Bytes()
+}
+
+func writeTestTiffOptions(t *testing.T, width, height, bits int, format uint16, bands [][]float64, opts testTiffOptions) string {
+	t.Helper()
+	bo := binary.LittleEndian
+	size := bits / 8
+	metadata, nodata := opts.metadata, opts.nodata
+	if opts.compression == 0 {
+		opts.compression = tiffCompressionNone
+	}
+	if opts.predictor == 0 {
+		opts.predictor = tiffPredictorNone
+	}
+	if opts.rowsPerStrip == 0 {
+		opts.rowsPerStrip = 1
+	}
+
+	pixels := make([]byte, width*height*len(bands)*size)
+	for i := 0; i < width*height; i++ {
+		for b := range bands {
+			v := bands[b][i]
+			p := pixels[(i*len(bands)+b)*size:]
+			switch {
+			case format == tiffSampleFormatFloat && bits == 32:
+				bo.PutUint32(p, math.Float32bits(float32(v)))
+			case format == tiffSampleFormatFloat && bits == 64:
+				bo.PutUint64(p, math.Float64bits(v))
+			case bits == 8:
+				p[0] = byte(int64(v))
+			case bits == 16:
+				bo.PutUint16(p, uint16(int64(v)))
+			case bits == 32:
+				bo.PutUint32(p, uint32(int64(v)))
+			}
+		}
+	}
+
+	short := func(v ...uint16) []byte {
+		b := make([]byte, 2*len(v))
+		for i := range v {
+			bo.PutUint16(b[2*i:], v[i])
+		}
+		return b
+	}
+	long := func(v uint32) []byte {
+		b := make([]byte, 4)
+		bo.PutUint32(b, v)
+		return b
+	}
+	double := func(v ...float64) []byte {
+		b := make([]byte, 8*len(v))
+		for i := range v {
+			bo.PutUint64(b[8*i:], math.Float64bits(v[i]))
+		}
+		return b
+	}
+	ascii := func(s string) []byte {
+		return append([]byte(s), 0)
+	}
+
+	bitsPerSample := make([]uint16, len(bands))
+	sampleFormat := make([]uint16, len(bands))
+	for i := range bands {
+		bitsPerSample[i], sampleFormat[i] = uint16(bits), format
+	}
+
+	rowBytes := width * len(bands) * size
+	strips := (height + opts.rowsPerStrip - 1) / opts.rowsPerStrip
+	var stripData [][]byte
+	stripCounts := make([]byte, 4*strips)
+	for i := 0; i < strips; i++ {
+		end := minInt((i+1)*opts.rowsPerStrip*rowBytes, len(pixels))
+		strip := append([]byte(nil), pixels[i*opts.rowsPerStrip*rowBytes:end]...)
+		stripData = append(stripData, encodeTestStrip(t, strip, rowBytes, len(bands), size, opts))
+		bo.PutUint32(stripCounts[4*i:], uint32(len(stripData[i])))
+	}
+
+	geoKeys := short(1, 1, 0, 1, 3072, 0, 1, 32650)
+	if opts.pixelIsPoint {
+		geoKeys = short(1, 1, 0, 2, 1025, 0, 1, 2, 3072, 0, 1, 32650)
+	}
+	entries := []testTiffEntry{
+		{256, 4, 1, long(uint32(width))},
+		{257, 4, 1, long(uint32(height))},
+		{258, 3, uint32(len(bands)), short(bitsPerSample...)},
+		{259, 3, 1, short(opts.compression)},
+		{262, 3, 1, short(1)},
+		{273, 4, uint32(strips), make([]byte, 4*strips)},
+		{277, 3, 1, short(uint16(len(bands)))},
+		{278, 4, 1, long(uint32(opts.rowsPerStrip))},
+		{279, 4, uint32(strips), stripCounts},
+		{284, 3, 1, short(1)},
+		{317, 3, 1, short(opts.predictor)},
+		{339, 3, uint32(len(bands)), short(sampleFormat...)},
+		{33550, 12, 3, double(10, 10, 0)},
+		{33922, 12, 6, double(0, 0, 0, 500000, 4000000, 0)},
+		{34735, 3, uint32(len(geoKeys) / 2), geoKeys},
+	}
+	if metadata != "" {
+		entries = append(entries, testTiffEntry{42112, 2, uint32(len(metadata) + 1), ascii(metadata)})
+	}
+	if nodata != "" {
+		entries = append(entries, testTiffEntry{42113, 2, uint32(len(nodata) + 1), ascii(nodata)})
+	}
+
+	for i := range entries {
+		if len(entries[i].data) > 4 {
+			entries[i].data = append(entries[i].data, make([]byte, len(entries[i].data)%2)...)
+		}
+	}
+	ifds := [][]testTiffEntry{entries}
+	if opts.subfileType != 0 {
+		reduced := append([]testTiffEntry{{254, 4, 1, long(opts.subfileType)}}, entries...)
+		reduced[1] = testTiffEntry{256, 4, 1, long(uint32(maxInt(width/2, 1)))}
+		reduced[2] = testTiffEntry{257, 4, 1, long(uint32(maxInt(height/2, 1)))}
+		ifds = [][]testTiffEntry{reduced, entries}
+	}
+
+	// every directory is followed by its values, the strips come last
+	starts := make([]int, len(ifds)+1)
+	starts[0] = 8
+	for k, ifd := range ifds {
+		starts[k+1] = starts[k] + 2 + len(ifd)*12 + 4
+		for _, e := range ifd {
+			if len(e.data) > 4 {
+				starts[k+1] += len(e.data)
+			}
+		}
+	}
+	for i, off := 0, starts[len(ifds)]; i < strips; i++ {
+		bo.PutUint32(entries[5].data[4*i:], uint32(off))
+		off += len(stripData[i])
+	}
+
+	var out bytes.Buffer
+	out.WriteString("II")
+	out.Write(short(42))
+	out.Write(long(8))
+	for k, ifd := range ifds {
+		var ext bytes.Buffer
+		off := starts[k] + 2 + len(ifd)*12 + 4
+		out.Write(short(uint16(len(ifd))))
+		for _, e := range ifd {
+			out.Write(short(e.tag, e.typ))
+			out.Write(long(e.count))
+			if len(e.data) <= 4 {
+				out.Write(append(e.data, make([]byte, 4-len(e.data))...))
+			} else {
+				out.Write(long(uint32(off)))
+				ext.Write(e.data)
+				off += len(e.data)
+			}
+		}
+		if k+1 < len(ifds) {
+			out.Write(long(uint32(starts[k+1])))
+		} else {
+			out.Write(long(0))
+		}
+		out.Write(ext.Bytes())
+	}
+	for _, strip := range stripData {
+		out.Write(strip)
+	}
+
+	file := filepath.Join(t.TempDir(), "test.tif")
+	if err := os.WriteFile(file, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// 测试与 go-cog 解码结果一致
+func TestGeoTiffRasterMatchesCog(t *testing.T) {
+	file := "./data/14_13565_6403.tif"
+	reader := cog.Read(file)
+	expected := reader.Data[0].([]float64)
+
+	r := NewGeoTiffRaster(file)
+	if r == nil {
+		t.Fatal("failed to open geotiff")
+	}
+	defer r.Close()
+
+	w, h := r.Size()
+	if w != int(reader.GetSize(0)[0]) || h != int(reader.GetSize(0)[1]) {
+		t.Fatalf("unexpected size %dx%d", w, h)
+	}
+	if r.GeoTransform() != [6]float64(reader.GetGeoTransform(0)) {
+		t.Errorf("unexpected geotransform %v", r.GeoTransform())
+	}
+
+	line := make([]float64, w)
+	for y := 0; y < h; y++ {
+		if err := r.FetchLine(y, line); err != nil {
+			t.Fatal(err)
+		}
+		for x := 0; x < w; x++ {
+			if line[x] != expected[y*w+x] {
+				t.Fatalf("pixel %d,%d: expected %f, got %f", x, y, expected[y*w+x], line[x])
+			}
+		}
+	}
+}
+
+// 测试整型采样、波段选择和 GDAL 缩放/偏移
+func TestGeoTiffRasterSampleTypes(t *testing.T) {
+	band0 := []float64{-5, 100, 2000, -32768, 7, 8}
+	band1 := []float64{1, 2, 3, 4, 5, 6}
+	metadata := `<GDALMetadata>
+  <Item name="SCALE" sample="1" role="scale">0.5</Item>
+  <Item name="OFFSET" sample="1" role="offset">10</Item>
+</GDALMetadata>`
+
+	file := writeTestTiff(t, 3, 2, 16, tiffSampleFormatInt, [][]float64{band0, band1}, metadata, "-32768")
+
+	r := NewGeoTiffRaster(file)
+	if r == nil {
+		t.Fatal("failed to open int16 geotiff")
+	}
+	defer r.Close()
+	if r.Elevation(0, 0) != -5 || r.Elevation(2, 0) != 2000 {
+		t.Errorf("unexpected int16 values %f %f", r.Elevation(0, 0), r.Elevation(2, 0))
+	}
+	if nd := r.NoData(); nd == nil || *nd != -32768 {
+		t.Errorf("unexpected nodata %v", nd)
+	}
+	if rng := r.Range(); rng[0] != -5 || rng[1] != 2000 {
+		t.Errorf("unexpected range %v", rng)
+	}
+	if r.Srs() == nil {
+		t.Error("expected srs from geokeys")
+	}
+
+	r1 := NewGeoTiffRasterBand(file, 1)
+	if r1 == nil {
+		t.Fatal("failed to open band 1")
+	}
+	defer r1.Close()
+	line := make([]float64, 3)
+	if err := r1.FetchLine(1, line); err != nil {
+		t.Fatal(err)
+	}
+	if line[0] != 12 || line[1] != 12.5 || line[2] != 13 {
+		t.Errorf("unexpected scaled line %v", line)
+	}
+	if r2 := NewGeoTiffRasterBand(file, 2); r2 != nil {
+		t.Error("expected nil raster for missing band")
+	}
+
+	cases := []struct {
+		bits   int
+		format uint16
+		values []float64
+	}{
+		{8, tiffSampleFormatUint, []float64{0, 1, 255, 128, 3, 4}},
+		{8, tiffSampleFormatInt, []float64{-128, 1, 127, -1, 3, 4}},
+		{16, tiffSampleFormatUint, []float64{0, 65535, 1000, 2, 3, 4}},
+		{32, tiffSampleFormatUint, []float64{0, 4294967295, 1000, 2, 3, 4}},
+		{32, tiffSampleFormatInt, []float64{-2147483648, 2147483647, 1000, 2, 3, 4}},
+		{32, tiffSampleFormatFloat, []float64{-1.5, 2.25, 1000, 2, 3, 4}},
+		{64, tiffSampleFormatFloat, []float64{-1.5, 2.25, 1e10, 2, 3, 4}},
+	}
+	for _, c := range cases {
+		r := NewGeoTiffRaster(writeTestTiff(t, 3, 2, c.bits, c.format, [][]float64{c.values}, "", ""))
+		if r == nil {
+			t.Fatalf("failed to open %d bit format %d", c.bits, c.format)
+		}
+		for i, v := range c.values {
+			if got := r.Elevation(i%3, i/3); got != v {
+				t.Errorf("%d bit format %d: expected %f, got %f", c.bits, c.format, v, got)
+			}
+		}
+		r.Range()
+		r.Close()
+	}
+}
+
+// 测试按条带流式读取时缓存保持有界
+func TestGeoTiffRasterStreaming(t *testing.T) {
+	width, height := 4, 10
+	values := make([]float64, width*height)
+	for i := range values {
+		values[i] = float64(i)
+	}
+	file := writeTestTiff(t, width, height, 32, tiffSampleFormatFloat, [][]float64{values}, "", "")
+
+	r := NewGeoTiffRaster(file)
+	if r == nil {
+		t.Fatal("failed to open geotiff")
+	}
+	defer r.Close()
+	r.SetCacheRows(2)
+
+	line := make([]float64, width)
+	for y := 0; y < height; y++ {
+		if err := r.FetchLine(y, line); err != nil {
+			t.Fatal(err)
+		}
+		if line[0] != float64(y*width) || line[width-1] != float64(y*width+width-1) {
+			t.Errorf("line %d: unexpected values %v", y, line)
+		}
+		if n := r.reader.cache.len(); n > 2 {
+			t.Fatalf("cache holds %d blocks", n)
+		}
+	}
+	if r.Elevation(1, 0) != 1 || r.Elevation(3, 9) != 39 {
+		t.Errorf("unexpected elevation %f %f", r.Elevation(1, 0), r.Elevation(3, 9))
+	}
+	if rng := r.Range(); rng[0] != 0 || rng[1] != 39 {
+		t.Errorf("unexpected range %v", rng)
+	}
+
+	metadata := `<GDALMetadata>
+  <Item name="STATISTICS_MINIMUM" sample="0">-100</Item>
+  <Item name="STATISTICS_MAXIMUM" sample="0">100</Item>
+</GDALMetadata>`
+	r2 := NewGeoTiffRaster(writeTestTiff(t, width, height, 32, tiffSampleFormatFloat, [][]float64{values}, metadata, ""))
+	if r2 == nil {
+		t.Fatal("failed to open geotiff")
+	}
+	defer r2.Close()
+	if rng := r2.Range(); rng[0] != -100 || rng[1] != 100 {
+		t.Errorf("expected range from statistics metadata, got %v", rng)
+	}
+}
+
+// 测试所有压缩方式与预测器的组合
+func TestGeoTiffRasterCompression(t *testing.T) {
+	width, height := 5, 3
+	types := []struct {
+		bits   int
+		format uint16
+	}{
+		{8, tiffSampleFormatUint},
+		{16, tiffSampleFormatInt},
+		{32, tiffSampleFormatUint},
+		{32, tiffSampleFormatFloat},
+		{64, tiffSampleFormatFloat},
+	}
+	for _, typ := range types {
+		bands := [][]float64{make([]float64, width*height), make([]float64, width*height)}
+		for i := 0; i < width*height; i++ {
+			bands[0][i] = float64(i * 7 % 23)
+			bands[1][i] = 100 - float64(i*3)
+			if typ.format == tiffSampleFormatFloat {
+				bands[0][i] += 0.25
+			}
+		}
+		predictors := []uint16{tiffPredictorNone, tiffPredictorHorizontal}
+		if typ.format == tiffSampleFormatFloat {
+			predictors = append(predictors, tiffPredictorFloatingPoint)
+		}
+		for _, compression := range []uint16{tiffCompressionNone, tiffCompressionLZW, tiffCompressionDeflate, tiffCompressionPackBits} {
+			for _, predictor := range predictors {
+				opts := testTiffOptions{compression: compression, predictor: predictor, rowsPerStrip: 2}
+				file := writeTestTiffOptions(t, width, height, typ.bits, typ.format, bands, opts)
+				for b := range bands {
+					r := NewGeoTiffRasterBand(file, b)
+					if r == nil {
+						t.Fatalf("%d bit format %d compression %d predictor %d: failed to open", typ.bits, typ.format, compression, predictor)
+					}
+					for i, v := range bands[b] {
+						if got := r.Elevation(i%width, i/width); got != v {
+							t.Fatalf("%d bit format %d compression %d predictor %d band %d pixel %d: expected %v, got %v",
+								typ.bits, typ.format, compression, predictor, b, i, v, got)
+						}
+					}
+					r.Close()
+				}
+			}
+		}
+	}
+}
+
+// 测试 PixelIsPoint 栅格的原点移到首个像元的角点
+func TestGeoTiffRasterPixelIsPoint(t *testing.T) {
+	values := []float64{1, 2, 3, 4}
+	area := NewGeoTiffRaster(writeTestTiff(t, 2, 2, 32, tiffSampleFormatFloat, [][]float64{values}, "", ""))
+	point := NewGeoTiffRaster(writeTestTiffOptions(t, 2, 2, 32, tiffSampleFormatFloat, [][]float64{values}, testTiffOptions{pixelIsPoint: true}))
+	if area == nil || point == nil {
+		t.Fatal("failed to open geotiff")
+	}
+	defer area.Close()
+	defer point.Close()
+	if gt := area.GeoTransform(); gt != [6]float64{500000, 10, 0, 4000000, 0, -10} {
+		t.Errorf("unexpected PixelIsArea geotransform %v", gt)
+	}
+	if gt := point.GeoTransform(); gt != [6]float64{499995, 10, 0, 4000005, 0, -10} {
+		t.Errorf("unexpected PixelIsPoint geotransform %v", gt)
+	}
+	if point.Srs() == nil {
+		t.Error("expected srs after the raster type key")
+	}
+}
+
+// 测试跳过概览和掩膜目录, 读取第一个全分辨率图像
+func TestGeoTiffRasterSubfileType(t *testing.T) {
+	band := make([]float64, 16)
+	for i := range band {
+		band[i] = float64(i)
+	}
+	for _, subfile := range []uint32{tiffSubfileReduced, tiffSubfileMask} {
+		r := NewGeoTiffRaster(writeTestTiffOptions(t, 4, 4, 32, tiffSampleFormatFloat, [][]float64{band}, testTiffOptions{subfileType: subfile}))
+		if r == nil {
+			t.Fatalf("subfile type %d: failed to open", subfile)
+		}
+		if w, h := r.Size(); w != 4 || h != 4 {
+			t.Fatalf("subfile type %d: expected the 4x4 image, got %dx%d", subfile, w, h)
+		}
+		if v := r.Elevation(3, 3); v != 15 {
+			t.Fatalf("subfile type %d: expected 15, got %v", subfile, v)
+		}
+	}
+}
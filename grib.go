@@ -0,0 +1,663 @@
+package contour
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/flywave/go-geo"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+const (
+	GRIB_GRID_LATLON  = 0
+	GRIB_GRID_LAMBERT = 30
+
+	GRIB_PACKING_SIMPLE          = 0
+	GRIB_PACKING_COMPLEX         = 2
+	GRIB_PACKING_COMPLEX_SPATIAL = 3
+
+	gribScanNegativeI  = 0x80
+	gribScanPositiveJ  = 0x40
+	gribScanJConsecute = 0x20
+	gribScanAlternate  = 0x10
+
+	gribMissing32 = 0xffffffff
+)
+
+// GribMessage is one field of a GRIB2 message, a message repeating sections
+// 2 to 7 yields one GribMessage per data section.
+type GribMessage struct {
+	Discipline    uint8
+	Centre        uint16
+	ReferenceTime time.Time
+	// The product fields are read for the product templates 4.0 to 4.15.
+	ProductTemplate uint16
+	Category        uint8
+	Parameter       uint8
+	TimeUnit        uint8
+	ForecastTime    int
+	SurfaceType     uint8
+	SurfaceValue    float64
+	GridTemplate    uint16
+	Width           int
+	Height          int
+	DataTemplate    uint16
+	grid            *gribGrid
+	points          int
+	drs             []byte
+	bitmap          []byte
+	data            []byte
+}
+
+type gribGrid struct {
+	ni, nj       int
+	scan         uint8
+	geoTransform [6]float64
+	srs          geo.Proj
+	err          error
+}
+
+// gribSigned reads a sign and magnitude integer, the encoding of all signed
+// GRIB2 values.
+func gribSigned(b []byte) int64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	sign := uint64(1) << (8*uint(len(b)) - 1)
+	if v&sign != 0 {
+		return -int64(v &^ sign)
+	}
+	return int64(v)
+}
+
+type gribBitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *gribBitReader) read(n int) (uint64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	if r.pos+n > 8*len(r.data) {
+		return 0, errors.New("grib data section is truncated")
+	}
+	var v uint64
+	for i := 0; i < n; i++ {
+		bit := r.data[r.pos>>3] >> (7 - uint(r.pos&7)) & 1
+		v = v<<1 | uint64(bit)
+		r.pos++
+	}
+	return v, nil
+}
+
+func (r *gribBitReader) align() {
+	r.pos = (r.pos + 7) &^ 7
+}
+
+// NewGribRaster reads the first field of a GRIB2 file accepted by match, nil
+// accepts any field. Messages are decoded one at a time and the file is only
+// read up to the matching one.
+func NewGribRaster(fileName string, match func(m *GribMessage) bool) (*MemoryRaster, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadGribRaster(f, match)
+}
+
+func ReadGribRaster(reader io.Reader, match func(m *GribMessage) bool) (*MemoryRaster, error) {
+	var found *GribMessage
+	err := ScanGrib2(reader, func(m *GribMessage) bool {
+		if match == nil || match(m) {
+			found = m
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, errors.New("no matching grib2 field found")
+	}
+	return found.Raster()
+}
+
+// ReadGrib2 reads all fields of a GRIB2 stream, bytes between messages such
+// as bulletin headers are skipped. Large files are better read by ScanGrib2.
+func ReadGrib2(reader io.Reader) ([]*GribMessage, error) {
+	var msgs []*GribMessage
+	err := ScanGrib2(reader, func(m *GribMessage) bool {
+		msgs = append(msgs, m)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("no grib2 message found")
+	}
+	return msgs, nil
+}
+
+// ScanGrib2 passes the fields of a GRIB2 stream to fn until it returns false.
+// Each message is located by the length in its indicator section and read on
+// its own, so only the current message is held in memory.
+func ScanGrib2(reader io.Reader, fn func(m *GribMessage) bool) error {
+	br := bufio.NewReader(reader)
+	for {
+		if err := skipToGrib(br); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var msg bytes.Buffer
+		msg.WriteString("GRIB")
+		if _, err := io.CopyN(&msg, br, 12); err != nil {
+			return errors.New("grib indicator section is truncated")
+		}
+		head := msg.Bytes()
+		if head[7] != 2 {
+			return fmt.Errorf("unsupported grib edition %d", head[7])
+		}
+		length := binary.BigEndian.Uint64(head[8:])
+		if length < 20 || length > math.MaxInt64 {
+			return errors.New("grib message is truncated")
+		}
+		// the buffer grows with the data read, a corrupt length can not
+		// allocate more than the stream holds
+		if _, err := io.CopyN(&msg, br, int64(length-16)); err != nil {
+			return errors.New("grib message is truncated")
+		}
+		fields, err := decodeGrib2Message(msg.Bytes())
+		if err != nil {
+			return err
+		}
+		for _, m := range fields {
+			if !fn(m) {
+				return nil
+			}
+		}
+	}
+}
+
+// skipToGrib consumes the stream up to and including the next "GRIB".
+func skipToGrib(br *bufio.Reader) error {
+	const magic = "GRIB"
+	for matched := 0; matched < len(magic); {
+		c, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case c == magic[matched]:
+			matched++
+		case c == magic[0]:
+			matched = 1
+		default:
+			matched = 0
+		}
+	}
+	return nil
+}
+
+func decodeGrib2Message(msg []byte) ([]*GribMessage, error) {
+	be := binary.BigEndian
+	if string(msg[len(msg)-4:]) != "7777" {
+		return nil, errors.New("grib message has no end section")
+	}
+	cur := &GribMessage{Discipline: msg[6]}
+	var fields []*GribMessage
+	var bitmap []byte
+	pos := 16
+	for pos < len(msg)-4 {
+		if pos+5 > len(msg) {
+			return nil, errors.New("grib section is truncated")
+		}
+		length := int(be.Uint32(msg[pos:]))
+		if length < 5 || pos+length > len(msg)-4 {
+			return nil, errors.New("grib section is truncated")
+		}
+		sec := msg[pos : pos+length]
+		switch sec[4] {
+		case 1:
+			if length < 21 {
+				return nil, errors.New("grib identification section is truncated")
+			}
+			cur.Centre = be.Uint16(sec[5:])
+			cur.ReferenceTime = time.Date(int(be.Uint16(sec[12:])), time.Month(sec[14]), int(sec[15]),
+				int(sec[16]), int(sec[17]), int(sec[18]), 0, time.UTC)
+		case 3:
+			if length < 14 {
+				return nil, errors.New("grib grid section is truncated")
+			}
+			cur.GridTemplate = be.Uint16(sec[12:])
+			cur.points = gribSize(sec[6:])
+			cur.grid = decodeGribGrid(sec)
+			cur.Width, cur.Height = cur.grid.ni, cur.grid.nj
+		case 4:
+			if length < 9 {
+				return nil, errors.New("grib product section is truncated")
+			}
+			cur.ProductTemplate = be.Uint16(sec[7:])
+			// a field must not inherit the product of the previous one
+			cur.Category, cur.Parameter, cur.TimeUnit, cur.ForecastTime = 0, 0, 0, 0
+			cur.SurfaceType, cur.SurfaceValue = 0, 0
+			if cur.ProductTemplate <= 15 && length >= 34 {
+				cur.Category, cur.Parameter = sec[9], sec[10]
+				cur.TimeUnit = sec[17]
+				cur.ForecastTime = int(gribSigned(sec[18:22]))
+				cur.SurfaceType = sec[22]
+				if sec[23] != 0xff && be.Uint32(sec[24:]) != gribMissing32 {
+					cur.SurfaceValue = float64(gribSigned(sec[24:28])) * math.Pow10(-int(gribSigned(sec[23:24])))
+				}
+			}
+		case 5:
+			if length < 21 {
+				return nil, errors.New("grib data representation section is truncated")
+			}
+			cur.DataTemplate = be.Uint16(sec[9:])
+			cur.drs = sec
+		case 6:
+			if length < 6 {
+				return nil, errors.New("grib bitmap section is truncated")
+			}
+			switch sec[5] {
+			case 0:
+				bitmap = sec[6:]
+			case 254:
+				if bitmap == nil {
+					return nil, errors.New("grib bitmap refers to a missing bitmap")
+				}
+			case 255:
+				bitmap = nil
+			default:
+				return nil, fmt.Errorf("unsupported predefined grib bitmap %d", sec[5])
+			}
+			cur.bitmap = bitmap
+		case 7:
+			if cur.grid == nil || cur.drs == nil {
+				return nil, errors.New("grib data section without grid or representation")
+			}
+			cur.data = sec[5:]
+			field := *cur
+			fields = append(fields, &field)
+		}
+		pos += length
+	}
+	return fields, nil
+}
+
+func gribEarth(sec []byte) string {
+	be := binary.BigEndian
+	scaled := func(i int) float64 {
+		return float64(be.Uint32(sec[i+1:])) * math.Pow10(-int(sec[i]))
+	}
+	switch sec[14] {
+	case 1:
+		return fmt.Sprintf("+R=%g", scaled(15))
+	case 2:
+		return "+a=6378160 +b=6356775"
+	case 3:
+		return fmt.Sprintf("+a=%g +b=%g", scaled(20)*1000, scaled(25)*1000)
+	case 4:
+		return "+ellps=GRS80"
+	case 5:
+		return "+ellps=WGS84"
+	case 6:
+		return "+R=6371229"
+	case 7:
+		return fmt.Sprintf("+a=%g +b=%g", scaled(20), scaled(25))
+	case 8:
+		return "+R=6371200"
+	}
+	return "+R=6367470"
+}
+
+// gribSize reads a 4 byte count, missing counts and counts beyond the int
+// range of 32 bit targets give 0.
+func gribSize(b []byte) int {
+	v := binary.BigEndian.Uint32(b)
+	if v == gribMissing32 || v > math.MaxInt32 {
+		return 0
+	}
+	return int(v)
+}
+
+// decodeGribGrid reads the grid definition and places the first grid point
+// in a north up geotransform.
+func decodeGribGrid(sec []byte) *gribGrid {
+	be := binary.BigEndian
+	g := &gribGrid{}
+	if sec[10] != 0 {
+		g.err = errors.New("quasi regular grib grids are not supported")
+		return g
+	}
+	tpl := be.Uint16(sec[12:])
+	var x1, y1, dx, dy float64
+	switch tpl {
+	case GRIB_GRID_LATLON:
+		if len(sec) < 72 {
+			g.err = errors.New("grib lat/lon grid is truncated")
+			return g
+		}
+		g.ni, g.nj = gribSize(sec[30:]), gribSize(sec[34:])
+		unit := 1e-6
+		if basic, sub := be.Uint32(sec[38:]), be.Uint32(sec[42:]); basic != 0 && basic != gribMissing32 && sub != 0 && sub != gribMissing32 {
+			unit = float64(basic) / float64(sub)
+		}
+		la1, lo1 := float64(gribSigned(sec[46:50]))*unit, float64(gribSigned(sec[50:54]))*unit
+		la2, lo2 := float64(gribSigned(sec[55:59]))*unit, float64(gribSigned(sec[59:63]))*unit
+		g.scan = sec[71]
+		if di := be.Uint32(sec[63:]); di != gribMissing32 {
+			dx = float64(di) * unit
+		} else if g.ni > 1 {
+			span := lo2 - lo1
+			if g.scan&gribScanNegativeI != 0 {
+				span = -span
+			}
+			if span < 0 {
+				span += 360
+			}
+			dx = span / float64(g.ni-1)
+		}
+		if dj := be.Uint32(sec[67:]); dj != gribMissing32 {
+			dy = float64(dj) * unit
+		} else if g.nj > 1 {
+			dy = math.Abs(la2-la1) / float64(g.nj-1)
+		}
+		x1, y1 = lo1, la1
+		g.srs = srs4326
+	case GRIB_GRID_LAMBERT:
+		if len(sec) < 81 {
+			g.err = errors.New("grib lambert grid is truncated")
+			return g
+		}
+		g.ni, g.nj = gribSize(sec[30:]), gribSize(sec[34:])
+		la1, lo1 := float64(gribSigned(sec[38:42]))*1e-6, float64(gribSigned(sec[42:46]))*1e-6
+		lad, lov := float64(gribSigned(sec[47:51]))*1e-6, float64(gribSigned(sec[51:55]))*1e-6
+		dx, dy = float64(be.Uint32(sec[55:]))*1e-3, float64(be.Uint32(sec[59:]))*1e-3
+		g.scan = sec[64]
+		latin1, latin2 := float64(gribSigned(sec[65:69]))*1e-6, float64(gribSigned(sec[69:73]))*1e-6
+		if lov > 180 {
+			lov -= 360
+		}
+		if lo1 > 180 {
+			lo1 -= 360
+		}
+		g.srs = geo.NewProj(fmt.Sprintf("+proj=lcc +lat_1=%g +lat_2=%g +lat_0=%g +lon_0=%g +x_0=0 +y_0=0 %s +units=m +no_defs",
+			latin1, latin2, lad, lov, gribEarth(sec)))
+		if g.srs == nil {
+			g.err = errors.New("invalid grib lambert projection")
+			return g
+		}
+		p := srs4326.TransformTo(g.srs, []vec2d.T{{lo1, la1}})[0]
+		x1, y1 = p[0], p[1]
+	default:
+		g.err = fmt.Errorf("unsupported grib grid template 3.%d", tpl)
+		return g
+	}
+	if g.ni <= 0 || g.nj <= 0 {
+		g.err = errors.New("grib grid has no regular size")
+		return g
+	}
+	if dx == 0 {
+		dx = 1
+	}
+	if dy == 0 {
+		dy = 1
+	}
+	x, y := g.position(0)
+	g.geoTransform = [6]float64{x1 - (float64(x)+0.5)*dx, dx, 0, y1 + (float64(y)+0.5)*dy, 0, -dy}
+	return g
+}
+
+// position maps the k-th grid point in scanning order to its column and row,
+// with rows running north to south.
+func (g *gribGrid) position(k int) (x, y int) {
+	i, j := k%g.ni, k/g.ni
+	if g.scan&gribScanJConsecute != 0 {
+		i, j = k/g.nj, k%g.nj
+		if g.scan&gribScanAlternate != 0 && i%2 == 1 {
+			j = g.nj - 1 - j
+		}
+	} else if g.scan&gribScanAlternate != 0 && j%2 == 1 {
+		i = g.ni - 1 - i
+	}
+	if g.scan&gribScanNegativeI != 0 {
+		i = g.ni - 1 - i
+	}
+	if g.scan&gribScanPositiveJ != 0 {
+		j = g.nj - 1 - j
+	}
+	return i, j
+}
+
+// Values decodes the packed values in scanning order, missing values are
+// NaN.
+func (m *GribMessage) Values() ([]float64, error) {
+	be := binary.BigEndian
+	drs := m.drs
+	count := gribSize(drs[5:])
+	ref := float64(math.Float32frombits(be.Uint32(drs[11:])))
+	binScale := int(gribSigned(drs[15:17]))
+	decScale := math.Pow10(-int(gribSigned(drs[17:19])))
+	nbits := int(drs[19])
+
+	var packed []int64
+	var missing []bool
+	var err error
+	switch m.DataTemplate {
+	case GRIB_PACKING_SIMPLE:
+		packed = make([]int64, count)
+		if nbits > 0 {
+			r := &gribBitReader{data: m.data}
+			for i := range packed {
+				v, err := r.read(nbits)
+				if err != nil {
+					return nil, err
+				}
+				packed[i] = int64(v)
+			}
+		}
+	case GRIB_PACKING_COMPLEX, GRIB_PACKING_COMPLEX_SPATIAL:
+		packed, missing, err = gribUnpackComplex(drs, m.data, count, m.DataTemplate == GRIB_PACKING_COMPLEX_SPATIAL)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported grib data template 5.%d", m.DataTemplate)
+	}
+
+	unpacked := make([]float64, count)
+	for i, x := range packed {
+		if missing != nil && missing[i] {
+			unpacked[i] = math.NaN()
+		} else {
+			unpacked[i] = (ref + math.Ldexp(float64(x), binScale)) * decScale
+		}
+	}
+	if m.bitmap == nil {
+		if count != m.points {
+			return nil, fmt.Errorf("grib field has %d values for %d points", count, m.points)
+		}
+		return unpacked, nil
+	}
+	if len(m.bitmap)*8 < m.points {
+		return nil, errors.New("grib bitmap is truncated")
+	}
+	values := make([]float64, m.points)
+	n := 0
+	for k := range values {
+		if m.bitmap[k>>3]>>(7-uint(k&7))&1 == 0 {
+			values[k] = math.NaN()
+			continue
+		}
+		if n >= count {
+			return nil, errors.New("grib bitmap has more points than values")
+		}
+		values[k] = unpacked[n]
+		n++
+	}
+	return values, nil
+}
+
+// gribUnpackComplex reads the groups of complex packing and undoes the
+// spatial differencing, it returns the integer values and the missing flags.
+func gribUnpackComplex(drs, data []byte, count int, spatial bool) ([]int64, []bool, error) {
+	if len(drs) < 47 || (spatial && len(drs) < 49) {
+		return nil, nil, errors.New("grib complex packing template is truncated")
+	}
+	nbits := int(drs[19])
+	missingMode := drs[22]
+	ng := gribSize(drs[31:])
+	widthRef, widthBits := int(drs[35]), int(drs[36])
+	lengthRef, lengthInc := gribSize(drs[37:]), int(drs[41])
+	lastLength, lengthBits := gribSize(drs[42:]), int(drs[46])
+	if ng > count {
+		return nil, nil, errors.New("invalid grib group count")
+	}
+
+	r := &gribBitReader{data: data}
+	var order int
+	var first [2]int64
+	var minimum int64
+	if spatial {
+		order = int(drs[47])
+		size := int(drs[48])
+		if order < 1 || order > 2 || size == 0 || len(data) < (order+1)*size {
+			return nil, nil, errors.New("invalid grib spatial differencing descriptors")
+		}
+		for i := 0; i < order; i++ {
+			first[i] = gribSigned(data[i*size : (i+1)*size])
+		}
+		minimum = gribSigned(data[order*size : (order+1)*size])
+		r.pos = 8 * (order + 1) * size
+	}
+
+	refs := make([]uint64, ng)
+	widths := make([]int, ng)
+	lengths := make([]int, ng)
+	for g := range refs {
+		v, err := r.read(nbits)
+		if err != nil {
+			return nil, nil, err
+		}
+		refs[g] = v
+	}
+	r.align()
+	for g := range widths {
+		v, err := r.read(widthBits)
+		if err != nil {
+			return nil, nil, err
+		}
+		widths[g] = widthRef + int(v)
+		if widths[g] > 63 {
+			return nil, nil, errors.New("invalid grib group width")
+		}
+	}
+	r.align()
+	total := 0
+	for g := range lengths {
+		v, err := r.read(lengthBits)
+		if err != nil {
+			return nil, nil, err
+		}
+		lengths[g] = lengthRef + int(v)*lengthInc
+		if g == ng-1 {
+			lengths[g] = lastLength
+		}
+		total += lengths[g]
+	}
+	if total != count {
+		return nil, nil, fmt.Errorf("grib groups hold %d values instead of %d", total, count)
+	}
+	r.align()
+
+	values := make([]int64, 0, count)
+	missing := make([]bool, 0, count)
+	primary := uint64(1)<<uint(nbits) - 1
+	for g := range refs {
+		w := widths[g]
+		groupMissing := missingMode != 0 && nbits > 0 && w == 0 &&
+			(refs[g] == primary || (missingMode == 2 && refs[g] == primary-1))
+		for k := 0; k < lengths[g]; k++ {
+			v, err := r.read(w)
+			if err != nil {
+				return nil, nil, err
+			}
+			isMissing := groupMissing
+			if missingMode != 0 && w > 0 {
+				top := uint64(1)<<uint(w) - 1
+				isMissing = v == top || (missingMode == 2 && v == top-1)
+			}
+			values = append(values, int64(refs[g]+v))
+			missing = append(missing, isMissing)
+		}
+	}
+
+	if spatial {
+		var prev [2]int64
+		n := 0
+		for i := range values {
+			if missing[i] {
+				continue
+			}
+			switch {
+			case n < order:
+				values[i] = first[n]
+			case order == 1:
+				values[i] += minimum + prev[1]
+			default:
+				values[i] += minimum + 2*prev[1] - prev[0]
+			}
+			prev[0], prev[1] = prev[1], values[i]
+			n++
+		}
+	}
+	if missingMode == 0 {
+		missing = nil
+	}
+	return values, missing, nil
+}
+
+// Raster decodes the field into a north up raster, bitmap and missing
+// values become nodata.
+func (m *GribMessage) Raster() (*MemoryRaster, error) {
+	g := m.grid
+	if g.err != nil {
+		return nil, g.err
+	}
+	if g.ni*g.nj != m.points {
+		return nil, fmt.Errorf("grib grid of %d x %d does not match %d points", g.ni, g.nj, m.points)
+	}
+	values, err := m.Values()
+	if err != nil {
+		return nil, err
+	}
+	nodata := defaultNoData
+	data := make([]float64, len(values))
+	for k, v := range values {
+		x, y := g.position(k)
+		if math.IsNaN(v) {
+			v = nodata
+		}
+		data[y*g.ni+x] = v
+	}
+	r := NewMemoryRaster(data, g.ni, g.nj, g.geoTransform, g.srs, &nodata)
+	if r == nil {
+		return nil, errors.New("grib field is empty")
+	}
+	return r, nil
+}
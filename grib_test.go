@@ -0,0 +1,450 @@
+package contour
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+type testBitWriter struct {
+	buf []byte
+	n   int
+}
+
+func (w *testBitWriter) write(v uint64, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.buf[len(w.buf)-1] |= 1 << uint(7-w.n%8)
+		}
+		w.n++
+	}
+}
+
+func (w *testBitWriter) align() {
+	w.n = (w.n + 7) &^ 7
+}
+
+func putGribSigned(b []byte, v int64) {
+	u := uint64(v)
+	if v < 0 {
+		u = uint64(-v) | 1<<(8*uint(len(b))-1)
+	}
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(u)
+		u >>= 8
+	}
+}
+
+func bitsFor(v uint64) int {
+	n := 0
+	for v > 0 {
+		n++
+		v >>= 1
+	}
+	return n
+}
+
+func gribSection(num byte, body []byte) []byte {
+	sec := make([]byte, 5, 5+len(body))
+	binary.BigEndian.PutUint32(sec, uint32(5+len(body)))
+	sec[4] = num
+	return append(sec, body...)
+}
+
+// buildTestGrib 把若干节组装为一条 GRIB2 消息, 第 1 节使用固定的参考时间
+func buildTestGrib(sections ...[]byte) []byte {
+	ident := make([]byte, 16)
+	binary.BigEndian.PutUint16(ident[0:], 7)
+	binary.BigEndian.PutUint16(ident[7:], 2024)
+	ident[9], ident[10], ident[11] = 3, 15, 12
+	var body bytes.Buffer
+	body.Write(gribSection(1, ident))
+	for _, s := range sections {
+		body.Write(s)
+	}
+	msg := make([]byte, 16)
+	copy(msg, "GRIB")
+	msg[7] = 2
+	binary.BigEndian.PutUint64(msg[8:], uint64(16+body.Len()+4))
+	msg = append(msg, body.Bytes()...)
+	return append(msg, "7777"...)
+}
+
+func testGribLatLonGrid(ni, nj int, la1, lo1, la2, lo2, di, dj float64, scan byte) []byte {
+	be := binary.BigEndian
+	b := make([]byte, 67)
+	be.PutUint32(b[1:], uint32(ni*nj))
+	b[9] = 6
+	be.PutUint32(b[25:], uint32(ni))
+	be.PutUint32(b[29:], uint32(nj))
+	putGribSigned(b[41:45], int64(la1*1e6))
+	putGribSigned(b[45:49], int64(lo1*1e6))
+	putGribSigned(b[50:54], int64(la2*1e6))
+	putGribSigned(b[54:58], int64(lo2*1e6))
+	be.PutUint32(b[58:], uint32(di*1e6))
+	be.PutUint32(b[62:], uint32(dj*1e6))
+	b[66] = scan
+	return gribSection(3, b)
+}
+
+func testGribProduct(category, parameter, surface byte, value int64) []byte {
+	b := make([]byte, 29)
+	b[4], b[5] = category, parameter
+	b[12] = 1
+	binary.BigEndian.PutUint32(b[13:], 6)
+	b[17] = surface
+	binary.BigEndian.PutUint32(b[19:], uint32(value))
+	return gribSection(4, b)
+}
+
+func testGribSimple(values []uint64, nbits int, ref float32, decimal int64) [][]byte {
+	be := binary.BigEndian
+	drs := make([]byte, 16)
+	be.PutUint32(drs[0:], uint32(len(values)))
+	be.PutUint32(drs[6:], math.Float32bits(ref))
+	putGribSigned(drs[12:14], decimal)
+	drs[14] = byte(nbits)
+	w := &testBitWriter{}
+	for _, v := range values {
+		w.write(v, nbits)
+	}
+	return [][]byte{gribSection(5, drs), gribSection(7, w.buf)}
+}
+
+// testGribComplex 按组长度 3 编码复杂打包, order 为 0 时不做空间差分
+func testGribComplex(values []int64, missing []bool, order int, ref float32, decimal int64) [][]byte {
+	be := binary.BigEndian
+	packed := append([]int64(nil), values...)
+	var first []int64
+	var minimum int64
+	if order > 0 {
+		var valid []int
+		for i := range values {
+			if !missing[i] {
+				valid = append(valid, i)
+			}
+		}
+		diff := make([]int64, len(valid))
+		for n, i := range valid {
+			switch {
+			case n < order:
+				first = append(first, values[i])
+			case order == 1:
+				diff[n] = values[i] - values[valid[n-1]]
+			default:
+				diff[n] = values[i] - 2*values[valid[n-1]] + values[valid[n-2]]
+			}
+		}
+		minimum = math.MaxInt64
+		for n := order; n < len(diff); n++ {
+			if diff[n] < minimum {
+				minimum = diff[n]
+			}
+		}
+		for n, i := range valid {
+			packed[i] = 0
+			if n >= order {
+				packed[i] = diff[n] - minimum
+			}
+		}
+	}
+
+	var refs []uint64
+	var widths []int
+	var lengths []int
+	var groupMissing []bool
+	maxRef := uint64(0)
+	for start := 0; start < len(packed); start += 3 {
+		end := minInt(start+3, len(packed))
+		lo, hi, hasMissing, any := int64(math.MaxInt64), int64(0), false, false
+		for i := start; i < end; i++ {
+			if missing[i] {
+				hasMissing = true
+				continue
+			}
+			any = true
+			if packed[i] < lo {
+				lo = packed[i]
+			}
+			if packed[i] > hi {
+				hi = packed[i]
+			}
+		}
+		if !any {
+			refs = append(refs, 0)
+			widths = append(widths, 0)
+		} else {
+			span := uint64(hi - lo)
+			if hasMissing {
+				span++
+			}
+			refs = append(refs, uint64(lo))
+			widths = append(widths, bitsFor(span))
+			if uint64(lo) > maxRef {
+				maxRef = uint64(lo)
+			}
+		}
+		groupMissing = append(groupMissing, !any)
+		lengths = append(lengths, end-start)
+	}
+	nbits := bitsFor(maxRef + 1)
+	maxWidth := 0
+	for _, w := range widths {
+		maxWidth = maxInt(maxWidth, w)
+	}
+
+	w := &testBitWriter{}
+	size := 2
+	if order > 0 {
+		tmp := make([]byte, size)
+		for _, v := range append(first, minimum) {
+			putGribSigned(tmp, v)
+			w.write(uint64(binary.BigEndian.Uint16(tmp)), 16)
+		}
+	}
+	for g, r := range refs {
+		if groupMissing[g] {
+			r = 1<<uint(nbits) - 1
+		}
+		w.write(r, nbits)
+	}
+	w.align()
+	for _, width := range widths {
+		w.write(uint64(width), bitsFor(uint64(maxWidth)))
+	}
+	w.align()
+	for _, l := range lengths {
+		w.write(uint64(l-1), 2)
+	}
+	w.align()
+	for g := range lengths {
+		for i := g * 3; i < g*3+lengths[g]; i++ {
+			if widths[g] == 0 {
+				continue
+			}
+			if missing[i] {
+				w.write(1<<uint(widths[g])-1, widths[g])
+			} else {
+				w.write(uint64(packed[i])-refs[g], widths[g])
+			}
+		}
+	}
+
+	drs := make([]byte, 44)
+	tpl := GRIB_PACKING_COMPLEX
+	if order > 0 {
+		tpl = GRIB_PACKING_COMPLEX_SPATIAL
+	}
+	be.PutUint32(drs[0:], uint32(len(values)))
+	be.PutUint16(drs[4:], uint16(tpl))
+	be.PutUint32(drs[6:], math.Float32bits(ref))
+	putGribSigned(drs[12:14], decimal)
+	drs[14] = byte(nbits)
+	drs[16] = 1
+	drs[17] = 1
+	be.PutUint32(drs[26:], uint32(len(refs)))
+	drs[31] = byte(bitsFor(uint64(maxWidth)))
+	be.PutUint32(drs[32:], 1)
+	drs[36] = 1
+	be.PutUint32(drs[37:], uint32(lengths[len(lengths)-1]))
+	drs[41] = 2
+	drs[42], drs[43] = byte(order), byte(size)
+	return [][]byte{gribSection(5, drs), gribSection(7, w.buf)}
+}
+
+// 测试简单打包, 位图和自南向北的扫描方式
+func TestGribSimplePacking(t *testing.T) {
+	data := testGribSimple([]uint64{0, 10, 20, 30, 50}, 8, 1000, 1)
+	msg := buildTestGrib(testGribLatLonGrid(3, 2, 10, 100, 11, 102, 1, 1, gribScanPositiveJ),
+		testGribProduct(0, 0, 100, 85000), gribSection(6, []byte{0, 0xf4}), data[0], data[1])
+	var stream bytes.Buffer
+	stream.WriteString("TTAA00 KWBC\r\r\n")
+	stream.Write(msg)
+	stream.Write(msg)
+
+	msgs, err := ReadGrib2(&stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+	m := msgs[0]
+	if m.Centre != 7 || m.ReferenceTime.Year() != 2024 || m.SurfaceType != 100 || m.SurfaceValue != 85000 || m.ForecastTime != 6 {
+		t.Fatalf("unexpected product %+v", m)
+	}
+	r, err := m.Raster()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gt := r.GeoTransform(); gt != [6]float64{99.5, 1, 0, 11.5, 0, -1} {
+		t.Fatalf("unexpected geotransform %v", gt)
+	}
+	// 北行为第二个扫描行: 值 30, 缺失, 50
+	want := []float64{103, math.NaN(), 105, 100, 101, 102}
+	for i, v := range want {
+		got := r.Elevation(i%3, i/3)
+		if math.IsNaN(v) {
+			if !isNoData(got, r.NoData()) {
+				t.Fatalf("expected nodata at %d, got %v", i, got)
+			}
+		} else if math.Abs(got-v) > 1e-9 {
+			t.Fatalf("expected %v at %d, got %v", v, i, got)
+		}
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "field.grib2")
+	if err := os.WriteFile(file, msg, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := NewGribRaster(file, func(m *GribMessage) bool { return m.SurfaceValue == 50000 }); r != nil || err == nil {
+		t.Fatal("expected no matching field")
+	}
+	if r, err := NewGribRaster(file, nil); r == nil || err != nil {
+		t.Fatalf("expected raster, got %v", err)
+	}
+	if _, err := NewGribRaster(filepath.Join(dir, "missing.grib2"), nil); err == nil {
+		t.Fatal("expected error for a missing file")
+	}
+}
+
+// 测试逐条扫描消息: 找到匹配的字段后不再读取后续数据
+func TestScanGrib2(t *testing.T) {
+	data := testGribSimple([]uint64{0, 10, 20, 30, 50, 60}, 8, 0, 1)
+	grid := testGribLatLonGrid(3, 2, 10, 100, 11, 102, 1, 1, gribScanPositiveJ)
+	var stream bytes.Buffer
+	stream.Write(buildTestGrib(grid, testGribProduct(0, 0, 100, 85000), data[0], data[1]))
+	stream.Write(buildTestGrib(grid, testGribProduct(0, 0, 100, 50000), data[0], data[1]))
+	// 后续损坏的消息在匹配之后不会被读取
+	stream.WriteString("GRIB\x00\x00\x00\x02\x00\x00\x00\x00\x00\x00\xff\xff")
+
+	r, err := ReadGribRaster(bytes.NewReader(stream.Bytes()), func(m *GribMessage) bool { return m.SurfaceValue == 50000 })
+	if err != nil || r == nil {
+		t.Fatalf("expected the second field, got %v", err)
+	}
+	fields := 0
+	err = ScanGrib2(bytes.NewReader(stream.Bytes()), func(m *GribMessage) bool {
+		fields++
+		return true
+	})
+	if err == nil || fields != 2 {
+		t.Fatalf("expected two fields before the truncated message, got %d %v", fields, err)
+	}
+}
+
+// 测试同一消息中的第二个字段不会沿用前一个字段的产品信息
+func TestGribProductReset(t *testing.T) {
+	data := testGribSimple([]uint64{0, 10, 20, 30, 50, 60}, 8, 0, 1)
+	other := testGribProduct(0, 0, 0, 0)
+	binary.BigEndian.PutUint16(other[7:], 40)
+	msg := buildTestGrib(testGribLatLonGrid(3, 2, 10, 100, 11, 102, 1, 1, gribScanPositiveJ),
+		testGribProduct(2, 3, 100, 85000), data[0], data[1], other, data[0], data[1])
+
+	msgs, err := ReadGrib2(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 fields, got %d", len(msgs))
+	}
+	if m := msgs[0]; m.Category != 2 || m.Parameter != 3 || m.SurfaceType != 100 || m.SurfaceValue != 85000 || m.ForecastTime != 6 {
+		t.Fatalf("unexpected first product %+v", m)
+	}
+	if m := msgs[1]; m.ProductTemplate != 40 || m.Category != 0 || m.Parameter != 0 || m.TimeUnit != 0 ||
+		m.ForecastTime != 0 || m.SurfaceType != 0 || m.SurfaceValue != 0 {
+		t.Fatalf("second product inherits the first %+v", m)
+	}
+}
+
+// 测试带二阶空间差分和缺测值的复杂打包
+func TestGribComplexPacking(t *testing.T) {
+	values := []int64{500, 510, 530, 520, 0, 515, 511, 0, 0, 490, 480, 482}
+	missing := []bool{false, false, false, false, true, false, false, true, true, false, false, false}
+	for _, order := range []int{0, 1, 2} {
+		data := testGribComplex(values, missing, order, 10, 1)
+		msg := buildTestGrib(testGribLatLonGrid(4, 3, 50, 0, 48, 3, 1, 1, 0), testGribProduct(0, 0, 1, 0), gribSection(6, []byte{255}), data[0], data[1])
+		msgs, err := ReadGrib2(bytes.NewReader(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := msgs[0].Raster()
+		if err != nil {
+			t.Fatalf("order %d: %v", order, err)
+		}
+		for i, v := range values {
+			got := r.Elevation(i%4, i/4)
+			if missing[i] {
+				if !isNoData(got, r.NoData()) {
+					t.Fatalf("order %d: expected nodata at %d, got %v", order, i, got)
+				}
+			} else if math.Abs(got-(10+float64(v))/10) > 1e-9 {
+				t.Fatalf("order %d: expected %v at %d, got %v", order, (10+float64(v))/10, i, got)
+			}
+		}
+	}
+}
+
+// 测试 Lambert 投影网格的地理变换, 并生成等值线
+func TestGribLambertGrid(t *testing.T) {
+	be := binary.BigEndian
+	b := make([]byte, 76)
+	be.PutUint32(b[1:], 12)
+	be.PutUint16(b[7:], GRIB_GRID_LAMBERT)
+	b[9] = 6
+	be.PutUint32(b[25:], 4)
+	be.PutUint32(b[29:], 3)
+	putGribSigned(b[33:37], 30e6)
+	putGribSigned(b[37:41], 250e6)
+	putGribSigned(b[42:46], 40e6)
+	putGribSigned(b[46:50], 260e6)
+	be.PutUint32(b[50:], 3000e3)
+	be.PutUint32(b[54:], 3000e3)
+	b[59] = gribScanPositiveJ
+	putGribSigned(b[60:64], 40e6)
+	putGribSigned(b[64:68], 40e6)
+	grid := gribSection(3, b)
+
+	values := make([]int64, 12)
+	missing := make([]bool, 12)
+	for i := range values {
+		values[i] = int64(10 * (i % 4))
+	}
+	data := testGribComplex(values, missing, 0, 0, 0)
+	msgs, err := ReadGrib2(bytes.NewReader(buildTestGrib(grid, testGribProduct(0, 0, 1, 0), data[0], data[1])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := msgs[0].Raster()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gt := r.GeoTransform()
+	if gt[1] != 3000 || gt[5] != -3000 {
+		t.Fatalf("unexpected resolution %v", gt)
+	}
+	// 第一个格点位于左下角
+	p := srs4326.TransformTo(r.Srs(), []vec2d.T{{-110, 30}})[0]
+	if math.Abs(gt[0]+1500-p[0]) > 1e-3 || math.Abs(gt[3]-7500-p[1]) > 1e-3 {
+		t.Fatalf("first point %v does not match geotransform %v", p, gt)
+	}
+	if c := srs4326.TransformTo(r.Srs(), []vec2d.T{{-100, 40}})[0]; math.Abs(c[0]) > 1e-6 || math.Abs(c[1]) > 1e-6 {
+		t.Fatalf("expected projection origin at LoV and LaD, got %v", c)
+	}
+
+	writer := NewMockGeometryWriter()
+	if err := ContourGenerate(r, writer, ContourGenerateOptions{Interval: 15}); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.writtenGeom) != 2 {
+		t.Fatalf("expected 2 isolines, got %d", len(writer.writtenGeom))
+	}
+}
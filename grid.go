@@ -0,0 +1,308 @@
+package contour
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/flywave/go-geo"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+type GridMethod uint8
+
+const (
+	GRID_NEAREST GridMethod = iota
+	GRID_IDW
+	// GRID_NATURAL keeps only the neighbours that surround the node, a point is
+	// dropped when it lies behind the bisector of a closer point, and weights
+	// them by inverse distance. It approximates natural neighbour interpolation
+	// without building a Voronoi diagram.
+	GRID_NATURAL
+)
+
+const (
+	defaultGridMaxPoints = 12
+	defaultGridPower     = 2.0
+)
+
+type GridPoint struct {
+	X float64
+	Y float64
+	Z float64
+}
+
+func (p *GridPoint) Dimensions() int {
+	return 2
+}
+
+func (p *GridPoint) Dimension(i int) float64 {
+	if i == 0 {
+		return p.X
+	}
+	return p.Y
+}
+
+type GridOptions struct {
+	Method GridMethod
+	// Radius limits the search around each node, zero means unlimited.
+	Radius float64
+	// MinPoints is the number of points a node needs, fewer gives nodata.
+	MinPoints int
+	// MaxPoints is the number of nearest points looked at per node.
+	MaxPoints int
+	// Power is the inverse distance exponent.
+	Power float64
+}
+
+var (
+	xyzXNames = []string{"x", "lon", "long", "longitude", "easting", "east", "e"}
+	xyzYNames = []string{"y", "lat", "latitude", "northing", "north", "n"}
+	xyzZNames = []string{"z", "elev", "elevation", "height", "h", "alt", "altitude", "value"}
+)
+
+func splitXYZFields(line string) []string {
+	return strings.FieldsFunc(line, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t'
+	})
+}
+
+func xyzColumn(header []string, names []string) int {
+	for i, h := range header {
+		h = strings.ToLower(strings.Trim(h, `"' `))
+		for _, n := range names {
+			if h == n {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// ReadXYZPoints reads whitespace, comma or semicolon separated points. The
+// columns are x, y and z unless a header names them, lines starting with #
+// are skipped.
+func ReadXYZPoints(reader io.Reader) ([]GridPoint, error) {
+	scanner := bufio.NewScanner(reader)
+	cols := [3]int{0, 1, 2}
+	points := []GridPoint{}
+	first := true
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := splitXYZFields(line)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("line %d: no columns", n)
+		}
+		if first {
+			first = false
+			if _, err := strconv.ParseFloat(fields[0], 64); err != nil {
+				cols = [3]int{xyzColumn(fields, xyzXNames), xyzColumn(fields, xyzYNames), xyzColumn(fields, xyzZNames)}
+				if cols[0] < 0 || cols[1] < 0 || cols[2] < 0 {
+					return nil, fmt.Errorf("line %d: header has no x, y and z columns", n)
+				}
+				continue
+			}
+		}
+		var p [3]float64
+		for i, c := range cols {
+			if c >= len(fields) {
+				return nil, fmt.Errorf("line %d: expected at least %d columns", n, c+1)
+			}
+			v, err := strconv.ParseFloat(fields[c], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			p[i] = v
+		}
+		points = append(points, GridPoint{X: p[0], Y: p[1], Z: p[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+func LoadXYZPoints(fileName string) ([]GridPoint, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadXYZPoints(f)
+}
+
+// GridRaster interpolates scattered points at the pixel centers of a grid,
+// lines are computed when they are fetched.
+type GridRaster struct {
+	tree         *KDTree
+	options      GridOptions
+	width        int
+	height       int
+	geoTransform [6]float64
+	srs          geo.Proj
+	nodata       *float64
+	rng          [2]float64
+	lock         sync.Mutex
+}
+
+func NewGridRaster(points []GridPoint, geoTransform [6]float64, width, height int, srs geo.Proj, options GridOptions) *GridRaster {
+	if len(points) == 0 || width <= 0 || height <= 0 {
+		return nil
+	}
+	if options.MaxPoints <= 0 {
+		options.MaxPoints = defaultGridMaxPoints
+	}
+	if options.Method == GRID_NEAREST {
+		options.MaxPoints = 1
+	}
+	if options.MinPoints > options.MaxPoints {
+		options.MaxPoints = options.MinPoints
+	}
+	if options.Power <= 0 {
+		options.Power = defaultGridPower
+	}
+
+	kp := make([]KDPoint, len(points))
+	rng := [2]float64{math.MaxFloat64, -math.MaxFloat64}
+	for i := range points {
+		kp[i] = &points[i]
+		rng[0], rng[1] = math.Min(rng[0], points[i].Z), math.Max(rng[1], points[i].Z)
+	}
+	nodata := defaultNoData
+	return &GridRaster{tree: NewKDTree(kp), options: options, width: width, height: height, geoTransform: geoTransform, srs: srs, nodata: &nodata, rng: rng}
+}
+
+// NewGridRasterWithResolution covers the extent of the points with square pixels of res.
+func NewGridRasterWithResolution(points []GridPoint, res float64, srs geo.Proj, options GridOptions) *GridRaster {
+	if len(points) == 0 || res <= 0 {
+		return nil
+	}
+	bbox := vec2d.Rect{Min: vec2d.MaxVal, Max: vec2d.MinVal}
+	for i := range points {
+		bbox.Extend(&vec2d.T{points[i].X, points[i].Y})
+	}
+	width := int(math.Floor((bbox.Max[0]-bbox.Min[0])/res)) + 1
+	height := int(math.Floor((bbox.Max[1]-bbox.Min[1])/res)) + 1
+	gt := [6]float64{bbox.Min[0] - res/2, res, 0, bbox.Max[1] + res/2, 0, -res}
+	return NewGridRaster(points, gt, width, height, srs, options)
+}
+
+func (r *GridRaster) neighbours(q *GridPoint) []*GridPoint {
+	found := r.tree.KNN(q, r.options.MaxPoints)
+	ret := make([]*GridPoint, 0, len(found))
+	for _, p := range found {
+		gp := p.(*GridPoint)
+		if r.options.Radius > 0 && math.Hypot(gp.X-q.X, gp.Y-q.Y) > r.options.Radius {
+			break
+		}
+		ret = append(ret, gp)
+	}
+	if r.options.Method != GRID_NATURAL {
+		return ret
+	}
+
+	// drop points behind the bisector between the node and a closer point
+	kept := ret[:0]
+	for _, p := range ret {
+		px, py := p.X-q.X, p.Y-q.Y
+		shadowed := false
+		for _, k := range kept {
+			kx, ky := k.X-q.X, k.Y-q.Y
+			if px*kx+py*ky > kx*kx+ky*ky {
+				shadowed = true
+				break
+			}
+		}
+		if !shadowed {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+func (r *GridRaster) interpolate(x, y float64) float64 {
+	q := &GridPoint{X: x, Y: y}
+	points := r.neighbours(q)
+	if len(points) == 0 || len(points) < r.options.MinPoints {
+		return *r.nodata
+	}
+	if r.options.Method == GRID_NEAREST {
+		return points[0].Z
+	}
+	sum, wsum := 0.0, 0.0
+	for _, p := range points {
+		d := math.Hypot(p.X-x, p.Y-y)
+		if d < 1e-12 {
+			return p.Z
+		}
+		w := 1 / math.Pow(d, r.options.Power)
+		sum += p.Z * w
+		wsum += w
+	}
+	return sum / wsum
+}
+
+func (r *GridRaster) center(x, y int) (float64, float64) {
+	gt := r.geoTransform
+	px, py := float64(x)+0.5, float64(y)+0.5
+	return gt[0] + gt[1]*px + gt[2]*py, gt[3] + gt[4]*px + gt[5]*py
+}
+
+func (r *GridRaster) Size() (w, h int) {
+	return r.width, r.height
+}
+
+func (r *GridRaster) Elevation(x, y int) float64 {
+	if x < 0 || y < 0 || x >= r.width || y >= r.height {
+		return math.NaN()
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.interpolate(r.center(x, y))
+}
+
+func (r *GridRaster) FetchLine(y int, line []float64) error {
+	if y < 0 || y >= r.height {
+		return errors.New("line out of range")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for x := range line {
+		if x >= r.width {
+			break
+		}
+		line[x] = r.interpolate(r.center(x, y))
+	}
+	return nil
+}
+
+func (r *GridRaster) Srs() geo.Proj {
+	return r.srs
+}
+
+func (r *GridRaster) Bounds() vec2d.Rect {
+	return geoTransformBounds(r.geoTransform, r.width, r.height)
+}
+
+func (r *GridRaster) NoData() *float64 {
+	return r.nodata
+}
+
+func (r *GridRaster) GeoTransform() [6]float64 {
+	return r.geoTransform
+}
+
+// Range is the range of the point values, every method interpolates within it.
+func (r *GridRaster) Range() [2]float64 {
+	return r.rng
+}
@@ -0,0 +1,94 @@
+package contour
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// 测试读取带表头和不带表头的 XYZ/CSV 点
+func TestReadXYZPoints(t *testing.T) {
+	points, err := ReadXYZPoints(strings.NewReader("# survey\n1 2 3\n4\t5\t6\n\n7,8,9\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 3 || points[1] != (GridPoint{4, 5, 6}) || points[2] != (GridPoint{7, 8, 9}) {
+		t.Errorf("unexpected points %v", points)
+	}
+
+	points, err = ReadXYZPoints(strings.NewReader("id;Elevation;Easting;Northing\n1;100.5;500000;4000000\n2;101;500010;4000000\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[0] != (GridPoint{500000, 4000000, 100.5}) {
+		t.Errorf("unexpected points %v", points)
+	}
+
+	if _, err := ReadXYZPoints(strings.NewReader("a,b,c\n1,2,3\n")); err == nil {
+		t.Error("expected error for unknown header")
+	}
+	if _, err := ReadXYZPoints(strings.NewReader("1 2\n")); err == nil {
+		t.Error("expected error for short line")
+	}
+	for _, input := range []string{",,,\n1,2,3\n", "1;2;3\n;;\n"} {
+		if _, err := ReadXYZPoints(strings.NewReader(input)); err == nil {
+			t.Errorf("expected error for separator only line in %q", input)
+		}
+	}
+}
+
+// 测试最近邻、反距离加权和自然邻域风格插值
+func TestGridRaster(t *testing.T) {
+	points := []GridPoint{}
+	for y := 0; y <= 100; y += 10 {
+		for x := 0; x <= 100; x += 10 {
+			points = append(points, GridPoint{float64(x), float64(y), float64(x + 2*y)})
+		}
+	}
+
+	for _, method := range []GridMethod{GRID_NEAREST, GRID_IDW, GRID_NATURAL} {
+		r := NewGridRasterWithResolution(points, 5, nil, GridOptions{Method: method, Radius: 15})
+		if r == nil {
+			t.Fatal("failed to grid points")
+		}
+		if w, h := r.Size(); w != 21 || h != 21 {
+			t.Fatalf("unexpected size %dx%d", w, h)
+		}
+		if gt := r.GeoTransform(); gt != [6]float64{-2.5, 5, 0, 102.5, 0, -5} {
+			t.Errorf("unexpected geotransform %v", gt)
+		}
+		// 像元 (2,18) 的中心正好位于点 (10,10) 上
+		if v := r.Elevation(2, 18); v != 30 {
+			t.Errorf("method %d: expected 30 at a point, got %f", method, v)
+		}
+		line := make([]float64, 21)
+		if err := r.FetchLine(17, line); err != nil {
+			t.Fatal(err)
+		}
+		// (15,15) 四个最近点的平均值为 45
+		if v := line[3]; method != GRID_NEAREST && math.Abs(v-45) > 1e-9 {
+			t.Errorf("method %d: expected 45 between points, got %f", method, v)
+		}
+		if rng := r.Range(); rng[0] != 0 || rng[1] != 300 {
+			t.Errorf("unexpected range %v", rng)
+		}
+	}
+
+	sparse := NewGridRaster(points, [6]float64{200, 10, 0, 200, 0, -10}, 2, 2, nil, GridOptions{Method: GRID_IDW, Radius: 50, MinPoints: 3})
+	if v := sparse.Elevation(0, 0); v != *sparse.NoData() {
+		t.Errorf("expected nodata outside search radius, got %f", v)
+	}
+	near := NewGridRaster(points, [6]float64{95, 10, 0, 105, 0, -10}, 1, 1, nil, GridOptions{Method: GRID_IDW, Radius: 8, MinPoints: 2})
+	if v := near.Elevation(0, 0); v != *near.NoData() {
+		t.Errorf("expected nodata with too few points, got %f", v)
+	}
+
+	r := NewGridRasterWithResolution(points, 2, nil, GridOptions{Method: GRID_IDW})
+	writer := NewMockGeometryWriter()
+	if err := ContourGenerate(r, writer, ContourGenerateOptions{Base: 0, Interval: 50}); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.writtenGeom) == 0 {
+		t.Error("expected contours from gridded points")
+	}
+}
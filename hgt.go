@@ -0,0 +1,175 @@
+package contour
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/flywave/go-geo"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+const (
+	HGT_VOID  = -32768
+	HGT_SRTM1 = 3601
+	HGT_SRTM3 = 1201
+)
+
+var (
+	hgtNamePattern = regexp.MustCompile(`(?i)([NS])(\d{1,2})([EW])(\d{1,3})`)
+	srs4326        geo.Proj
+)
+
+func init() {
+	srs4326 = geo.NewProj(4326)
+}
+
+type HgtRaster struct {
+	BilRaster
+	lat int
+	lon int
+}
+
+func HgtFileName(lat, lon int) string {
+	ns, ew := "N", "E"
+	if lat < 0 {
+		ns, lat = "S", -lat
+	}
+	if lon < 0 {
+		ew, lon = "W", -lon
+	}
+	return fmt.Sprintf("%s%02d%s%03d.hgt", ns, lat, ew, lon)
+}
+
+// ParseHgtFileName returns the latitude and longitude of the south west corner encoded in the name.
+func ParseHgtFileName(fileName string) (lat, lon int, err error) {
+	m := hgtNamePattern.FindStringSubmatch(filepath.Base(fileName))
+	if m == nil {
+		return 0, 0, fmt.Errorf("%s is not a hgt tile name", fileName)
+	}
+	lat, _ = strconv.Atoi(m[2])
+	lon, _ = strconv.Atoi(m[4])
+	if strings.EqualFold(m[1], "S") {
+		lat = -lat
+	}
+	if strings.EqualFold(m[3], "W") {
+		lon = -lon
+	}
+	return lat, lon, nil
+}
+
+func NewHgtRaster(fileName string) *HgtRaster {
+	lat, lon, err := ParseHgtFileName(fileName)
+	if err != nil {
+		return nil
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil
+	}
+
+	size := 0
+	for _, n := range []int{HGT_SRTM1, HGT_SRTM3} {
+		if info.Size() == int64(n*n*2) {
+			size = n
+		}
+	}
+	if size == 0 {
+		f.Close()
+		return nil
+	}
+
+	res := 1.0 / float64(size-1)
+	nodata := float64(HGT_VOID)
+	header := &BilHeader{
+		NCols:         size,
+		NRows:         size,
+		NBands:        1,
+		NBits:         16,
+		SampleFormat:  tiffSampleFormatInt,
+		ByteOrder:     binary.BigEndian,
+		Layout:        BIL_LAYOUT_BIL,
+		BandRowBytes:  int64(size * 2),
+		TotalRowBytes: int64(size * 2),
+		GeoTransform:  [6]float64{float64(lon) - res/2, res, 0, float64(lat+1) + res/2, 0, -res},
+		NoData:        &nodata,
+	}
+	return &HgtRaster{BilRaster: BilRaster{file: f, header: header, srs: srs4326}, lat: lat, lon: lon}
+}
+
+func (r *HgtRaster) SouthWest() (lat, lon int) {
+	return r.lat, r.lon
+}
+
+type HgtLoader struct {
+	basepath string
+}
+
+func NewHgtLoader(basepath string) RasterLoader {
+	return &HgtLoader{basepath: basepath}
+}
+
+func (l *HgtLoader) file(lat, lon int) string {
+	name := HgtFileName(lat, lon)
+	for _, n := range []string{name, strings.ToLower(name)} {
+		file := path.Join(l.basepath, n)
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	return ""
+}
+
+// Load uses coord[0] as the longitude and coord[1] as the latitude of the south west corner.
+func (l *HgtLoader) Load(coord [3]int) Raster {
+	file := l.file(coord[1], coord[0])
+	if file == "" {
+		return nil
+	}
+	if r := NewHgtRaster(file); r != nil {
+		return r
+	}
+	return nil
+}
+
+// HgtRasterProvider walks the one degree tiles of a bbox that have a file,
+// the coords are longitude, latitude and zero.
+type HgtRasterProvider struct {
+	TiledRasterProvider
+	hgt *HgtLoader
+}
+
+func NewHgtRasterProvider(basepath string, bbox vec2d.Rect, bboxSrs geo.Proj) RasterProvider {
+	loader := &HgtLoader{basepath: basepath}
+	p := &HgtRasterProvider{TiledRasterProvider: TiledRasterProvider{loader: loader, bbox: bbox, bboxSrs: bboxSrs}, hgt: loader}
+	p.caclTiles()
+	return p
+}
+
+func (p *HgtRasterProvider) caclTiles() {
+	bbox := p.bbox
+	if p.bboxSrs != nil && !p.bboxSrs.Eq(srs4326) {
+		bbox = p.bboxSrs.TransformRectTo(srs4326, bbox, 16)
+	}
+
+	p.coords = [][3]int{}
+	for lat := int(math.Floor(bbox.Min[1])); float64(lat) < bbox.Max[1]; lat++ {
+		for lon := int(math.Floor(bbox.Min[0])); float64(lon) < bbox.Max[0]; lon++ {
+			if p.hgt.file(lat, lon) != "" {
+				p.coords = append(p.coords, [3]int{lon, lat, 0})
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package contour
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+// 测试 SRTM 文件名解析
+func TestHgtFileName(t *testing.T) {
+	if HgtFileName(47, 11) != "N47E011.hgt" || HgtFileName(-3, -60) != "S03W060.hgt" {
+		t.Errorf("unexpected names %s %s", HgtFileName(47, 11), HgtFileName(-3, -60))
+	}
+	lat, lon, err := ParseHgtFileName("/data/s03w060.hgt")
+	if err != nil || lat != -3 || lon != -60 {
+		t.Errorf("unexpected parse result %d %d %v", lat, lon, err)
+	}
+	if _, _, err := ParseHgtFileName("dem.hgt"); err == nil {
+		t.Error("expected error for invalid name")
+	}
+}
+
+// 测试 HGT 栅格与按范围选择文件
+func TestHgtRasterProvider(t *testing.T) {
+	dir := t.TempDir()
+	size := HGT_SRTM3
+	data := make([]byte, 2*size*size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			binary.BigEndian.PutUint16(data[2*(y*size+x):], uint16(int16(y+x%2)))
+		}
+	}
+	void := int16(HGT_VOID)
+	binary.BigEndian.PutUint16(data[2*(size+1):], uint16(void))
+	os.WriteFile(filepath.Join(dir, "N47E011.hgt"), data, 0644)
+
+	r := NewHgtRaster(filepath.Join(dir, "N47E011.hgt"))
+	if r == nil {
+		t.Fatal("failed to open hgt")
+	}
+	defer r.Close()
+	if w, h := r.Size(); w != size || h != size {
+		t.Errorf("unexpected size %dx%d", w, h)
+	}
+	res := 1.0 / float64(size-1)
+	if gt := r.GeoTransform(); gt != [6]float64{11 - res/2, res, 0, 48 + res/2, 0, -res} {
+		t.Errorf("unexpected geotransform %v", gt)
+	}
+	if r.Elevation(1, 0) != 1 || r.Elevation(0, 2) != 2 || r.Elevation(1, 1) != HGT_VOID {
+		t.Errorf("unexpected elevations %f %f %f", r.Elevation(1, 0), r.Elevation(0, 2), r.Elevation(1, 1))
+	}
+	if rng := r.Range(); rng[0] != 0 || rng[1] != float64(size) {
+		t.Errorf("unexpected range %v", rng)
+	}
+
+	// 大小不是 SRTM1 或 SRTM3 的文件被拒绝
+	os.WriteFile(filepath.Join(dir, "N10E011.hgt"), data[:18], 0644)
+	if NewHgtRaster(filepath.Join(dir, "N10E011.hgt")) != nil {
+		t.Error("expected nil raster for unexpected file size")
+	}
+
+	pr := NewHgtRasterProvider(dir, vec2d.Rect{Min: vec2d.T{10.5, 46.5}, Max: vec2d.T{11.5, 47.5}}, nil)
+	n := 0
+	for pr.HasNext() {
+		if pr.Next() == nil {
+			t.Error("expected hgt raster")
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("expected 1 tile, got %d", n)
+	}
+	pr.Reset()
+	if !pr.HasNext() {
+		t.Error("expected tiles after reset")
+	}
+}
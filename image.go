@@ -0,0 +1,144 @@
+package contour
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/flywave/go-geo"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+// ImageDecoder maps a pixel to a value, false marks the pixel as nodata.
+type ImageDecoder func(c color.Color) (float64, bool)
+
+// GrayDecoder returns scale * level + offset, the level is 8 bit for
+// image.Gray, 16 bit for image.Gray16 and the 16 bit luminance otherwise.
+// Fully transparent pixels are nodata.
+func GrayDecoder(scale, offset float64) ImageDecoder {
+	return func(c color.Color) (float64, bool) {
+		switch g := c.(type) {
+		case color.Gray:
+			return float64(g.Y)*scale + offset, true
+		case color.Gray16:
+			return float64(g.Y)*scale + offset, true
+		}
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return 0, false
+		}
+		return float64(color.Gray16Model.Convert(c).(color.Gray16).Y)*scale + offset, true
+	}
+}
+
+// RGBDecoder decodes 8 bit channels with an unpack vector as returned by
+// MapBoxUnpack, value = R * u[0] + G * u[1] + B * u[2] - u[3].
+func RGBDecoder(unpack [4]float64) ImageDecoder {
+	return func(c color.Color) (float64, bool) {
+		v := color.NRGBAModel.Convert(c).(color.NRGBA)
+		if v.A == 0 {
+			return 0, false
+		}
+		return float64(v.R)*unpack[0] + float64(v.G)*unpack[1] + float64(v.B)*unpack[2] - unpack[3], true
+	}
+}
+
+// TerrainRGBDecoder decodes the Mapbox or Terrarium encoding of DEM tiles.
+func TerrainRGBDecoder(encoding int) ImageDecoder {
+	return RGBDecoder(encodingUnpack(encoding))
+}
+
+// ImageRaster reads the values of an in memory image through a decoder.
+// Pixels the decoder rejects are NaN and the raster has no nodata value, so
+// every decoded value stays valid.
+type ImageRaster struct {
+	img          image.Image
+	decode       ImageDecoder
+	width        int
+	height       int
+	geoTransform [6]float64
+	srs          geo.Proj
+	rng          *[2]float64
+}
+
+func NewImageRaster(img image.Image, decode ImageDecoder, geoTransform [6]float64, srs geo.Proj) *ImageRaster {
+	if img == nil || decode == nil {
+		return nil
+	}
+	b := img.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 {
+		return nil
+	}
+	return &ImageRaster{img: img, decode: decode, width: b.Dx(), height: b.Dy(), geoTransform: geoTransform, srs: srs}
+}
+
+func (r *ImageRaster) Image() image.Image {
+	return r.img
+}
+
+func (r *ImageRaster) value(x, y int) float64 {
+	min := r.img.Bounds().Min
+	if v, ok := r.decode(r.img.At(min.X+x, min.Y+y)); ok {
+		return v
+	}
+	return math.NaN()
+}
+
+func (r *ImageRaster) Size() (w, h int) {
+	return r.width, r.height
+}
+
+func (r *ImageRaster) Elevation(x, y int) float64 {
+	if x < 0 || y < 0 || x >= r.width || y >= r.height {
+		return math.NaN()
+	}
+	return r.value(x, y)
+}
+
+func (r *ImageRaster) FetchLine(y int, line []float64) error {
+	if y < 0 || y >= r.height {
+		return errors.New("line out of range")
+	}
+	for x := range line {
+		if x >= r.width {
+			break
+		}
+		line[x] = r.value(x, y)
+	}
+	return nil
+}
+
+func (r *ImageRaster) Srs() geo.Proj {
+	return r.srs
+}
+
+func (r *ImageRaster) Bounds() vec2d.Rect {
+	return geoTransformBounds(r.geoTransform, r.width, r.height)
+}
+
+func (r *ImageRaster) NoData() *float64 {
+	return nil
+}
+
+func (r *ImageRaster) GeoTransform() [6]float64 {
+	return r.geoTransform
+}
+
+func (r *ImageRaster) Range() [2]float64 {
+	if r.rng != nil {
+		return *r.rng
+	}
+	min, max := math.MaxFloat64, -math.MaxFloat64
+	for y := 0; y < r.height; y++ {
+		for x := 0; x < r.width; x++ {
+			d := r.value(x, y)
+			if math.IsNaN(d) {
+				continue
+			}
+			min, max = math.Min(min, d), math.Max(max, d)
+		}
+	}
+	r.rng = &[2]float64{min, max}
+	return *r.rng
+}
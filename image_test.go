@@ -0,0 +1,76 @@
+package contour
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/flywave/go-mapbox/raster"
+)
+
+// 测试 Gray16 图像的灰度映射
+func TestImageRasterGray(t *testing.T) {
+	img := image.NewGray16(image.Rect(10, 20, 14, 23))
+	for y := 20; y < 23; y++ {
+		for x := 10; x < 14; x++ {
+			img.SetGray16(x, y, color.Gray16{Y: uint16(1000 * (x - 10 + y - 20))})
+		}
+	}
+	gt := [6]float64{100, 1, 0, 50, 0, -1}
+	r := NewImageRaster(img, GrayDecoder(0.1, -5), gt, srs4326)
+	if r == nil {
+		t.Fatal("expected raster")
+	}
+	if w, h := r.Size(); w != 4 || h != 3 {
+		t.Fatalf("unexpected size %d x %d", w, h)
+	}
+	if v := r.Elevation(3, 2); v != 495 {
+		t.Fatalf("expected 495, got %v", v)
+	}
+	line := make([]float64, 4)
+	if err := r.FetchLine(1, line); err != nil || line[0] != 95 {
+		t.Fatalf("unexpected line %v %v", line, err)
+	}
+	if rng := r.Range(); rng[0] != -5 || rng[1] != 495 {
+		t.Fatalf("unexpected range %v", rng)
+	}
+	if b := r.Bounds(); b.Min[0] != 100 || b.Max[1] != 50 || b.Max[0] != 104 || b.Min[1] != 47 {
+		t.Fatalf("unexpected bounds %v", b)
+	}
+
+	gray := image.NewGray(image.Rect(0, 0, 1, 1))
+	gray.SetGray(0, 0, color.Gray{Y: 200})
+	if v := NewImageRaster(gray, GrayDecoder(1, 0), gt, nil).Elevation(0, 0); v != 200 {
+		t.Fatalf("expected 8 bit level 200, got %v", v)
+	}
+}
+
+// 测试 terrain-rgb 解码和透明像元
+func TestImageRasterTerrainRGB(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	// (1 * 65536 + 2 * 256 + 3) * 0.1 - 10000
+	img.SetNRGBA(0, 0, color.NRGBA{R: 1, G: 2, B: 3, A: 255})
+	img.SetNRGBA(1, 0, color.NRGBA{})
+	r := NewImageRaster(img, TerrainRGBDecoder(raster.DEM_ENCODING_MAPBOX), [6]float64{0, 1, 0, 0, 0, -1}, nil)
+	if v := r.Elevation(0, 0); math.Abs(v-(-3394.9)) > 1e-6 {
+		t.Fatalf("expected -3394.9, got %v", v)
+	}
+	if v := r.Elevation(1, 0); !math.IsNaN(v) || r.NoData() != nil {
+		t.Fatalf("expected NaN without nodata, got %v %v", v, r.NoData())
+	}
+
+	// 解码值恰为 -9999 时仍然有效
+	gray := image.NewGray(image.Rect(0, 0, 2, 1))
+	gray.SetGray(1, 0, color.Gray{Y: 1})
+	dem := NewImageRaster(gray, GrayDecoder(1, defaultNoData), [6]float64{0, 1, 0, 0, 0, -1}, nil)
+	if v := dem.Elevation(0, 0); v != defaultNoData {
+		t.Fatalf("expected %v, got %v", defaultNoData, v)
+	}
+	if rng := dem.Range(); rng[0] != defaultNoData || rng[1] != defaultNoData+1 {
+		t.Fatalf("unexpected range %v", rng)
+	}
+	if NewImageRaster(img, nil, [6]float64{}, nil) != nil {
+		t.Fatal("expected nil without decoder")
+	}
+}
@@ -0,0 +1,363 @@
+package contour
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/flywave/go-geo"
+)
+
+const (
+	LAS_CLASS_GROUND = 2
+
+	lasHeaderSize12 = 227
+	lasHeaderSize14 = 375
+	lasVlrHeaderLen = 54
+)
+
+// lasPointSizes is the minimum record length of the point formats 0 to 10.
+var lasPointSizes = [11]int{20, 28, 26, 34, 57, 63, 30, 36, 38, 59, 67}
+
+type LASHeader struct {
+	VersionMajor       uint8
+	VersionMinor       uint8
+	SystemIdentifier   string
+	GeneratingSoftware string
+	HeaderSize         uint16
+	OffsetToPoints     uint32
+	NumberOfVLRs       uint32
+	PointFormat        uint8
+	PointRecordLength  uint16
+	PointCount         uint64
+	Scale              [3]float64
+	Offset             [3]float64
+	Min                [3]float64
+	Max                [3]float64
+	// EPSG and WKT come from the projection records, when present.
+	EPSG int
+	WKT  string
+}
+
+// Srs returns the projection declared by the file or nil.
+func (h *LASHeader) Srs() geo.Proj {
+	if h.WKT != "" {
+		if srs := parseSrs(h.WKT); srs != nil {
+			return srs
+		}
+	}
+	if h.EPSG > 0 {
+		return geo.NewProj(h.EPSG)
+	}
+	return nil
+}
+
+type LASPoint struct {
+	X               float64
+	Y               float64
+	Z               float64
+	Intensity       uint16
+	ReturnNumber    uint8
+	NumberOfReturns uint8
+	Classification  uint8
+	Synthetic       bool
+	KeyPoint        bool
+	Withheld        bool
+	ScanAngle       float64
+	PointSourceID   uint16
+	GPSTime         float64
+	Red             uint16
+	Green           uint16
+	Blue            uint16
+}
+
+func lasString(b []byte) string {
+	return strings.TrimRight(string(b), "\x00 ")
+}
+
+// ReadLASHeader reads the public header block and the projection records,
+// the reader is left at an unspecified position.
+func ReadLASHeader(reader io.ReadSeeker) (*LASHeader, error) {
+	buf := make([]byte, lasHeaderSize14)
+	n, err := io.ReadFull(reader, buf)
+	if err != nil && n < lasHeaderSize12 {
+		return nil, errors.New("las header is truncated")
+	}
+	if string(buf[0:4]) != "LASF" {
+		return nil, errors.New("not a las file")
+	}
+	le := binary.LittleEndian
+	h := &LASHeader{
+		VersionMajor:       buf[24],
+		VersionMinor:       buf[25],
+		SystemIdentifier:   lasString(buf[26:58]),
+		GeneratingSoftware: lasString(buf[58:90]),
+		HeaderSize:         le.Uint16(buf[94:]),
+		OffsetToPoints:     le.Uint32(buf[96:]),
+		NumberOfVLRs:       le.Uint32(buf[100:]),
+		PointFormat:        buf[104],
+		PointRecordLength:  le.Uint16(buf[105:]),
+		PointCount:         uint64(le.Uint32(buf[107:])),
+	}
+	for i := 0; i < 3; i++ {
+		h.Scale[i] = math.Float64frombits(le.Uint64(buf[131+8*i:]))
+		h.Offset[i] = math.Float64frombits(le.Uint64(buf[155+8*i:]))
+		h.Max[i] = math.Float64frombits(le.Uint64(buf[179+16*i:]))
+		h.Min[i] = math.Float64frombits(le.Uint64(buf[187+16*i:]))
+	}
+	if h.VersionMajor != 1 || h.VersionMinor > 4 {
+		return nil, fmt.Errorf("unsupported las version %d.%d", h.VersionMajor, h.VersionMinor)
+	}
+	if h.PointFormat&0x80 != 0 {
+		return nil, errors.New("compressed laz points are not supported")
+	}
+	h.PointFormat &= 0x3f
+	if int(h.PointFormat) >= len(lasPointSizes) {
+		return nil, fmt.Errorf("unsupported point format %d", h.PointFormat)
+	}
+	if int(h.PointRecordLength) < lasPointSizes[h.PointFormat] {
+		return nil, fmt.Errorf("point record length %d is too short for format %d", h.PointRecordLength, h.PointFormat)
+	}
+	if h.VersionMinor >= 4 && h.HeaderSize >= lasHeaderSize14 && n >= lasHeaderSize14 {
+		if count := le.Uint64(buf[247:]); count > 0 {
+			h.PointCount = count
+		}
+	}
+
+	if _, err := reader.Seek(int64(h.HeaderSize), io.SeekStart); err != nil {
+		return nil, err
+	}
+	vlr := make([]byte, lasVlrHeaderLen)
+	for i := uint32(0); i < h.NumberOfVLRs; i++ {
+		if _, err := io.ReadFull(reader, vlr); err != nil {
+			break
+		}
+		user, id, length := lasString(vlr[2:18]), le.Uint16(vlr[18:]), int64(le.Uint16(vlr[20:]))
+		if user != "LASF_Projection" || (id != 34735 && id != 2112) {
+			if _, err := reader.Seek(length, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			break
+		}
+		if id == 2112 {
+			h.WKT = lasString(data)
+		} else {
+			h.EPSG = lasGeoKeysEPSG(data)
+		}
+	}
+	return h, nil
+}
+
+// lasGeoKeysEPSG reads the projected or geographic type key of a GeoTIFF key directory.
+func lasGeoKeysEPSG(data []byte) int {
+	le := binary.LittleEndian
+	if len(data) < 8 {
+		return 0
+	}
+	keys := int(le.Uint16(data[6:]))
+	geographic := 0
+	for i := 0; i < keys && 8+8*i+8 <= len(data); i++ {
+		entry := data[8+8*i:]
+		id, location, value := le.Uint16(entry), le.Uint16(entry[2:]), int(le.Uint16(entry[6:]))
+		if location != 0 || value == 0 || value == 32767 {
+			continue
+		}
+		switch id {
+		case 3072:
+			return value
+		case 2048:
+			geographic = value
+		}
+	}
+	return geographic
+}
+
+func (h *LASHeader) decodePoint(rec []byte, p *LASPoint) {
+	le := binary.LittleEndian
+	p.X = float64(int32(le.Uint32(rec[0:])))*h.Scale[0] + h.Offset[0]
+	p.Y = float64(int32(le.Uint32(rec[4:])))*h.Scale[1] + h.Offset[1]
+	p.Z = float64(int32(le.Uint32(rec[8:])))*h.Scale[2] + h.Offset[2]
+	p.Intensity = le.Uint16(rec[12:])
+
+	rgb := -1
+	if h.PointFormat < 6 {
+		p.ReturnNumber = rec[14] & 0x07
+		p.NumberOfReturns = (rec[14] >> 3) & 0x07
+		p.Classification = rec[15] & 0x1f
+		p.Synthetic = rec[15]&0x20 != 0
+		p.KeyPoint = rec[15]&0x40 != 0
+		p.Withheld = rec[15]&0x80 != 0
+		p.ScanAngle = float64(int8(rec[16]))
+		p.PointSourceID = le.Uint16(rec[18:])
+		switch h.PointFormat {
+		case 1, 4:
+			p.GPSTime = math.Float64frombits(le.Uint64(rec[20:]))
+		case 2:
+			rgb = 20
+		case 3, 5:
+			p.GPSTime = math.Float64frombits(le.Uint64(rec[20:]))
+			rgb = 28
+		}
+	} else {
+		p.ReturnNumber = rec[14] & 0x0f
+		p.NumberOfReturns = rec[14] >> 4
+		p.Synthetic = rec[15]&0x01 != 0
+		p.KeyPoint = rec[15]&0x02 != 0
+		p.Withheld = rec[15]&0x04 != 0
+		p.Classification = rec[16]
+		p.ScanAngle = float64(int16(le.Uint16(rec[18:]))) * 0.006
+		p.PointSourceID = le.Uint16(rec[20:])
+		p.GPSTime = math.Float64frombits(le.Uint64(rec[22:]))
+		if h.PointFormat == 7 || h.PointFormat == 8 || h.PointFormat == 10 {
+			rgb = 30
+		}
+	}
+	if rgb >= 0 {
+		p.Red, p.Green, p.Blue = le.Uint16(rec[rgb:]), le.Uint16(rec[rgb+2:]), le.Uint16(rec[rgb+4:])
+	}
+}
+
+// ReadLASPoints streams every point record of an uncompressed LAS 1.0 to 1.4
+// file to fn, the point is reused between calls.
+func ReadLASPoints(reader io.ReadSeeker, fn func(p *LASPoint) error) (*LASHeader, error) {
+	h, err := ReadLASHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := reader.Seek(int64(h.OffsetToPoints), io.SeekStart); err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewReaderSize(reader, 1<<16)
+	rec := make([]byte, h.PointRecordLength)
+	p := &LASPoint{}
+	for i := uint64(0); i < h.PointCount; i++ {
+		if _, err := io.ReadFull(buffered, rec); err != nil {
+			return h, fmt.Errorf("point %d: %v", i, err)
+		}
+		*p = LASPoint{}
+		h.decodePoint(rec, p)
+		if err := fn(p); err != nil {
+			return h, err
+		}
+	}
+	return h, nil
+}
+
+type BinMethod uint8
+
+const (
+	BIN_MIN BinMethod = iota
+	BIN_MEAN
+	BIN_MAX
+)
+
+type LASGridOptions struct {
+	Resolution float64
+	Method     BinMethod
+	// Classes are the classifications kept, nil keeps ground points only.
+	Classes []uint8
+	// KeepWithheld also grids points flagged as withheld.
+	KeepWithheld bool
+}
+
+// NewLASRaster grids the points of a LAS file into cells of
+// options.Resolution covering the extent of the header, cells without points
+// are NaN and the raster has no nodata value. A nil srs means the projection declared in the file.
+func NewLASRaster(fileName string, srs geo.Proj, options LASGridOptions) *MemoryRaster {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	r, err := ReadLASRaster(f, srs, options)
+	if err != nil {
+		return nil
+	}
+	return r
+}
+
+func ReadLASRaster(reader io.ReadSeeker, srs geo.Proj, options LASGridOptions) (*MemoryRaster, error) {
+	if options.Resolution <= 0 {
+		return nil, errors.New("resolution must be positive")
+	}
+	h, err := ReadLASHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	res := options.Resolution
+	width := maxInt(1, int(math.Ceil((h.Max[0]-h.Min[0])/res)))
+	height := maxInt(1, int(math.Ceil((h.Max[1]-h.Min[1])/res)))
+	if int64(width)*int64(height) > 1<<31 {
+		return nil, errors.New("grid is too large")
+	}
+	classes := options.Classes
+	if classes == nil {
+		classes = []uint8{LAS_CLASS_GROUND}
+	}
+	var keep [256]bool
+	for _, c := range classes {
+		keep[c] = true
+	}
+
+	data := make([]float64, width*height)
+	var counts []uint32
+	if options.Method == BIN_MEAN {
+		counts = make([]uint32, width*height)
+	}
+	for i := range data {
+		data[i] = math.NaN()
+	}
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	_, err = ReadLASPoints(reader, func(p *LASPoint) error {
+		if !keep[p.Classification] || (p.Withheld && !options.KeepWithheld) {
+			return nil
+		}
+		x := int((p.X - h.Min[0]) / res)
+		y := int((h.Max[1] - p.Y) / res)
+		if x < 0 || y < 0 || x > width || y > height {
+			return nil
+		}
+		i := minInt(y, height-1)*width + minInt(x, width-1)
+		switch {
+		case math.IsNaN(data[i]):
+			data[i] = p.Z
+		case options.Method == BIN_MIN:
+			data[i] = math.Min(data[i], p.Z)
+		case options.Method == BIN_MAX:
+			data[i] = math.Max(data[i], p.Z)
+		default:
+			data[i] += p.Z
+		}
+		if counts != nil {
+			counts[i]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if counts != nil {
+		for i := range data {
+			if !math.IsNaN(data[i]) {
+				data[i] /= float64(counts[i])
+			}
+		}
+	}
+	if srs == nil {
+		srs = h.Srs()
+	}
+	gt := [6]float64{h.Min[0], res, 0, h.Max[1], 0, -res}
+	return NewMemoryRaster(data, width, height, gt, srs, nil), nil
+}
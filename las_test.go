@@ -0,0 +1,153 @@
+package contour
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testLASPoint struct {
+	x, y, z float64
+	class   uint8
+}
+
+// buildTestLAS 生成一个未压缩的 LAS 文件, 带 EPSG 投影记录
+func buildTestLAS(minor, format uint8, epsg int, points []testLASPoint) []byte {
+	le := binary.LittleEndian
+	headerSize := lasHeaderSize12
+	if minor >= 4 {
+		headerSize = lasHeaderSize14
+	}
+	keys := []uint16{1, 1, 0, 1, 3072, 0, 1, uint16(epsg)}
+	vlrLen := lasVlrHeaderLen + 2*len(keys)
+	recLen := lasPointSizes[format] + 2
+
+	header := make([]byte, headerSize)
+	copy(header, "LASF")
+	header[24], header[25] = 1, minor
+	le.PutUint16(header[94:], uint16(headerSize))
+	le.PutUint32(header[96:], uint32(headerSize+vlrLen))
+	le.PutUint32(header[100:], 1)
+	header[104] = format
+	le.PutUint16(header[105:], uint16(recLen))
+	if minor >= 4 {
+		le.PutUint64(header[247:], uint64(len(points)))
+	} else {
+		le.PutUint32(header[107:], uint32(len(points)))
+	}
+	min := [3]float64{math.MaxFloat64, math.MaxFloat64, math.MaxFloat64}
+	max := [3]float64{-math.MaxFloat64, -math.MaxFloat64, -math.MaxFloat64}
+	for _, p := range points {
+		for i, v := range [3]float64{p.x, p.y, p.z} {
+			min[i], max[i] = math.Min(min[i], v), math.Max(max[i], v)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		le.PutUint64(header[131+8*i:], math.Float64bits(0.01))
+		le.PutUint64(header[155+8*i:], math.Float64bits(1000))
+		le.PutUint64(header[179+16*i:], math.Float64bits(max[i]))
+		le.PutUint64(header[187+16*i:], math.Float64bits(min[i]))
+	}
+
+	var b bytes.Buffer
+	b.Write(header)
+	vlr := make([]byte, lasVlrHeaderLen)
+	copy(vlr[2:], "LASF_Projection")
+	le.PutUint16(vlr[18:], 34735)
+	le.PutUint16(vlr[20:], uint16(2*len(keys)))
+	b.Write(vlr)
+	for _, k := range keys {
+		binary.Write(&b, le, k)
+	}
+	for _, p := range points {
+		rec := make([]byte, recLen)
+		le.PutUint32(rec[0:], uint32(int32(math.Round((p.x-1000)/0.01))))
+		le.PutUint32(rec[4:], uint32(int32(math.Round((p.y-1000)/0.01))))
+		le.PutUint32(rec[8:], uint32(int32(math.Round((p.z-1000)/0.01))))
+		rec[14] = 0x09
+		if format < 6 {
+			rec[15] = p.class
+		} else {
+			rec[14] = 0x11
+			rec[16] = p.class
+		}
+		b.Write(rec)
+	}
+	return b.Bytes()
+}
+
+// 测试 LAS 头和点记录的读取
+func TestReadLASPoints(t *testing.T) {
+	for _, c := range []struct{ minor, format uint8 }{{2, 1}, {2, 3}, {4, 6}, {4, 8}} {
+		data := buildTestLAS(c.minor, c.format, 3857, []testLASPoint{{1000.5, 2000.25, 12.34, 2}, {1001, 2001, 15, 5}})
+		var got []LASPoint
+		h, err := ReadLASPoints(bytes.NewReader(data), func(p *LASPoint) error {
+			got = append(got, *p)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("format %d: %v", c.format, err)
+		}
+		if h.PointFormat != c.format || h.PointCount != 2 || h.EPSG != 3857 {
+			t.Fatalf("format %d: unexpected header %+v", c.format, h)
+		}
+		if len(got) != 2 || math.Abs(got[0].X-1000.5) > 1e-9 || math.Abs(got[0].Y-2000.25) > 1e-9 || math.Abs(got[0].Z-12.34) > 1e-9 {
+			t.Fatalf("format %d: unexpected points %+v", c.format, got)
+		}
+		if got[0].Classification != 2 || got[1].Classification != 5 || got[0].ReturnNumber != 1 {
+			t.Fatalf("format %d: unexpected classification %+v", c.format, got)
+		}
+	}
+
+	data := buildTestLAS(2, 1, 3857, nil)
+	data[104] |= 0x80
+	if _, err := ReadLASHeader(bytes.NewReader(data)); err == nil {
+		t.Fatal("expected error for compressed points")
+	}
+}
+
+// 测试地面点格网化
+func TestLASRaster(t *testing.T) {
+	points := []testLASPoint{
+		{1000, 2000, 10, 2}, {1000.5, 2000.5, 14, 2}, {1000.2, 2000.8, 99, 5},
+		{1003, 2003, 20, 2}, {1003.9, 2003.9, 22, 2},
+	}
+	data := buildTestLAS(4, 6, 3857, points)
+	for _, c := range []struct {
+		method BinMethod
+		want   float64
+	}{{BIN_MIN, 10}, {BIN_MEAN, 12}, {BIN_MAX, 14}} {
+		r, err := ReadLASRaster(bytes.NewReader(data), nil, LASGridOptions{Resolution: 1, Method: c.method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w, h := r.Size(); w != 4 || h != 4 {
+			t.Fatalf("unexpected size %d x %d", w, h)
+		}
+		if v := r.Elevation(0, 3); math.Abs(v-c.want) > 1e-9 {
+			t.Fatalf("method %d: expected %v, got %v", c.method, c.want, v)
+		}
+		if v := r.Elevation(1, 1); !math.IsNaN(v) || r.NoData() != nil {
+			t.Fatalf("expected NaN without nodata, got %v %v", v, r.NoData())
+		}
+		if r.Srs() == nil {
+			t.Fatal("expected srs from the file")
+		}
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "ground.las")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewLASRaster(file, srs900913, LASGridOptions{Resolution: 2, Classes: []uint8{2, 5}, Method: BIN_MAX})
+	if r == nil {
+		t.Fatal("expected raster")
+	}
+	if v := r.Elevation(0, 1); v != 99 {
+		t.Fatalf("expected 99, got %v", v)
+	}
+}
@@ -0,0 +1,31 @@
+package contour
+
+// lineCache keeps the most recently fetched lines of a raster for random access.
+type lineCache struct {
+	raster Raster
+	width  int
+	lines  *lruCache[int, []float64]
+}
+
+func newLineCache(r Raster, capacity int) *lineCache {
+	w, _ := r.Size()
+	return &lineCache{raster: r, width: w, lines: newLRUCache[int, []float64](capacity)}
+}
+
+func (c *lineCache) line(y int) ([]float64, error) {
+	if data, ok := c.lines.get(y); ok {
+		return data, nil
+	}
+
+	var data []float64
+	if c.lines.len() >= c.lines.capacity {
+		_, data, _ = c.lines.removeOldest()
+	} else {
+		data = make([]float64, c.width)
+	}
+	if err := c.raster.FetchLine(y, data); err != nil {
+		return nil, err
+	}
+	c.lines.put(y, data)
+	return data, nil
+}
@@ -1,10 +1,13 @@
 package contour
 
 import (
+	"encoding/json"
+	"os"
 	"path"
 	"strconv"
 	"strings"
 
+	"github.com/flywave/go-geo"
 	"github.com/flywave/go-mapbox/raster"
 )
 
@@ -14,42 +17,158 @@ type GeoTiffLoader struct {
 }
 
 func NewGeoTiffLoader(basepath string, template string) RasterLoader {
-	if !strings.Contains(template, "{x}") || !strings.Contains(template, "{y}") || !strings.Contains(template, "{z}") {
+	if !isTileTemplate(template) {
 		return nil
 	}
 	return &GeoTiffLoader{basepath: basepath, template: template}
 }
 
-func (l *GeoTiffLoader) Load(coord [3]int) Raster {
-	template := l.template
+func tileFileName(basepath string, template string, coord [3]int) string {
 	template = strings.Replace(template, "{x}", strconv.Itoa(coord[0]), 1)
 	template = strings.Replace(template, "{y}", strconv.Itoa(coord[1]), 1)
 	template = strings.Replace(template, "{z}", strconv.Itoa(coord[2]), 1)
 
-	file := path.Join(l.basepath, template)
+	return path.Join(basepath, template)
+}
+
+func isTileTemplate(template string) bool {
+	return strings.Contains(template, "{x}") && strings.Contains(template, "{y}") && strings.Contains(template, "{z}")
+}
 
-	return NewGeoTiffRaster(file)
+func (l *GeoTiffLoader) Load(coord [3]int) Raster {
+	file := tileFileName(l.basepath, l.template, coord)
+
+	if r := NewGeoTiffRaster(file); r != nil {
+		return r
+	}
+	return nil
+}
+
+type MapBoxDemOptions struct {
+	Encoding int
+	// Base and Interval override the Mapbox-RGB decoding when Interval is not zero.
+	Base     float64
+	Interval float64
+	// AutoDetect reads the encoding from a tilejson file in the tile directory.
+	AutoDetect bool
+	// Border is the buffer width in pixels baked into each tile image, TileSize
+	// the size without it. Either one is enough, TileSize wins when both are set.
+	Border   int
+	TileSize int
+}
+
+func (o MapBoxDemOptions) unpack() [4]float64 {
+	if o.Encoding == raster.DEM_ENCODING_MAPBOX && o.Interval != 0 {
+		return MapBoxUnpack(o.Base, o.Interval)
+	}
+	return encodingUnpack(o.Encoding)
 }
 
 type MapBoxDemLoader struct {
 	basepath string
 	template string
+	options  MapBoxDemOptions
 }
 
 func NewMapBoxDemLoader(basepath string, template string) RasterLoader {
-	if !strings.Contains(template, "{x}") || !strings.Contains(template, "{y}") || !strings.Contains(template, "{z}") {
+	return NewMapBoxDemLoaderWithOptions(basepath, template, MapBoxDemOptions{Encoding: raster.DEM_ENCODING_MAPBOX})
+}
+
+func NewMapBoxDemLoaderWithOptions(basepath string, template string, options MapBoxDemOptions) RasterLoader {
+	if !isTileTemplate(template) {
 		return nil
 	}
-	return &MapBoxDemLoader{basepath: basepath, template: template}
+	if options.AutoDetect {
+		if e, ok := DetectDemEncoding(basepath); ok {
+			options.Encoding = e
+		}
+	}
+	return &MapBoxDemLoader{basepath: basepath, template: template, options: options}
+}
+
+func (l *MapBoxDemLoader) Encoding() int {
+	return l.options.Encoding
+}
+
+func (l *MapBoxDemLoader) Options() MapBoxDemOptions {
+	return l.options
 }
 
 func (l *MapBoxDemLoader) Load(coord [3]int) Raster {
-	template := l.template
-	template = strings.Replace(template, "{x}", strconv.Itoa(coord[0]), 1)
-	template = strings.Replace(template, "{y}", strconv.Itoa(coord[1]), 1)
-	template = strings.Replace(template, "{z}", strconv.Itoa(coord[2]), 1)
+	file := tileFileName(l.basepath, l.template, coord)
+
+	if r := NewMapBoxDemRasterWithOptions(file, coord, l.options); r != nil {
+		return r
+	}
+	return nil
+}
 
-	file := path.Join(l.basepath, template)
+var tileJSONFiles = []string{"tiles.json", "tilejson.json", "metadata.json"}
 
-	return NewMapBoxDemRaster(file, coord, raster.DEM_ENCODING_MAPBOX)
+// DetectDemEncoding looks for the raster-dem "encoding" field of a tilejson in dir.
+func DetectDemEncoding(dir string) (int, bool) {
+	for _, name := range tileJSONFiles {
+		data, err := os.ReadFile(path.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		var tilejson struct {
+			Encoding string `json:"encoding"`
+		}
+		if err := json.Unmarshal(data, &tilejson); err != nil {
+			continue
+		}
+		switch strings.ToLower(tilejson.Encoding) {
+		case "terrarium":
+			return raster.DEM_ENCODING_TERRARIUM, true
+		case "mapbox":
+			return raster.DEM_ENCODING_MAPBOX, true
+		}
+	}
+	return raster.DEM_ENCODING_MAPBOX, false
+}
+
+type AsciiGridLoader struct {
+	basepath string
+	template string
+	srs      geo.Proj
+}
+
+func NewAsciiGridLoader(basepath string, template string, srs geo.Proj) RasterLoader {
+	if !isTileTemplate(template) {
+		return nil
+	}
+	return &AsciiGridLoader{basepath: basepath, template: template, srs: srs}
+}
+
+func (l *AsciiGridLoader) Load(coord [3]int) Raster {
+	file := tileFileName(l.basepath, l.template, coord)
+
+	if r := NewAsciiGridRaster(file, l.srs); r != nil {
+		return r
+	}
+	return nil
+}
+
+type BilLoader struct {
+	basepath string
+	template string
+	band     int
+	srs      geo.Proj
+}
+
+func NewBilLoader(basepath string, template string, band int, srs geo.Proj) RasterLoader {
+	if !isTileTemplate(template) {
+		return nil
+	}
+	return &BilLoader{basepath: basepath, template: template, band: band, srs: srs}
+}
+
+func (l *BilLoader) Load(coord [3]int) Raster {
+	file := tileFileName(l.basepath, l.template, coord)
+
+	if r := NewBilRaster(file, l.band, l.srs); r != nil {
+		return r
+	}
+	return nil
 }
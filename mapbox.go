@@ -1,6 +1,7 @@
 package contour
 
 import (
+	"errors"
 	"math"
 
 	"github.com/flywave/go-geo"
@@ -26,41 +27,102 @@ func init() {
 	global_webmercator = geo.NewTileGrid(conf)
 }
 
+// MapBoxUnpack returns the unpack vector of a Mapbox-RGB style encoding where
+// height = base + (R * 256 * 256 + G * 256 + B) * interval.
+func MapBoxUnpack(base, interval float64) [4]float64 {
+	return [4]float64{65536 * interval, 256 * interval, interval, -base}
+}
+
+func encodingUnpack(encoding int) [4]float64 {
+	if encoding == raster.DEM_ENCODING_TERRARIUM {
+		return raster.UNPACK_TERRARIUM
+	}
+	return raster.UNPACK_MAPBOX
+}
+
 type MapBoxDemRaster struct {
 	data   *raster.DEMData
 	tileid [3]int
+	unpack [4]float64
+	border int
 }
 
 func NewMapBoxDemRaster(fileName string, tileid [3]int, encoding int) *MapBoxDemRaster {
-	data, err := raster.LoadDEMData(fileName, encoding)
-	if err != nil {
+	return NewMapBoxDemRasterWithOptions(fileName, tileid, MapBoxDemOptions{Encoding: encoding})
+}
+
+func NewMapBoxDemRasterWithOptions(fileName string, tileid [3]int, options MapBoxDemOptions) *MapBoxDemRaster {
+	data, err := raster.LoadDEMData(fileName, options.Encoding)
+	if err != nil || data == nil {
+		return nil
+	}
+	return NewMapBoxDemRasterFromData(data, tileid, options)
+}
+
+// NewMapBoxDemRasterFromData wraps decoded tile data. The image may carry
+// options.Border pixels of buffer on each side, or options.TileSize may give
+// the size of the tile without it.
+func NewMapBoxDemRasterFromData(data *raster.DEMData, tileid [3]int, options MapBoxDemOptions) *MapBoxDemRaster {
+	if data == nil || data.Dim <= 0 || data.Stride != data.Dim+2 {
+		return nil
+	}
+	border := options.Border
+	if options.TileSize > 0 {
+		if (data.Dim-options.TileSize)%2 != 0 {
+			return nil
+		}
+		border = (data.Dim - options.TileSize) / 2
+	}
+	if border < 0 || data.Dim-2*border <= 0 {
 		return nil
 	}
-	return &MapBoxDemRaster{data: data, tileid: tileid}
+	return &MapBoxDemRaster{data: data, tileid: tileid, unpack: options.unpack(), border: border}
+}
+
+func (r *MapBoxDemRaster) value(idx int) float64 {
+	v := r.data.Data[idx]
+	return float64(v[0])*r.unpack[0] + float64(v[1])*r.unpack[1] + float64(v[2])*r.unpack[2] - r.unpack[3]
+}
+
+func (r *MapBoxDemRaster) Data() *raster.DEMData {
+	return r.data
+}
+
+func (r *MapBoxDemRaster) TileID() [3]int {
+	return r.tileid
+}
+
+// TileSize is the number of pixels covering the tile extent, without any border.
+func (r *MapBoxDemRaster) TileSize() int {
+	return r.data.Dim - 2*r.border
+}
+
+// Border is the buffer width in pixels around the tile extent, including the
+// edge row added when the tile is decoded.
+func (r *MapBoxDemRaster) Border() int {
+	return r.border + 1
 }
 
 func (r *MapBoxDemRaster) Size() (w, h int) {
-	return int(514), int(514)
+	return r.data.Stride, r.data.Stride
 }
 
 func (r *MapBoxDemRaster) Elevation(x, y int) float64 {
-	if r.data == nil {
+	if x < 0 || y < 0 || x >= r.data.Stride || y >= r.data.Stride {
 		return math.NaN()
 	}
-	return r.data.Get(x, y)
+	return r.value(y*r.data.Stride + x)
 }
 
 func (r *MapBoxDemRaster) FetchLine(y int, line []float64) error {
-	var unpack [4]float64
-	if r.data.Encoding == 0 {
-		unpack = raster.UNPACK_MAPBOX
-	} else {
-		unpack = raster.UNPACK_TERRARIUM
+	if y < 0 || y >= r.data.Stride {
+		return errors.New("line out of range")
 	}
-	linebyte := make([][4]byte, r.data.Stride)
-	copy(linebyte, r.data.Data[y*r.data.Stride:(y+1)*r.data.Stride])
 	for i := range line {
-		line[i] = float64(linebyte[i][0])*unpack[0] + float64(linebyte[i][1])*unpack[1] + float64(linebyte[i][2])*unpack[2] - unpack[3]
+		if i >= r.data.Stride {
+			break
+		}
+		line[i] = r.value(y*r.data.Stride + i)
 	}
 	return nil
 }
@@ -69,21 +131,25 @@ func (r *MapBoxDemRaster) Srs() geo.Proj {
 	return srs900913
 }
 
-func bufferedBBox(bbox vec2d.Rect, level int) vec2d.Rect {
+func bufferedBBox(bbox vec2d.Rect, res float64, border int) vec2d.Rect {
 	minx, miny, maxx, maxy := bbox.Min[0], bbox.Min[1], bbox.Max[0], bbox.Max[1]
 
-	res := global_webmercator.Resolution(level)
-	minx -= float64(1) * res
-	miny -= float64(1) * res
-	maxx += float64(1) * res
-	maxy += float64(1) * res
+	minx -= float64(border) * res
+	miny -= float64(border) * res
+	maxx += float64(border) * res
+	maxy += float64(border) * res
 
 	return vec2d.Rect{Min: vec2d.T{minx, miny}, Max: vec2d.T{maxx, maxy}}
 }
 
+func (r *MapBoxDemRaster) resolution() float64 {
+	box := global_webmercator.TileBBox(r.tileid, false)
+	return (box.Max[0] - box.Min[0]) / float64(r.TileSize())
+}
+
 func (r *MapBoxDemRaster) Bounds() vec2d.Rect {
 	box := global_webmercator.TileBBox(r.tileid, false)
-	return bufferedBBox(box, r.tileid[2])
+	return bufferedBBox(box, r.resolution(), r.Border())
 }
 
 func (r *MapBoxDemRaster) NoData() *float64 {
@@ -91,19 +157,16 @@ func (r *MapBoxDemRaster) NoData() *float64 {
 }
 
 func (r *MapBoxDemRaster) GeoTransform() [6]float64 {
-	pixelsize := global_webmercator.Resolution(r.tileid[2])
+	pixelsize := r.resolution()
 	box := r.Bounds()
 	return [6]float64{box.Min[0], pixelsize, 0, box.Max[1], 0, -pixelsize}
 }
 
 func (r *MapBoxDemRaster) Range() [2]float64 {
 	min, max := math.MaxFloat64, -math.MaxFloat64
-	for x := 0; x < r.data.Dim; x++ {
-		for y := 0; y < r.data.Dim; y++ {
-			d := r.data.Get(x, y)
-			min, max = math.Min(min, d), math.Max(max, d)
-
-		}
+	for _, v := range r.data.Data {
+		d := float64(v[0])*r.unpack[0] + float64(v[1])*r.unpack[1] + float64(v[2])*r.unpack[2] - r.unpack[3]
+		min, max = math.Min(min, d), math.Max(max, d)
 	}
 	return [2]float64{min, max}
 }
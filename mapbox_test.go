@@ -0,0 +1,136 @@
+package contour
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flywave/go-mapbox/raster"
+)
+
+// 生成带透明通道的 PNG 高程瓦片，保证解码为 NRGBA
+func writeTestDemTile(t *testing.T, dir, name string, dim int, pixel func(x, y int) color.NRGBA) string {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, dim, dim))
+	for y := 0; y < dim; y++ {
+		for x := 0; x < dim; x++ {
+			img.SetNRGBA(x, y, pixel(x, y))
+		}
+	}
+	img.Pix[3] = 254
+
+	file := filepath.Join(dir, name)
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// 测试 Terrarium 编码、自定义基准/间隔以及 tilejson 自动识别
+func TestMapBoxDemLoaderEncoding(t *testing.T) {
+	dir := t.TempDir()
+	writeTestDemTile(t, dir, "1_0_0.png", 4, func(x, y int) color.NRGBA {
+		return color.NRGBA{128 + uint8(x), uint8(y), 128, 255}
+	})
+
+	l := NewMapBoxDemLoaderWithOptions(dir, "{z}_{x}_{y}.png", MapBoxDemOptions{Encoding: raster.DEM_ENCODING_TERRARIUM})
+	r := l.Load([3]int{0, 0, 1})
+	if r == nil {
+		t.Fatal("failed to load terrarium tile")
+	}
+	if v := r.Elevation(2, 3); v != 256+2+0.5 {
+		t.Errorf("unexpected terrarium elevation %f", v)
+	}
+	line := make([]float64, 6)
+	if err := r.FetchLine(1, line); err != nil {
+		t.Fatal(err)
+	}
+	if line[1] != 0.5 || line[4] != 3*256+0.5 {
+		t.Errorf("unexpected terrarium line %v", line)
+	}
+
+	l = NewMapBoxDemLoaderWithOptions(dir, "{z}_{x}_{y}.png", MapBoxDemOptions{Base: -100, Interval: 0.01})
+	r = l.Load([3]int{0, 0, 1})
+	if r == nil {
+		t.Fatal("failed to load mapbox tile")
+	}
+	expected := -100 + (129*65536+2*256+128)*0.01
+	if v := r.Elevation(2, 3); v < expected-1e-6 || v > expected+1e-6 {
+		t.Errorf("expected %f, got %f", expected, v)
+	}
+
+	if _, ok := DetectDemEncoding(dir); ok {
+		t.Error("unexpected encoding without tilejson")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tiles.json"), []byte(`{"tilejson":"2.2.0","encoding":"terrarium"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l = NewMapBoxDemLoaderWithOptions(dir, "{z}_{x}_{y}.png", MapBoxDemOptions{AutoDetect: true})
+	if l.(*MapBoxDemLoader).Encoding() != raster.DEM_ENCODING_TERRARIUM {
+		t.Error("expected terrarium encoding from tilejson")
+	}
+	if v := l.Load([3]int{0, 0, 1}).Elevation(2, 3); v != 256+2+0.5 {
+		t.Errorf("unexpected detected elevation %f", v)
+	}
+}
+
+// 测试不同瓦片尺寸和缓冲宽度下的范围与地理变换
+func TestMapBoxDemRasterTileSize(t *testing.T) {
+	tile := [3]int{0, 0, 1}
+	extent := global_webmercator.TileBBox(tile, false)
+	width := extent.Max[0] - extent.Min[0]
+
+	cases := []struct {
+		dim     int
+		options MapBoxDemOptions
+		size    int
+		border  int
+	}{
+		{256, MapBoxDemOptions{}, 256, 1},
+		{512, MapBoxDemOptions{}, 512, 1},
+		{258, MapBoxDemOptions{Border: 1}, 256, 2},
+		{260, MapBoxDemOptions{TileSize: 256}, 256, 3},
+	}
+	for _, c := range cases {
+		data := raster.NewDEMData(make([][4]byte, c.dim*c.dim), raster.DEM_ENCODING_MAPBOX)
+		r := NewMapBoxDemRasterFromData(data, tile, c.options)
+		if r == nil {
+			t.Fatalf("failed to wrap %d tile", c.dim)
+		}
+		if w, h := r.Size(); w != c.dim+2 || h != c.dim+2 {
+			t.Errorf("%d tile: unexpected size %dx%d", c.dim, w, h)
+		}
+		if r.TileSize() != c.size || r.Border() != c.border {
+			t.Errorf("%d tile: unexpected tile size %d border %d", c.dim, r.TileSize(), r.Border())
+		}
+		res := width / float64(c.size)
+		gt := r.GeoTransform()
+		if math.Abs(gt[1]-res) > 1e-6 || math.Abs(gt[5]+res) > 1e-6 {
+			t.Errorf("%d tile: unexpected resolution %v", c.dim, gt)
+		}
+		if math.Abs(gt[0]-(extent.Min[0]-float64(c.border)*res)) > 1e-6 || math.Abs(gt[3]-(extent.Max[1]+float64(c.border)*res)) > 1e-6 {
+			t.Errorf("%d tile: unexpected origin %v", c.dim, gt)
+		}
+		b := r.Bounds()
+		if math.Abs(b.Max[0]-b.Min[0]-float64(c.dim+2)*res) > 1e-6 {
+			t.Errorf("%d tile: bounds %v do not match size", c.dim, b)
+		}
+		if !math.IsNaN(r.Elevation(c.dim+2, 0)) || r.FetchLine(c.dim+2, make([]float64, c.dim+2)) == nil {
+			t.Errorf("%d tile: expected out of range read to fail", c.dim)
+		}
+	}
+
+	data := raster.NewDEMData(make([][4]byte, 16), raster.DEM_ENCODING_MAPBOX)
+	if r := NewMapBoxDemRasterFromData(data, tile, MapBoxDemOptions{TileSize: 3}); r != nil {
+		t.Error("expected nil raster for odd border")
+	}
+}
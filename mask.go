@@ -0,0 +1,323 @@
+package contour
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/flywave/go-geo"
+	"github.com/flywave/go-geom"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+// polygonMask holds the rings of one or more polygons, a point is inside when
+// it falls inside any polygon by the even-odd rule of its rings.
+type polygonMask struct {
+	polygons [][][]vec2d.T
+	bbox     vec2d.Rect
+}
+
+func geometryPolygons(g geom.Geometry) [][][][]float64 {
+	switch p := g.(type) {
+	case geom.Polygon:
+		return [][][][]float64{p.Data()}
+	case geom.Polygon3:
+		return [][][][]float64{p.Data()}
+	case geom.MultiPolygon:
+		return p.Data()
+	case geom.MultiPolygon3:
+		return p.Data()
+	case geom.Collection:
+		ret := [][][][]float64{}
+		for _, c := range p.Geometries() {
+			ret = append(ret, geometryPolygons(c)...)
+		}
+		return ret
+	}
+	return nil
+}
+
+// newPolygonMask reprojects the polygons of g from src to dst, either srs may
+// be nil when no transformation is needed.
+func newPolygonMask(g geom.Geometry, src, dst geo.Proj) *polygonMask {
+	data := geometryPolygons(g)
+	if len(data) == 0 {
+		return nil
+	}
+	m := &polygonMask{bbox: vec2d.Rect{Min: vec2d.MaxVal, Max: vec2d.MinVal}}
+	for _, poly := range data {
+		rings := [][]vec2d.T{}
+		for _, ring := range poly {
+			if len(ring) < 3 {
+				continue
+			}
+			points := make([]vec2d.T, len(ring))
+			for i := range ring {
+				points[i] = vec2d.T{ring[i][0], ring[i][1]}
+			}
+			if src != nil && dst != nil && !src.Eq(dst) {
+				points = src.TransformTo(dst, points)
+			}
+			for i := range points {
+				m.bbox.Extend(&points[i])
+			}
+			rings = append(rings, points)
+		}
+		if len(rings) > 0 {
+			m.polygons = append(m.polygons, rings)
+		}
+	}
+	if len(m.polygons) == 0 {
+		return nil
+	}
+	return m
+}
+
+// transform applies an affine geotransform style matrix to every vertex.
+func (m *polygonMask) transform(t [6]float64) *polygonMask {
+	ret := &polygonMask{bbox: vec2d.Rect{Min: vec2d.MaxVal, Max: vec2d.MinVal}}
+	for _, poly := range m.polygons {
+		rings := make([][]vec2d.T, len(poly))
+		for i, ring := range poly {
+			rings[i] = make([]vec2d.T, len(ring))
+			for j, p := range ring {
+				rings[i][j] = vec2d.T{t[0] + t[1]*p[0] + t[2]*p[1], t[3] + t[4]*p[0] + t[5]*p[1]}
+				ret.bbox.Extend(&rings[i][j])
+			}
+		}
+		ret.polygons = append(ret.polygons, rings)
+	}
+	return ret
+}
+
+// crossings returns the sorted x positions where the horizontal line at y
+// crosses the rings of a polygon.
+func crossings(rings [][]vec2d.T, y float64, xs []float64) []float64 {
+	xs = xs[:0]
+	for _, ring := range rings {
+		n := len(ring)
+		for i := 0; i < n; i++ {
+			a, b := ring[i], ring[(i+1)%n]
+			if (a[1] <= y) == (b[1] <= y) {
+				continue
+			}
+			xs = append(xs, a[0]+(y-a[1])*(b[0]-a[0])/(b[1]-a[1]))
+		}
+	}
+	sort.Float64s(xs)
+	return xs
+}
+
+func (m *polygonMask) contains(p vec2d.T) bool {
+	if !m.bbox.ContainsPoint(&p) {
+		return false
+	}
+	var xs []float64
+	for _, poly := range m.polygons {
+		xs = crossings(poly, p[1], xs)
+		inside := false
+		for _, x := range xs {
+			if x > p[0] {
+				break
+			}
+			inside = !inside
+		}
+		if inside {
+			return true
+		}
+	}
+	return false
+}
+
+func segmentsIntersect(a, b, c, d vec2d.T) bool {
+	cross := func(o, p, q vec2d.T) float64 {
+		return (p[0]-o[0])*(q[1]-o[1]) - (p[1]-o[1])*(q[0]-o[0])
+	}
+	d1, d2 := cross(c, d, a), cross(c, d, b)
+	d3, d4 := cross(a, b, c), cross(a, b, d)
+	return ((d1 > 0) != (d2 > 0) || d1 == 0 || d2 == 0) && ((d3 > 0) != (d4 > 0) || d3 == 0 || d4 == 0) &&
+		math.Max(a[0], b[0]) >= math.Min(c[0], d[0]) && math.Max(c[0], d[0]) >= math.Min(a[0], b[0]) &&
+		math.Max(a[1], b[1]) >= math.Min(c[1], d[1]) && math.Max(c[1], d[1]) >= math.Min(a[1], b[1])
+}
+
+func (m *polygonMask) intersectsRect(r vec2d.Rect) bool {
+	if !m.bbox.Intersects(&r) {
+		return false
+	}
+	corners := []vec2d.T{r.Min, {r.Max[0], r.Min[1]}, r.Max, {r.Min[0], r.Max[1]}}
+	for _, c := range corners {
+		if m.contains(c) {
+			return true
+		}
+	}
+	for _, poly := range m.polygons {
+		for _, ring := range poly {
+			for i := range ring {
+				if r.ContainsPoint(&ring[i]) {
+					return true
+				}
+				a, b := ring[i], ring[(i+1)%len(ring)]
+				for j := range corners {
+					if segmentsIntersect(a, b, corners[j], corners[(j+1)%4]) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// MaskedRaster returns NaN for every pixel whose center lies outside a
+// polygon, so contours and polygonized bands stop at the boundary. The mask is
+// kept in pixel space, or in the srs for curvilinear sources whose nodes are
+// tested one by one.
+type MaskedRaster struct {
+	src    Raster
+	mask   *polygonMask
+	coords *NodeCoordinates
+	width  int
+	xs     []float64
+	row    []bool
+	rng    *[2]float64
+	lock   sync.Mutex
+}
+
+// NewMaskedRaster takes a Polygon or MultiPolygon in maskSrs, a nil maskSrs
+// means the polygon is in the srs of the raster.
+func NewMaskedRaster(src Raster, mask geom.Geometry, maskSrs geo.Proj) *MaskedRaster {
+	if src == nil || mask == nil {
+		return nil
+	}
+	m := newPolygonMask(mask, maskSrs, src.Srs())
+	if m == nil {
+		return nil
+	}
+	w, _ := src.Size()
+	r := &MaskedRaster{src: src, mask: m, coords: rasterNodeCoordinates(src), width: w, row: make([]bool, w)}
+	if r.coords == nil {
+		inv, ok := invertGeoTransform(src.GeoTransform())
+		if !ok {
+			return nil
+		}
+		r.mask = m.transform(inv)
+	}
+	return r
+}
+
+func (r *MaskedRaster) Source() Raster {
+	return r.src
+}
+
+// maskRow marks the pixels of row y whose centers are inside the mask.
+func (r *MaskedRaster) maskRow(y int) []bool {
+	if r.coords != nil {
+		for x := range r.row {
+			r.row[x] = r.inside(x, y)
+		}
+		return r.row
+	}
+	for i := range r.row {
+		r.row[i] = false
+	}
+	cy := float64(y) + 0.5
+	for _, poly := range r.mask.polygons {
+		r.xs = crossings(poly, cy, r.xs)
+		for i := 0; i+1 < len(r.xs); i += 2 {
+			x0 := maxInt(0, int(math.Ceil(r.xs[i]-0.5)))
+			x1 := minInt(r.width, int(math.Ceil(r.xs[i+1]-0.5)))
+			for x := x0; x < x1; x++ {
+				r.row[x] = true
+			}
+		}
+	}
+	return r.row
+}
+
+func (r *MaskedRaster) Size() (w, h int) {
+	return r.src.Size()
+}
+
+// inside tells whether the center of pixel x, y lies inside the mask.
+func (r *MaskedRaster) inside(x, y int) bool {
+	if r.coords != nil {
+		nx, ny := r.coords.Node(x, y)
+		return r.mask.contains(vec2d.T{nx, ny})
+	}
+	return r.mask.contains(vec2d.T{float64(x) + 0.5, float64(y) + 0.5})
+}
+
+func (r *MaskedRaster) Elevation(x, y int) float64 {
+	if !r.inside(x, y) {
+		return math.NaN()
+	}
+	return r.src.Elevation(x, y)
+}
+
+func (r *MaskedRaster) FetchLine(y int, line []float64) error {
+	if _, h := r.src.Size(); y < 0 || y >= h {
+		return errors.New("line out of range")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	row := r.maskRow(y)
+	inside := false
+	for _, in := range row {
+		inside = inside || in
+	}
+	if !inside {
+		for i := range line {
+			line[i] = math.NaN()
+		}
+		return nil
+	}
+	if err := r.src.FetchLine(y, line); err != nil {
+		return err
+	}
+	for i := range line {
+		if i >= len(row) || !row[i] {
+			line[i] = math.NaN()
+		}
+	}
+	return nil
+}
+
+func (r *MaskedRaster) Srs() geo.Proj {
+	return r.src.Srs()
+}
+
+func (r *MaskedRaster) Bounds() vec2d.Rect {
+	return r.src.Bounds()
+}
+
+func (r *MaskedRaster) NoData() *float64 {
+	return r.src.NoData()
+}
+
+func (r *MaskedRaster) GeoTransform() [6]float64 {
+	return r.src.GeoTransform()
+}
+
+func (r *MaskedRaster) Range() [2]float64 {
+	if r.rng != nil {
+		return *r.rng
+	}
+	w, h := r.src.Size()
+	min, max := math.MaxFloat64, -math.MaxFloat64
+	line := make([]float64, w)
+	for y := 0; y < h; y++ {
+		if err := r.FetchLine(y, line); err != nil {
+			return [2]float64{}
+		}
+		for _, d := range line {
+			if isNoData(d, r.src.NoData()) {
+				continue
+			}
+			min, max = math.Min(min, d), math.Max(max, d)
+		}
+	}
+	r.rng = &[2]float64{min, max}
+	return *r.rng
+}
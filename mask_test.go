@@ -0,0 +1,101 @@
+package contour
+
+import (
+	"math"
+	"testing"
+
+	"github.com/flywave/go-geo"
+	"github.com/flywave/go-geom/general"
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+// 测试多边形掩膜（含内环）外的像元为 NaN
+func TestMaskedRaster(t *testing.T) {
+	src := newConeRaster(10, nil)
+	// 栅格范围为 x 1000..1100, y 1900..2000，外环覆盖第 2..7 列和第 2..7 行，内环挖去 4..5
+	poly := general.NewPolygon([][][]float64{
+		{{1020, 1920}, {1080, 1920}, {1080, 1980}, {1020, 1980}, {1020, 1920}},
+		{{1040, 1940}, {1060, 1940}, {1060, 1960}, {1040, 1960}, {1040, 1940}},
+	})
+	r := NewMaskedRaster(src, poly, nil)
+	if r == nil {
+		t.Fatal("failed to mask raster")
+	}
+
+	line := make([]float64, 10)
+	for y := 0; y < 10; y++ {
+		if err := r.FetchLine(y, line); err != nil {
+			t.Fatal(err)
+		}
+		for x := 0; x < 10; x++ {
+			inside := x >= 2 && x < 8 && y >= 2 && y < 8 && !(x >= 4 && x < 6 && y >= 4 && y < 6)
+			if inside != !math.IsNaN(line[x]) {
+				t.Errorf("pixel %d,%d: expected inside=%v, got %f", x, y, inside, line[x])
+			}
+			if inside && line[x] != src.Elevation(x, y) {
+				t.Errorf("pixel %d,%d: value changed", x, y)
+			}
+			if math.IsNaN(r.Elevation(x, y)) != math.IsNaN(line[x]) {
+				t.Errorf("pixel %d,%d: elevation differs from line", x, y)
+			}
+		}
+	}
+	if rng := r.Range(); rng[1] >= src.Range()[1] {
+		t.Errorf("expected masked peak to be excluded, got %v", rng)
+	}
+
+	// 以其他坐标系给出的掩膜
+	bbox := srs900913.TransformRectTo(srs4326, vec2d.Rect{Min: vec2d.T{1020, 1920}, Max: vec2d.T{1080, 1980}}, 16)
+	ll := general.NewPolygon([][][]float64{{{bbox.Min[0], bbox.Min[1]}, {bbox.Max[0], bbox.Min[1]}, {bbox.Max[0], bbox.Max[1]}, {bbox.Min[0], bbox.Max[1]}}})
+	r2 := NewMaskedRaster(src, ll, srs4326)
+	if math.IsNaN(r2.Elevation(5, 5)) || !math.IsNaN(r2.Elevation(0, 0)) {
+		t.Error("unexpected mask from reprojected polygon")
+	}
+
+	writer := NewMockGeometryWriter()
+	if err := ContourGenerate(r, writer, ContourGenerateOptions{Base: 0, Interval: 1}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 测试瓦片提供者跳过掩膜外的瓦片
+func TestMaskedTiledRasterProvider(t *testing.T) {
+	conf := geo.DefaultTileGridOptions()
+	conf[geo.TILEGRID_SRS] = srs900913
+	conf[geo.TILEGRID_RES_FACTOR] = 2.0
+	conf[geo.TILEGRID_TILE_SIZE] = []uint32{512, 512}
+	conf[geo.TILEGRID_ORIGIN] = geo.ORIGIN_UL
+	grid := geo.NewTileGrid(conf)
+
+	bbox := vec2d.Rect{Min: vec2d.MaxVal, Max: vec2d.MinVal}
+	for x := 13565; x <= 13568; x++ {
+		for y := 6403; y <= 6406; y++ {
+			b := grid.TileBBox([3]int{x, y, 14}, false)
+			bbox.Join(&b)
+		}
+	}
+	tile := grid.TileBBox([3]int{13566, 6404, 14}, false)
+	dx, dy := (tile.Max[0]-tile.Min[0])/4, (tile.Max[1]-tile.Min[1])/4
+	poly := general.NewPolygon([][][]float64{{
+		{tile.Min[0] + dx, tile.Min[1] + dy}, {tile.Max[0] - dx, tile.Min[1] + dy},
+		{tile.Max[0] - dx, tile.Max[1] - dy}, {tile.Min[0] + dx, tile.Max[1] - dy},
+	}})
+
+	loader := NewMapBoxDemLoader("./data", "{z}_{x}_{y}.webp")
+	all := NewTiledRasterProvider(loader, grid, bbox, srs900913, 14).(*TiledRasterProvider)
+	p := NewMaskedTiledRasterProvider(loader, grid, bbox, srs900913, 14, poly, srs900913).(*TiledRasterProvider)
+	if len(p.Coords()) != 1 || p.Coords()[0] != [3]int{13566, 6404, 14} {
+		t.Fatalf("expected one tile, got %v of %d", p.Coords(), len(all.Coords()))
+	}
+	r := p.Next()
+	if _, ok := r.(*MaskedRaster); !ok {
+		t.Fatalf("expected masked raster, got %T", r)
+	}
+	w, h := r.Size()
+	if !math.IsNaN(r.Elevation(0, 0)) || math.IsNaN(r.Elevation(w/2, h/2)) {
+		t.Error("unexpected mask on tile")
+	}
+	if p.HasNext() {
+		t.Error("expected no more tiles")
+	}
+}
@@ -0,0 +1,101 @@
+package contour
+
+import (
+	"errors"
+	"math"
+
+	"github.com/flywave/go-geo"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+type MemoryRaster struct {
+	data64       []float64
+	data32       []float32
+	width        int
+	height       int
+	geoTransform [6]float64
+	srs          geo.Proj
+	nodata       *float64
+	rng          *[2]float64
+}
+
+func NewMemoryRaster(data []float64, width, height int, geoTransform [6]float64, srs geo.Proj, nodata *float64) *MemoryRaster {
+	if width <= 0 || height <= 0 || len(data) < width*height {
+		return nil
+	}
+	return &MemoryRaster{data64: data, width: width, height: height, geoTransform: geoTransform, srs: srs, nodata: nodata}
+}
+
+func NewMemoryRasterFloat32(data []float32, width, height int, geoTransform [6]float64, srs geo.Proj, nodata *float64) *MemoryRaster {
+	if width <= 0 || height <= 0 || len(data) < width*height {
+		return nil
+	}
+	return &MemoryRaster{data32: data, width: width, height: height, geoTransform: geoTransform, srs: srs, nodata: nodata}
+}
+
+func (r *MemoryRaster) Size() (w, h int) {
+	return r.width, r.height
+}
+
+func (r *MemoryRaster) Elevation(x, y int) float64 {
+	if x < 0 || y < 0 || x >= r.width || y >= r.height {
+		return math.NaN()
+	}
+	if r.data32 != nil {
+		return float64(r.data32[y*r.width+x])
+	}
+	return r.data64[y*r.width+x]
+}
+
+func (r *MemoryRaster) FetchLine(y int, line []float64) error {
+	if y < 0 || y >= r.height {
+		return errors.New("line out of range")
+	}
+	if r.data32 != nil {
+		for i, v := range r.data32[y*r.width : (y+1)*r.width] {
+			if i >= len(line) {
+				break
+			}
+			line[i] = float64(v)
+		}
+		return nil
+	}
+	copy(line, r.data64[y*r.width:(y+1)*r.width])
+	return nil
+}
+
+func (r *MemoryRaster) Srs() geo.Proj {
+	return r.srs
+}
+
+func (r *MemoryRaster) Bounds() vec2d.Rect {
+	return geoTransformBounds(r.geoTransform, r.width, r.height)
+}
+
+func (r *MemoryRaster) NoData() *float64 {
+	return r.nodata
+}
+
+func (r *MemoryRaster) GeoTransform() [6]float64 {
+	return r.geoTransform
+}
+
+func (r *MemoryRaster) Range() [2]float64 {
+	if r.rng != nil {
+		return *r.rng
+	}
+	min, max := math.MaxFloat64, -math.MaxFloat64
+	line := make([]float64, r.width)
+	for y := 0; y < r.height; y++ {
+		r.FetchLine(y, line)
+		for _, d := range line {
+			if isNoData(d, r.nodata) {
+				continue
+			}
+			min, max = math.Min(min, d), math.Max(max, d)
+		}
+	}
+	r.rng = &[2]float64{min, max}
+	return *r.rng
+}
@@ -0,0 +1,63 @@
+package contour
+
+import (
+	"math"
+	"testing"
+
+	"github.com/flywave/go-geo"
+)
+
+func newConeRaster(size int, nodata *float64) *MemoryRaster {
+	data := make([]float64, size*size)
+	c := float64(size-1) / 2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			data[y*size+x] = 100 - math.Hypot(float64(x)-c, float64(y)-c)
+		}
+	}
+	return NewMemoryRaster(data, size, size, [6]float64{1000, 10, 0, 2000, 0, -10}, geo.NewProj(3857), nodata)
+}
+
+// 测试内存栅格的基本属性
+func TestMemoryRaster(t *testing.T) {
+	if NewMemoryRaster(make([]float64, 3), 2, 2, [6]float64{}, nil, nil) != nil {
+		t.Error("expected nil raster for short buffer")
+	}
+
+	nodata := -9999.0
+	r := NewMemoryRasterFloat32([]float32{1, 2, -9999, 4, 5, 6}, 3, 2, [6]float64{10, 2, 0, 20, 0, -2}, nil, &nodata)
+	if w, h := r.Size(); w != 3 || h != 2 {
+		t.Errorf("unexpected size %dx%d", w, h)
+	}
+	if r.Elevation(1, 1) != 5 {
+		t.Errorf("expected 5, got %f", r.Elevation(1, 1))
+	}
+	line := make([]float64, 3)
+	if err := r.FetchLine(1, line); err != nil || line[0] != 4 || line[2] != 6 {
+		t.Errorf("unexpected line %v, %v", line, err)
+	}
+	if r.FetchLine(2, line) == nil {
+		t.Error("expected error for out of range line")
+	}
+	if rng := r.Range(); rng[0] != 1 || rng[1] != 6 {
+		t.Errorf("unexpected range %v", rng)
+	}
+	b := r.Bounds()
+	if b.Min[0] != 10 || b.Min[1] != 16 || b.Max[0] != 16 || b.Max[1] != 20 {
+		t.Errorf("unexpected bounds %v", b)
+	}
+}
+
+// 测试内存栅格直接生成等值线
+func TestMemoryRasterContourGenerate(t *testing.T) {
+	r := newConeRaster(32, nil)
+
+	lines := NewMockGeometryWriter()
+	err := ContourGenerate(r, lines, ContourGenerateOptions{Base: 0, Interval: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines.writtenGeom) == 0 {
+		t.Error("expected contour lines")
+	}
+}
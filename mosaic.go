@@ -0,0 +1,196 @@
+package contour
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/flywave/go-geo"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+const mosaicTolerance = 1e-3
+
+type mosaicSource struct {
+	raster Raster
+	xoff   int
+	yoff   int
+	width  int
+	height int
+	nodata *float64
+	line   []float64
+}
+
+// VirtualMosaicRaster serves several aligned rasters as one. Where sources
+// overlap the first one in the list with valid data wins.
+type VirtualMosaicRaster struct {
+	sources      []*mosaicSource
+	width        int
+	height       int
+	geoTransform [6]float64
+	srs          geo.Proj
+	nodata       *float64
+	rng          *[2]float64
+	lock         sync.Mutex
+}
+
+// NewVirtualMosaicRaster returns nil unless all rasters share the srs and the
+// resolution, are north up and lie on the same pixel grid. nodata defaults to
+// the nodata of the first source that has one.
+func NewVirtualMosaicRaster(rasters []Raster, nodata *float64) *VirtualMosaicRaster {
+	if len(rasters) == 0 {
+		return nil
+	}
+	ref := rasters[0].GeoTransform()
+	srs := rasters[0].Srs()
+	if ref[1] == 0 || ref[5] == 0 || ref[2] != 0 || ref[4] != 0 {
+		return nil
+	}
+
+	ox, oy := math.MaxFloat64, math.MaxFloat64
+	if ref[1] < 0 {
+		ox = -math.MaxFloat64
+	}
+	if ref[5] < 0 {
+		oy = -math.MaxFloat64
+	}
+	for _, r := range rasters {
+		if r == nil {
+			return nil
+		}
+		gt := r.GeoTransform()
+		if gt[2] != 0 || gt[4] != 0 || math.Abs(gt[1]-ref[1]) > math.Abs(ref[1])*1e-9 || math.Abs(gt[5]-ref[5]) > math.Abs(ref[5])*1e-9 {
+			return nil
+		}
+		if (srs == nil) != (r.Srs() == nil) || (srs != nil && !srs.Eq(r.Srs())) {
+			return nil
+		}
+		if ref[1] > 0 {
+			ox = math.Min(ox, gt[0])
+		} else {
+			ox = math.Max(ox, gt[0])
+		}
+		if ref[5] < 0 {
+			oy = math.Max(oy, gt[3])
+		} else {
+			oy = math.Min(oy, gt[3])
+		}
+	}
+
+	m := &VirtualMosaicRaster{geoTransform: [6]float64{ox, ref[1], 0, oy, 0, ref[5]}, srs: srs, nodata: nodata}
+	for _, r := range rasters {
+		gt := r.GeoTransform()
+		fx, fy := (gt[0]-ox)/ref[1], (gt[3]-oy)/ref[5]
+		xoff, yoff := int(math.Round(fx)), int(math.Round(fy))
+		if math.Abs(fx-float64(xoff)) > mosaicTolerance || math.Abs(fy-float64(yoff)) > mosaicTolerance {
+			return nil
+		}
+		w, h := r.Size()
+		m.sources = append(m.sources, &mosaicSource{raster: r, xoff: xoff, yoff: yoff, width: w, height: h, nodata: r.NoData(), line: make([]float64, w)})
+		if xoff+w > m.width {
+			m.width = xoff + w
+		}
+		if yoff+h > m.height {
+			m.height = yoff + h
+		}
+		if m.nodata == nil && r.NoData() != nil {
+			v := *r.NoData()
+			m.nodata = &v
+		}
+	}
+	if m.nodata == nil {
+		v := defaultNoData
+		m.nodata = &v
+	}
+	return m
+}
+
+func (m *VirtualMosaicRaster) Sources() []Raster {
+	ret := make([]Raster, len(m.sources))
+	for i := range m.sources {
+		ret[i] = m.sources[i].raster
+	}
+	return ret
+}
+
+func (m *VirtualMosaicRaster) Size() (w, h int) {
+	return m.width, m.height
+}
+
+func (m *VirtualMosaicRaster) Elevation(x, y int) float64 {
+	if x < 0 || y < 0 || x >= m.width || y >= m.height {
+		return math.NaN()
+	}
+	for _, s := range m.sources {
+		sx, sy := x-s.xoff, y-s.yoff
+		if sx < 0 || sy < 0 || sx >= s.width || sy >= s.height {
+			continue
+		}
+		if v := s.raster.Elevation(sx, sy); !isNoData(v, s.nodata) {
+			return v
+		}
+	}
+	return *m.nodata
+}
+
+func (m *VirtualMosaicRaster) FetchLine(y int, line []float64) error {
+	if y < 0 || y >= m.height {
+		return errors.New("line out of range")
+	}
+	for i := range line {
+		line[i] = *m.nodata
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for i := len(m.sources) - 1; i >= 0; i-- {
+		s := m.sources[i]
+		sy := y - s.yoff
+		if sy < 0 || sy >= s.height || s.xoff >= len(line) {
+			continue
+		}
+		if err := s.raster.FetchLine(sy, s.line); err != nil {
+			return err
+		}
+		for sx, v := range s.line {
+			if s.xoff+sx >= len(line) {
+				break
+			}
+			if !isNoData(v, s.nodata) {
+				line[s.xoff+sx] = v
+			}
+		}
+	}
+	return nil
+}
+
+func (m *VirtualMosaicRaster) Srs() geo.Proj {
+	return m.srs
+}
+
+func (m *VirtualMosaicRaster) Bounds() vec2d.Rect {
+	return geoTransformBounds(m.geoTransform, m.width, m.height)
+}
+
+func (m *VirtualMosaicRaster) NoData() *float64 {
+	return m.nodata
+}
+
+func (m *VirtualMosaicRaster) GeoTransform() [6]float64 {
+	return m.geoTransform
+}
+
+// Range joins the ranges of the sources.
+func (m *VirtualMosaicRaster) Range() [2]float64 {
+	if m.rng != nil {
+		return *m.rng
+	}
+	rng := [2]float64{math.MaxFloat64, -math.MaxFloat64}
+	for _, s := range m.sources {
+		r := s.raster.Range()
+		rng[0], rng[1] = math.Min(rng[0], r[0]), math.Max(rng[1], r[1])
+	}
+	m.rng = &rng
+	return *m.rng
+}
@@ -0,0 +1,137 @@
+package contour
+
+import (
+	"math"
+	"testing"
+
+	"github.com/flywave/go-geo"
+)
+
+// 测试拼接相邻栅格并在空隙处填充无效值
+func TestVirtualMosaicRaster(t *testing.T) {
+	srs := geo.NewProj(3857)
+	nodata := -1.0
+	left := NewMemoryRaster([]float64{1, 2, 3, 4, 5, 6}, 3, 2, [6]float64{0, 10, 0, 100, 0, -10}, srs, &nodata)
+	right := NewMemoryRaster([]float64{7, -1, 9, 10}, 2, 2, [6]float64{20, 10, 0, 90, 0, -10}, srs, &nodata)
+
+	m := NewVirtualMosaicRaster([]Raster{left, right}, nil)
+	if m == nil {
+		t.Fatal("failed to build mosaic")
+	}
+	if w, h := m.Size(); w != 4 || h != 3 {
+		t.Fatalf("unexpected size %dx%d", w, h)
+	}
+	if m.GeoTransform() != [6]float64{0, 10, 0, 100, 0, -10} {
+		t.Errorf("unexpected geotransform %v", m.GeoTransform())
+	}
+	if b := m.Bounds(); b.Min[0] != 0 || b.Min[1] != 70 || b.Max[0] != 40 || b.Max[1] != 100 {
+		t.Errorf("unexpected bounds %v", b)
+	}
+	if nd := m.NoData(); nd == nil || *nd != -1 {
+		t.Errorf("unexpected nodata %v", nd)
+	}
+
+	expected := [][]float64{
+		{1, 2, 3, -1},
+		{4, 5, 6, -1},
+		{-1, -1, 9, 10},
+	}
+	line := make([]float64, 4)
+	for y := range expected {
+		if err := m.FetchLine(y, line); err != nil {
+			t.Fatal(err)
+		}
+		for x := range expected[y] {
+			if line[x] != expected[y][x] {
+				t.Errorf("line %d: expected %v, got %v", y, expected[y], line)
+				break
+			}
+			if v := m.Elevation(x, y); v != expected[y][x] {
+				t.Errorf("pixel %d,%d: expected %f, got %f", x, y, expected[y][x], v)
+			}
+		}
+	}
+	if rng := m.Range(); rng[0] != 1 || rng[1] != 10 {
+		t.Errorf("unexpected range %v", rng)
+	}
+
+	if NewVirtualMosaicRaster([]Raster{left, NewMemoryRaster(make([]float64, 4), 2, 2, [6]float64{20, 5, 0, 90, 0, -5}, srs, nil)}, nil) != nil {
+		t.Error("expected nil mosaic for different resolution")
+	}
+	if NewVirtualMosaicRaster([]Raster{left, NewMemoryRaster(make([]float64, 4), 2, 2, [6]float64{25, 10, 0, 90, 0, -10}, srs, nil)}, nil) != nil {
+		t.Error("expected nil mosaic for misaligned raster")
+	}
+	if NewVirtualMosaicRaster([]Raster{left, NewMemoryRaster(make([]float64, 4), 2, 2, [6]float64{20, 10, 0, 90, 0, -10}, geo.NewProj(4326), nil)}, nil) != nil {
+		t.Error("expected nil mosaic for different srs")
+	}
+}
+
+// 测试 x 方向分辨率为负的栅格拼接
+func TestVirtualMosaicRasterNegativeX(t *testing.T) {
+	srs := geo.NewProj(3857)
+	east := NewMemoryRaster([]float64{1, 2, 3, 4}, 2, 2, [6]float64{40, -10, 0, 100, 0, -10}, srs, nil)
+	west := NewMemoryRaster([]float64{5, 6, 7, 8}, 2, 2, [6]float64{20, -10, 0, 100, 0, -10}, srs, nil)
+
+	m := NewVirtualMosaicRaster([]Raster{west, east}, nil)
+	if m == nil {
+		t.Fatal("failed to build mosaic")
+	}
+	if w, h := m.Size(); w != 4 || h != 2 {
+		t.Fatalf("unexpected size %dx%d", w, h)
+	}
+	if m.GeoTransform() != [6]float64{40, -10, 0, 100, 0, -10} {
+		t.Errorf("unexpected geotransform %v", m.GeoTransform())
+	}
+	expected := []float64{1, 2, 5, 6, 3, 4, 7, 8}
+	for i, v := range expected {
+		if got := m.Elevation(i%4, i/4); got != v {
+			t.Errorf("pixel %d,%d: expected %f, got %f", i%4, i/4, v, got)
+		}
+	}
+}
+
+// 测试拼接后的栅格生成连续等值线
+func TestVirtualMosaicRasterContourGenerate(t *testing.T) {
+	size := 20
+	cone := newConeRaster(size, nil)
+	gt := cone.GeoTransform()
+	half := size / 2
+
+	var parts []Raster
+	for _, off := range [][2]int{{0, 0}, {half, 0}, {0, half}, {half, half}} {
+		data := make([]float64, half*half)
+		for y := 0; y < half; y++ {
+			for x := 0; x < half; x++ {
+				data[y*half+x] = cone.Elevation(off[0]+x, off[1]+y)
+			}
+		}
+		pgt := [6]float64{gt[0] + float64(off[0])*gt[1], gt[1], 0, gt[3] + float64(off[1])*gt[5], 0, gt[5]}
+		parts = append(parts, NewMemoryRaster(data, half, half, pgt, cone.Srs(), nil))
+	}
+
+	m := NewVirtualMosaicRaster(parts, nil)
+	if m == nil {
+		t.Fatal("failed to build mosaic")
+	}
+	if m.GeoTransform() != gt {
+		t.Errorf("unexpected geotransform %v", m.GeoTransform())
+	}
+	line, expected := make([]float64, size), make([]float64, size)
+	for y := 0; y < size; y++ {
+		m.FetchLine(y, line)
+		cone.FetchLine(y, expected)
+		for x := range line {
+			if math.Abs(line[x]-expected[x]) > 1e-12 {
+				t.Fatalf("pixel %d,%d: expected %f, got %f", x, y, expected[x], line[x])
+			}
+		}
+	}
+
+	writer := NewMockGeometryWriter()
+	if err := ContourGenerate(m, writer, ContourGenerateOptions{Base: 0, Interval: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.writtenGeom) == 0 {
+		t.Error("expected contours from mosaic")
+	}
+}
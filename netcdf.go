@@ -0,0 +1,724 @@
+package contour
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/flywave/go-geo"
+)
+
+type NetCDFType uint8
+
+const (
+	NC_BYTE   NetCDFType = 1
+	NC_CHAR   NetCDFType = 2
+	NC_SHORT  NetCDFType = 3
+	NC_INT    NetCDFType = 4
+	NC_FLOAT  NetCDFType = 5
+	NC_DOUBLE NetCDFType = 6
+)
+
+const (
+	ncDimensionTag = 0x0a
+	ncVariableTag  = 0x0b
+	ncAttributeTag = 0x0c
+	ncStreaming    = 0xffffffff
+	ncMaxElements  = 1 << 26
+
+	ncFillShort  = -32767
+	ncFillInt    = -2147483647
+	ncFillDouble = 9.9692099683868690e+36
+)
+
+func (t NetCDFType) size() int {
+	switch t {
+	case NC_BYTE, NC_CHAR:
+		return 1
+	case NC_SHORT:
+		return 2
+	case NC_INT, NC_FLOAT:
+		return 4
+	case NC_DOUBLE:
+		return 8
+	}
+	return 0
+}
+
+type NetCDFDimension struct {
+	Name   string
+	Length int
+	// Unlimited marks the record dimension, its length is the record count.
+	Unlimited bool
+}
+
+type NetCDFAttribute struct {
+	Name   string
+	Type   NetCDFType
+	Values []float64
+	Text   string
+}
+
+type NetCDFVariable struct {
+	Name       string
+	Dims       []int
+	Attributes []NetCDFAttribute
+	Type       NetCDFType
+	Begin      int64
+}
+
+func (v *NetCDFVariable) Attribute(name string) *NetCDFAttribute {
+	for i := range v.Attributes {
+		if v.Attributes[i].Name == name {
+			return &v.Attributes[i]
+		}
+	}
+	return nil
+}
+
+func (v *NetCDFVariable) attributeValue(name string) (float64, bool) {
+	if a := v.Attribute(name); a != nil && len(a.Values) > 0 {
+		return a.Values[0], true
+	}
+	return 0, false
+}
+
+// NetCDFFile is the header of a classic or 64-bit offset netCDF file, values
+// are read on demand from the underlying reader.
+type NetCDFFile struct {
+	Version    uint8
+	NumRecs    int
+	Dimensions []NetCDFDimension
+	Attributes []NetCDFAttribute
+	Variables  []NetCDFVariable
+	recSize    int64
+	reader     io.ReaderAt
+}
+
+type ncHeaderReader struct {
+	r       *bufio.Reader
+	version uint8
+	err     error
+}
+
+func (h *ncHeaderReader) read(n int) []byte {
+	if h.err != nil {
+		return nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(h.r, buf); err != nil {
+		h.err = errors.New("netcdf header is truncated")
+		return nil
+	}
+	return buf
+}
+
+func (h *ncHeaderReader) u32() uint32 {
+	if b := h.read(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (h *ncHeaderReader) count() int {
+	n := h.u32()
+	if n > ncMaxElements {
+		h.fail("netcdf element count %d is too large", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (h *ncHeaderReader) fail(format string, args ...interface{}) {
+	if h.err == nil {
+		h.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (h *ncHeaderReader) padded(n int) []byte {
+	b := h.read((n + 3) &^ 3)
+	if b == nil {
+		return nil
+	}
+	return b[:n]
+}
+
+func (h *ncHeaderReader) name() string {
+	return string(h.padded(h.count()))
+}
+
+func (h *ncHeaderReader) list(tag uint32) int {
+	t, n := h.u32(), h.count()
+	if t == 0 && n == 0 {
+		return 0
+	}
+	if t != tag {
+		h.fail("unexpected netcdf header tag %#x", t)
+		return 0
+	}
+	return n
+}
+
+func (h *ncHeaderReader) attributes() []NetCDFAttribute {
+	n := h.list(ncAttributeTag)
+	attrs := make([]NetCDFAttribute, 0, n)
+	for i := 0; i < n && h.err == nil; i++ {
+		a := NetCDFAttribute{Name: h.name(), Type: NetCDFType(h.u32())}
+		size := a.Type.size()
+		if size == 0 {
+			h.fail("unsupported netcdf type %d", a.Type)
+			break
+		}
+		count := h.count()
+		b := h.padded(count * size)
+		if b == nil {
+			break
+		}
+		if a.Type == NC_CHAR {
+			a.Text = strings.TrimRight(string(b), "\x00")
+		} else {
+			a.Values = make([]float64, count)
+			ncDecode(a.Type, b, a.Values)
+		}
+		attrs = append(attrs, a)
+	}
+	return attrs
+}
+
+func ncDecode(t NetCDFType, b []byte, out []float64) {
+	be := binary.BigEndian
+	for i := range out {
+		switch t {
+		case NC_BYTE:
+			out[i] = float64(int8(b[i]))
+		case NC_CHAR:
+			out[i] = float64(b[i])
+		case NC_SHORT:
+			out[i] = float64(int16(be.Uint16(b[2*i:])))
+		case NC_INT:
+			out[i] = float64(int32(be.Uint32(b[4*i:])))
+		case NC_FLOAT:
+			out[i] = float64(math.Float32frombits(be.Uint32(b[4*i:])))
+		case NC_DOUBLE:
+			out[i] = math.Float64frombits(be.Uint64(b[8*i:]))
+		}
+	}
+}
+
+// ReadNetCDF parses the header of a classic (CDF-1) or 64-bit offset (CDF-2)
+// file. A streaming record count needs a reader with a Size method.
+func ReadNetCDF(reader io.ReaderAt) (*NetCDFFile, error) {
+	h := &ncHeaderReader{r: bufio.NewReader(io.NewSectionReader(reader, 0, math.MaxInt64))}
+	magic := h.read(4)
+	if magic == nil || string(magic[:3]) != "CDF" {
+		return nil, errors.New("not a netcdf file")
+	}
+	h.version = magic[3]
+	if h.version != 1 && h.version != 2 {
+		return nil, fmt.Errorf("unsupported netcdf version %d", h.version)
+	}
+	f := &NetCDFFile{Version: h.version, reader: reader}
+	numRecs := h.u32()
+
+	n := h.list(ncDimensionTag)
+	for i := 0; i < n && h.err == nil; i++ {
+		d := NetCDFDimension{Name: h.name()}
+		d.Length = int(h.u32())
+		d.Unlimited = d.Length == 0
+		f.Dimensions = append(f.Dimensions, d)
+	}
+	f.Attributes = h.attributes()
+
+	n = h.list(ncVariableTag)
+	for i := 0; i < n && h.err == nil; i++ {
+		v := NetCDFVariable{Name: h.name()}
+		ndims := h.count()
+		for j := 0; j < ndims && h.err == nil; j++ {
+			id := int(h.u32())
+			if id >= len(f.Dimensions) || (j > 0 && f.Dimensions[id].Unlimited) {
+				h.fail("invalid dimension %d of variable %s", id, v.Name)
+			}
+			v.Dims = append(v.Dims, id)
+		}
+		v.Attributes = h.attributes()
+		v.Type = NetCDFType(h.u32())
+		if h.err == nil && v.Type.size() == 0 {
+			h.fail("unsupported netcdf type %d of variable %s", v.Type, v.Name)
+		}
+		h.u32() // vsize, recomputed since it saturates for large variables
+		if h.version == 1 {
+			v.Begin = int64(h.u32())
+		} else if b := h.read(8); b != nil {
+			v.Begin = int64(binary.BigEndian.Uint64(b))
+		}
+		f.Variables = append(f.Variables, v)
+	}
+	if h.err != nil {
+		return nil, h.err
+	}
+
+	var first *NetCDFVariable
+	records := 0
+	for i := range f.Variables {
+		v := &f.Variables[i]
+		if !f.isRecord(v) {
+			continue
+		}
+		if first == nil {
+			first = v
+		}
+		records++
+		f.recSize += (f.sliceSize(v) + 3) &^ 3
+	}
+	// a single record variable is stored without padding
+	if records == 1 {
+		f.recSize = f.sliceSize(first)
+	}
+
+	if numRecs != ncStreaming {
+		f.NumRecs = int(numRecs)
+	} else if sized, ok := reader.(interface{ Size() int64 }); ok && first != nil && f.recSize > 0 {
+		f.NumRecs = int((sized.Size() - first.Begin) / f.recSize)
+	} else if first != nil {
+		return nil, errors.New("netcdf streaming record count needs a sized reader")
+	}
+	return f, nil
+}
+
+func (f *NetCDFFile) Variable(name string) *NetCDFVariable {
+	for i := range f.Variables {
+		if f.Variables[i].Name == name {
+			return &f.Variables[i]
+		}
+	}
+	return nil
+}
+
+func (f *NetCDFFile) Attribute(name string) *NetCDFAttribute {
+	for i := range f.Attributes {
+		if f.Attributes[i].Name == name {
+			return &f.Attributes[i]
+		}
+	}
+	return nil
+}
+
+func (f *NetCDFFile) isRecord(v *NetCDFVariable) bool {
+	return len(v.Dims) > 0 && f.Dimensions[v.Dims[0]].Unlimited
+}
+
+// sliceSize is the byte size of one record, or of the whole variable when it
+// has no record dimension.
+func (f *NetCDFFile) sliceSize(v *NetCDFVariable) int64 {
+	size := int64(v.Type.size())
+	for i, d := range v.Dims {
+		if i == 0 && f.Dimensions[d].Unlimited {
+			continue
+		}
+		size *= int64(f.Dimensions[d].Length)
+	}
+	return size
+}
+
+// Shape returns the dimension lengths of a variable, the record dimension
+// has the record count.
+func (f *NetCDFFile) Shape(v *NetCDFVariable) []int {
+	shape := make([]int, len(v.Dims))
+	for i, d := range v.Dims {
+		if f.Dimensions[d].Unlimited {
+			shape[i] = f.NumRecs
+		} else {
+			shape[i] = f.Dimensions[d].Length
+		}
+	}
+	return shape
+}
+
+// ReadValues reads the hyperslab of start and count in row major order,
+// the values are neither unpacked nor masked.
+func (f *NetCDFFile) ReadValues(v *NetCDFVariable, start, count []int) ([]float64, error) {
+	shape := f.Shape(v)
+	if len(start) != len(shape) || len(count) != len(shape) {
+		return nil, fmt.Errorf("variable %s has %d dimensions", v.Name, len(shape))
+	}
+	total := 1
+	for i := range shape {
+		if start[i] < 0 || count[i] < 0 || start[i]+count[i] > shape[i] {
+			return nil, fmt.Errorf("slice of variable %s is out of range", v.Name)
+		}
+		total *= count[i]
+	}
+	out := make([]float64, 0, total)
+	if total == 0 {
+		return out, nil
+	}
+	if len(shape) == 0 {
+		shape, start, count = []int{1}, []int{0}, []int{1}
+	}
+
+	size := int64(v.Type.size())
+	rec := f.isRecord(v)
+	strides := make([]int64, len(shape))
+	stride := size
+	for i := len(shape) - 1; i >= 0; i-- {
+		strides[i] = stride
+		stride *= int64(shape[i])
+	}
+	if rec {
+		strides[0] = f.recSize
+	}
+
+	last := len(shape) - 1
+	outer, run := last, count[last]
+	if rec && last == 0 {
+		outer, run = 1, 1
+	}
+	buf := make([]byte, int64(run)*size)
+	values := make([]float64, run)
+	idx := make([]int, outer)
+	for {
+		off := v.Begin
+		for i := 0; i < outer; i++ {
+			off += int64(start[i]+idx[i]) * strides[i]
+		}
+		if outer == last {
+			off += int64(start[last]) * size
+		}
+		if _, err := f.reader.ReadAt(buf, off); err != nil {
+			return nil, fmt.Errorf("reading variable %s: %v", v.Name, err)
+		}
+		ncDecode(v.Type, buf, values)
+		out = append(out, values...)
+
+		i := outer - 1
+		for ; i >= 0; i-- {
+			idx[i]++
+			if idx[i] < count[i] {
+				break
+			}
+			idx[i] = 0
+		}
+		if i < 0 {
+			break
+		}
+	}
+	return out, nil
+}
+
+// coordinate returns the values of the coordinate variable of a dimension.
+func (f *NetCDFFile) coordinate(dim int) ([]float64, *NetCDFVariable) {
+	v := f.Variable(f.Dimensions[dim].Name)
+	if v == nil || len(v.Dims) != 1 || v.Dims[0] != dim {
+		return nil, nil
+	}
+	n := f.Shape(v)[0]
+	values, err := f.ReadValues(v, []int{0}, []int{n})
+	if err != nil {
+		return nil, nil
+	}
+	return values, v
+}
+
+func regularAxis(values []float64) (float64, bool) {
+	n := len(values)
+	if n < 2 {
+		return 0, false
+	}
+	step := (values[n-1] - values[0]) / float64(n-1)
+	if step == 0 || math.IsNaN(step) {
+		return 0, false
+	}
+	for i, v := range values {
+		if math.Abs(v-values[0]-float64(i)*step) > 1e-3*math.Abs(step) {
+			return 0, false
+		}
+	}
+	return step, true
+}
+
+type NetCDFOptions struct {
+	// Variable defaults to the first variable with two or more dimensions
+	// that is not a coordinate variable.
+	Variable string
+	// Slice selects the index of the leading dimensions (time, level) by
+	// name, missing dimensions use index 0.
+	Slice map[string]int
+	// Srs defaults to EPSG:4326 when the x coordinate is in degrees, rasters
+	// left in pixel space have none.
+	Srs geo.Proj
+}
+
+func NewNetCDFRaster(fileName string, options NetCDFOptions) *MemoryRaster {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	r, err := ReadNetCDFRaster(io.NewSectionReader(f, 0, st.Size()), options)
+	if err != nil {
+		return nil
+	}
+	return r
+}
+
+func ReadNetCDFRaster(reader io.ReaderAt, options NetCDFOptions) (*MemoryRaster, error) {
+	nc, err := ReadNetCDF(reader)
+	if err != nil {
+		return nil, err
+	}
+	return nc.Raster(options)
+}
+
+// Raster reads a 2D slice of a variable whose last two dimensions are y and
+// x. Values are unpacked with scale_factor and add_offset, _FillValue,
+// missing_value and the valid range become NaN and the raster has no nodata
+// value, so every unpacked value stays valid. Regularly spaced
+// coordinate variables define the geotransform, rows are flipped to run north
+// to south. Unevenly spaced coordinates are an error, CurvilinearRaster places
+// those fields.
+func (f *NetCDFFile) Raster(options NetCDFOptions) (*MemoryRaster, error) {
+	field, err := f.field(options)
+	if err != nil {
+		return nil, err
+	}
+	if !field.regular && (field.axes[0] != nil || field.axes[1] != nil) {
+		return nil, fmt.Errorf("coordinates of %s are not evenly spaced, use CurvilinearRaster", field.v.Name)
+	}
+	return field.raster, nil
+}
+
+// CurvilinearRaster reads the field like Raster and locates its nodes by the
+// 2D variables named in its coordinates attribute, recognized as x or
+// longitude and y or latitude by standard_name or units. Without them the 1D
+// coordinate variables are used, so unevenly spaced axes such as Gaussian
+// latitudes are placed correctly.
+func (f *NetCDFFile) CurvilinearRaster(options NetCDFOptions) (*CurvilinearRaster, error) {
+	field, err := f.field(options)
+	if err != nil {
+		return nil, err
+	}
+	r, v := field.raster, field.v
+	nd := len(v.Dims)
+	var axes [2][]float64
+	geographic := false
+	if a := v.Attribute("coordinates"); a != nil {
+		for _, name := range strings.Fields(a.Text) {
+			c := f.Variable(name)
+			if c == nil || len(c.Dims) != 2 || c.Dims[0] != v.Dims[nd-2] || c.Dims[1] != v.Dims[nd-1] {
+				continue
+			}
+			axis, degrees := ncAxis(c)
+			if axis < 0 || axes[axis] != nil {
+				continue
+			}
+			shape := f.Shape(c)
+			values, err := f.ReadValues(c, []int{0, 0}, shape)
+			if err != nil {
+				return nil, err
+			}
+			axes[axis] = flipGrid(values, shape[1], shape[0], field.flips[0], field.flips[1])
+			geographic = geographic || degrees
+		}
+	}
+	if (axes[0] == nil || axes[1] == nil) && field.axes[0] != nil && field.axes[1] != nil {
+		w, h := r.Size()
+		axes[0], axes[1] = make([]float64, w*h), make([]float64, w*h)
+		for j := 0; j < h; j++ {
+			for i := 0; i < w; i++ {
+				axes[0][j*w+i], axes[1][j*w+i] = field.axes[0][i], field.axes[1][j]
+			}
+		}
+		geographic = field.geographic
+	}
+	if axes[0] == nil || axes[1] == nil {
+		return nil, fmt.Errorf("variable %s has no coordinates", v.Name)
+	}
+	r.srs = options.Srs
+	if r.srs == nil && geographic {
+		r.srs = srs4326
+	}
+	return NewCurvilinearRaster(r, axes[0], axes[1]), nil
+}
+
+// ncAxis classifies a coordinate variable as x (0) or y (1), -1 otherwise.
+func ncAxis(v *NetCDFVariable) (int, bool) {
+	name, units := "", ""
+	if a := v.Attribute("standard_name"); a != nil {
+		name = a.Text
+	}
+	if a := v.Attribute("units"); a != nil {
+		units = strings.ToLower(a.Text)
+	}
+	degrees := strings.HasPrefix(units, "degree")
+	switch {
+	case name == "longitude" || (degrees && (strings.HasSuffix(units, "east") || strings.HasSuffix(units, "_e"))):
+		return 0, true
+	case name == "latitude" || (degrees && (strings.HasSuffix(units, "north") || strings.HasSuffix(units, "_n"))):
+		return 1, true
+	case name == "projection_x_coordinate":
+		return 0, false
+	case name == "projection_y_coordinate":
+		return 1, false
+	}
+	return -1, false
+}
+
+func flipGrid(data []float64, width, height int, flipX, flipY bool) []float64 {
+	if !flipX && !flipY {
+		return data
+	}
+	flipped := make([]float64, len(data))
+	for y := 0; y < height; y++ {
+		sy := y
+		if flipY {
+			sy = height - 1 - y
+		}
+		for x := 0; x < width; x++ {
+			sx := x
+			if flipX {
+				sx = width - 1 - x
+			}
+			flipped[y*width+x] = data[sy*width+sx]
+		}
+	}
+	return flipped
+}
+
+// ncField is a 2D slice of a variable with its 1D x and y coordinates in
+// raster order, regular tells whether both define the geotransform.
+type ncField struct {
+	raster     *MemoryRaster
+	v          *NetCDFVariable
+	flips      [2]bool
+	axes       [2][]float64
+	regular    bool
+	geographic bool
+}
+
+func (f *NetCDFFile) field(options NetCDFOptions) (*ncField, error) {
+	var v *NetCDFVariable
+	if options.Variable != "" {
+		v = f.Variable(options.Variable)
+	} else {
+		for i := range f.Variables {
+			c := &f.Variables[i]
+			if len(c.Dims) >= 2 && c.Type != NC_CHAR && f.Dimensions[c.Dims[0]].Name != c.Name {
+				v = c
+				break
+			}
+		}
+	}
+	if v == nil {
+		return nil, fmt.Errorf("netcdf variable %q not found", options.Variable)
+	}
+	if len(v.Dims) < 2 || v.Type == NC_CHAR {
+		return nil, fmt.Errorf("variable %s is not a 2D field", v.Name)
+	}
+
+	shape := f.Shape(v)
+	nd := len(shape)
+	start, count := make([]int, nd), make([]int, nd)
+	for i := 0; i < nd-2; i++ {
+		start[i], count[i] = options.Slice[f.Dimensions[v.Dims[i]].Name], 1
+	}
+	width, height := shape[nd-1], shape[nd-2]
+	count[nd-2], count[nd-1] = height, width
+	raw, err := f.ReadValues(v, start, count)
+	if err != nil {
+		return nil, err
+	}
+
+	fill, hasFill := v.attributeValue("_FillValue")
+	if !hasFill {
+		switch v.Type {
+		case NC_SHORT:
+			fill, hasFill = ncFillShort, true
+		case NC_INT:
+			fill, hasFill = ncFillInt, true
+		case NC_FLOAT:
+			fill, hasFill = float64(float32(ncFillDouble)), true
+		case NC_DOUBLE:
+			fill, hasFill = ncFillDouble, true
+		}
+	}
+	var missing []float64
+	if a := v.Attribute("missing_value"); a != nil {
+		missing = a.Values
+	}
+	validMin, validMax := math.Inf(-1), math.Inf(1)
+	if a := v.Attribute("valid_range"); a != nil && len(a.Values) == 2 {
+		validMin, validMax = a.Values[0], a.Values[1]
+	}
+	if m, ok := v.attributeValue("valid_min"); ok {
+		validMin = m
+	}
+	if m, ok := v.attributeValue("valid_max"); ok {
+		validMax = m
+	}
+	scale, ok := v.attributeValue("scale_factor")
+	if !ok {
+		scale = 1
+	}
+	offset, _ := v.attributeValue("add_offset")
+
+	for i, d := range raw {
+		masked := math.IsNaN(d) || (hasFill && d == fill) || d < validMin || d > validMax
+		for _, m := range missing {
+			masked = masked || d == m
+		}
+		if masked {
+			raw[i] = math.NaN()
+		} else {
+			raw[i] = d*scale + offset
+		}
+	}
+
+	// axes run west to east and north to south, the geotransform is only set
+	// when both are evenly spaced
+	field := &ncField{v: v}
+	xs, xv := f.coordinate(v.Dims[nd-1])
+	ys, _ := f.coordinate(v.Dims[nd-2])
+	flipX := len(xs) == width && xs[width-1] < xs[0]
+	flipY := len(ys) == height && ys[height-1] > ys[0]
+	if len(xs) == width {
+		field.axes[0] = flipGrid(xs, width, 1, flipX, false)
+	}
+	if len(ys) == height {
+		field.axes[1] = flipGrid(ys, 1, height, false, flipY)
+	}
+	if xv != nil {
+		if a := xv.Attribute("units"); a != nil && strings.HasPrefix(strings.ToLower(a.Text), "degree") {
+			field.geographic = true
+		}
+	}
+
+	gt := [6]float64{0, 1, 0, 0, 0, 1}
+	var srs geo.Proj
+	dx, okX := regularAxis(field.axes[0])
+	dy, okY := regularAxis(field.axes[1])
+	if okX && okY {
+		field.regular = true
+		gt = [6]float64{field.axes[0][0] - dx/2, dx, 0, field.axes[1][0] - dy/2, 0, dy}
+		srs = options.Srs
+		if srs == nil && field.geographic {
+			srs = srs4326
+		}
+	}
+	raw = flipGrid(raw, width, height, flipX, flipY)
+
+	field.raster = NewMemoryRaster(raw, width, height, gt, srs, nil)
+	if field.raster == nil {
+		return nil, fmt.Errorf("variable %s is empty", v.Name)
+	}
+	field.flips = [2]bool{flipX, flipY}
+	return field, nil
+}
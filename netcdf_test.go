@@ -0,0 +1,301 @@
+package contour
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testNCAttr struct {
+	name   string
+	typ    NetCDFType
+	values []float64
+	text   string
+}
+
+type testNCVar struct {
+	name  string
+	dims  []int
+	attrs []testNCAttr
+	typ   NetCDFType
+	data  []float64
+}
+
+func putNCValue(b *bytes.Buffer, t NetCDFType, v float64) {
+	switch t {
+	case NC_BYTE, NC_CHAR:
+		b.WriteByte(byte(int8(v)))
+	case NC_SHORT:
+		binary.Write(b, binary.BigEndian, int16(v))
+	case NC_INT:
+		binary.Write(b, binary.BigEndian, int32(v))
+	case NC_FLOAT:
+		binary.Write(b, binary.BigEndian, float32(v))
+	case NC_DOUBLE:
+		binary.Write(b, binary.BigEndian, v)
+	}
+}
+
+func padNC(b *bytes.Buffer) {
+	for b.Len()%4 != 0 {
+		b.WriteByte(0)
+	}
+}
+
+// buildTestNetCDF 编码一个 netCDF-3 文件, 记录变量的 data 按记录依次排列
+func buildTestNetCDF(version uint8, numRecs int, dims []NetCDFDimension, vars []testNCVar) []byte {
+	be := binary.BigEndian
+	isRecord := func(v testNCVar) bool { return len(v.dims) > 0 && dims[v.dims[0]].Unlimited }
+	sizes := make([]int, len(vars))
+	records := 0
+	for i, v := range vars {
+		sizes[i] = v.typ.size()
+		for j, d := range v.dims {
+			if j > 0 || !dims[d].Unlimited {
+				sizes[i] *= dims[d].Length
+			}
+		}
+		if isRecord(v) {
+			records++
+		}
+	}
+	padded := func(i int) int {
+		if records == 1 && isRecord(vars[i]) {
+			return sizes[i]
+		}
+		return (sizes[i] + 3) &^ 3
+	}
+	name := func(b *bytes.Buffer, s string) {
+		binary.Write(b, be, uint32(len(s)))
+		b.WriteString(s)
+		padNC(b)
+	}
+	attrs := func(b *bytes.Buffer, list []testNCAttr) {
+		if len(list) == 0 {
+			b.Write(make([]byte, 8))
+			return
+		}
+		binary.Write(b, be, uint32(ncAttributeTag))
+		binary.Write(b, be, uint32(len(list)))
+		for _, a := range list {
+			name(b, a.name)
+			binary.Write(b, be, uint32(a.typ))
+			if a.typ == NC_CHAR {
+				binary.Write(b, be, uint32(len(a.text)))
+				b.WriteString(a.text)
+			} else {
+				binary.Write(b, be, uint32(len(a.values)))
+				for _, v := range a.values {
+					putNCValue(b, a.typ, v)
+				}
+			}
+			padNC(b)
+		}
+	}
+	header := func(begins []int) []byte {
+		var b bytes.Buffer
+		b.WriteString("CDF")
+		b.WriteByte(version)
+		binary.Write(&b, be, uint32(numRecs))
+		binary.Write(&b, be, uint32(ncDimensionTag))
+		binary.Write(&b, be, uint32(len(dims)))
+		for _, d := range dims {
+			name(&b, d.Name)
+			binary.Write(&b, be, uint32(d.Length))
+		}
+		b.Write(make([]byte, 8))
+		binary.Write(&b, be, uint32(ncVariableTag))
+		binary.Write(&b, be, uint32(len(vars)))
+		for i, v := range vars {
+			name(&b, v.name)
+			binary.Write(&b, be, uint32(len(v.dims)))
+			for _, d := range v.dims {
+				binary.Write(&b, be, uint32(d))
+			}
+			attrs(&b, v.attrs)
+			binary.Write(&b, be, uint32(v.typ))
+			binary.Write(&b, be, uint32(padded(i)))
+			if version == 1 {
+				binary.Write(&b, be, uint32(begins[i]))
+			} else {
+				binary.Write(&b, be, uint64(begins[i]))
+			}
+		}
+		return b.Bytes()
+	}
+
+	begins := make([]int, len(vars))
+	offset := len(header(begins))
+	for i, v := range vars {
+		if !isRecord(v) {
+			begins[i] = offset
+			offset += padded(i)
+		}
+	}
+	for i, v := range vars {
+		if isRecord(v) {
+			begins[i] = offset
+			offset += padded(i)
+		}
+	}
+
+	var b bytes.Buffer
+	b.Write(header(begins))
+	for i, v := range vars {
+		if !isRecord(v) {
+			for _, d := range v.data {
+				putNCValue(&b, v.typ, d)
+			}
+			b.Write(make([]byte, padded(i)-sizes[i]))
+		}
+	}
+	for r := 0; r < numRecs; r++ {
+		for i, v := range vars {
+			if isRecord(v) {
+				n := sizes[i] / v.typ.size()
+				for _, d := range v.data[r*n : (r+1)*n] {
+					putNCValue(&b, v.typ, d)
+				}
+				b.Write(make([]byte, padded(i)-sizes[i]))
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+// 测试记录变量切片, CF 打包与填充值以及纬度翻转
+func TestNetCDFRecordRaster(t *testing.T) {
+	dims := []NetCDFDimension{{Name: "time", Unlimited: true}, {Name: "lat", Length: 3}, {Name: "lon", Length: 4}}
+	temp := make([]float64, 24)
+	for i := range temp {
+		temp[i] = float64(i * 10)
+	}
+	temp[12+1] = -999
+	vars := []testNCVar{
+		{name: "lat", dims: []int{1}, typ: NC_FLOAT, data: []float64{10, 11, 12},
+			attrs: []testNCAttr{{name: "units", typ: NC_CHAR, text: "degrees_north"}}},
+		{name: "lon", dims: []int{2}, typ: NC_DOUBLE, data: []float64{100, 100.5, 101, 101.5},
+			attrs: []testNCAttr{{name: "units", typ: NC_CHAR, text: "degrees_east"}}},
+		{name: "time", dims: []int{0}, typ: NC_DOUBLE, data: []float64{0, 6}},
+		{name: "temp", dims: []int{0, 1, 2}, typ: NC_SHORT, data: temp, attrs: []testNCAttr{
+			{name: "_FillValue", typ: NC_SHORT, values: []float64{-999}},
+			{name: "scale_factor", typ: NC_FLOAT, values: []float64{0.5}},
+			{name: "add_offset", typ: NC_FLOAT, values: []float64{273}},
+		}},
+	}
+	data := buildTestNetCDF(1, 2, dims, vars)
+
+	nc, err := ReadNetCDF(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nc.NumRecs != 2 || len(nc.Variables) != 4 {
+		t.Fatalf("unexpected header %+v", nc)
+	}
+	times, err := nc.ReadValues(nc.Variable("time"), []int{0}, []int{2})
+	if err != nil || times[1] != 6 {
+		t.Fatalf("unexpected times %v %v", times, err)
+	}
+
+	r, err := nc.Raster(NetCDFOptions{Slice: map[string]int{"time": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := r.Size(); w != 4 || h != 3 {
+		t.Fatalf("unexpected size %d x %d", w, h)
+	}
+	gt := r.GeoTransform()
+	if gt != [6]float64{99.75, 0.5, 0, 12.5, 0, -1} {
+		t.Fatalf("unexpected geotransform %v", gt)
+	}
+	// 第二条记录, 最北一行为 lat=12
+	if v := r.Elevation(0, 0); v != 273+0.5*200 {
+		t.Fatalf("unexpected value %v", v)
+	}
+	if v := r.Elevation(1, 2); !math.IsNaN(v) || r.NoData() != nil {
+		t.Fatalf("expected NaN without nodata, got %v %v", v, r.NoData())
+	}
+	if r.Srs() == nil {
+		t.Fatal("expected geographic srs")
+	}
+	if _, err := nc.Raster(NetCDFOptions{Variable: "temp", Slice: map[string]int{"time": 2}}); err == nil {
+		t.Fatal("expected error for a record out of range")
+	}
+}
+
+// 测试 64 位偏移格式和无坐标变量的网格
+func TestNetCDFOffset64Raster(t *testing.T) {
+	dims := []NetCDFDimension{{Name: "level", Length: 2}, {Name: "y", Length: 2}, {Name: "x", Length: 3}}
+	vars := []testNCVar{
+		{name: "depth", dims: []int{0, 1, 2}, typ: NC_FLOAT, data: []float64{1, 2, 3, 4, 5, 6, -9999, 8, math.NaN(), 10, 11, 12},
+			attrs: []testNCAttr{{name: "valid_max", typ: NC_FLOAT, values: []float64{11}}}},
+	}
+	data := buildTestNetCDF(2, 0, dims, vars)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "depth.nc")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewNetCDFRaster(file, NetCDFOptions{Variable: "depth", Slice: map[string]int{"level": 1}})
+	if r == nil {
+		t.Fatal("expected raster")
+	}
+	if r.GeoTransform() != [6]float64{0, 1, 0, 0, 0, 1} || r.Srs() != nil {
+		t.Fatalf("unexpected georeference %v", r.GeoTransform())
+	}
+	// -9999 是有效值, 不会被当作无效值
+	if v := r.Elevation(0, 0); v != -9999 || isNoData(v, r.NoData()) {
+		t.Fatalf("expected a valid -9999, got %v", v)
+	}
+	if v := r.Elevation(2, 0); !isNoData(v, r.NoData()) {
+		t.Fatalf("expected nodata for NaN, got %v", v)
+	}
+	if v := r.Elevation(2, 1); !isNoData(v, r.NoData()) {
+		t.Fatalf("expected nodata above valid_max, got %v", v)
+	}
+	if _, err := ReadNetCDF(bytes.NewReader(data[:20])); err == nil {
+		t.Fatal("expected error for truncated header")
+	}
+}
+
+// 测试不等间距的纬度只能通过曲线网格读取, 无坐标时不附带空间参考
+func TestNetCDFIrregularAxes(t *testing.T) {
+	dims := []NetCDFDimension{{Name: "lat", Length: 3}, {Name: "lon", Length: 2}}
+	vars := []testNCVar{
+		{name: "lat", dims: []int{0}, typ: NC_DOUBLE, data: []float64{-40, 0, 25},
+			attrs: []testNCAttr{{name: "units", typ: NC_CHAR, text: "degrees_north"}}},
+		{name: "lon", dims: []int{1}, typ: NC_DOUBLE, data: []float64{10, 20},
+			attrs: []testNCAttr{{name: "units", typ: NC_CHAR, text: "degrees_east"}}},
+		{name: "t", dims: []int{0, 1}, typ: NC_FLOAT, data: []float64{1, 2, 3, 4, 5, 6}},
+	}
+	nc, err := ReadNetCDF(bytes.NewReader(buildTestNetCDF(1, 0, dims, vars)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nc.Raster(NetCDFOptions{Variable: "t"}); err == nil {
+		t.Fatal("expected error for unevenly spaced latitudes")
+	}
+	r, err := nc.CurvilinearRaster(NetCDFOptions{Variable: "t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 最北一行为 lat=25
+	if lon, lat := r.NodeCoordinates().Node(1, 0); lon != 20 || lat != 25 {
+		t.Fatalf("unexpected node %v %v", lon, lat)
+	}
+	if r.Elevation(1, 0) != 6 || r.Srs() == nil {
+		t.Fatalf("unexpected raster %v %v", r.Elevation(1, 0), r.Srs())
+	}
+
+	plain, err := ReadNetCDF(bytes.NewReader(buildTestNetCDF(1, 0, []NetCDFDimension{{Name: "y", Length: 2}, {Name: "x", Length: 2}},
+		[]testNCVar{{name: "z", dims: []int{0, 1}, typ: NC_FLOAT, data: []float64{1, 2, 3, 4}}})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := plain.Raster(NetCDFOptions{Srs: srs4326}); err != nil || p.Srs() != nil {
+		t.Fatalf("expected a pixel space raster without srs, got %v %v", p, err)
+	}
+}
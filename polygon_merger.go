@@ -59,6 +59,7 @@ type TilePolygonMergerWriter struct {
 	id         int64
 	lock       sync.Mutex
 	srs        geo.Proj
+	stats      *StatisticsCache
 }
 
 func newTilePolygonMergerWriter(polyWriter GeometryWriter) *TilePolygonMergerWriter {
@@ -80,7 +81,7 @@ func (p *TilePolygonMergerWriter) EndOfTile(raster Raster, wr *TilePolygonRingWr
 	defer p.lock.Unlock()
 	rings := wr.Closed()
 
-	pwr := &GeomPolygonContourWriter{polyWriter: p.polyWriter, geoTransform: raster.GeoTransform(), srs: raster.Srs(), previousLevel: raster.Range()[0]}
+	pwr := &GeomPolygonContourWriter{polyWriter: p.polyWriter, geoTransform: raster.GeoTransform(), coords: rasterNodeCoordinates(raster), srs: raster.Srs(), previousLevel: rasterRange(raster, p.stats)[0]}
 
 	for _, r := range rings {
 		pwr.StartPolygon(r.level)
@@ -114,12 +115,11 @@ func (p *TilePolygonMergerWriter) Close() {
 	p.polyWriter.Flush()
 }
 
-func convertLineString(part *Ring, level float64, geoTransform [6]float64) [][]float64 {
+func convertLineString(part *Ring, level float64, geoTransform [6]float64, coords *NodeCoordinates) [][]float64 {
 	newRing := make([][]float64, len(part.points))
 
 	for ip, p := range part.points {
-		dfX := geoTransform[0] + geoTransform[1]*p[0] + geoTransform[2]*p[1]
-		dfY := geoTransform[3] + geoTransform[4]*p[0] + geoTransform[5]*p[1]
+		dfX, dfY := pixelToGeo(geoTransform, coords, p)
 
 		newRing[ip] = []float64{dfX, dfY, level}
 	}
@@ -170,7 +170,7 @@ func (p *TilePolygonMergerWriter) processNoClosed(raster Raster, wr *TilePolygon
 	for _, r := range rings {
 
 		for _, part := range r.ls {
-			gls := convertLineString(part, r.level, raster.GeoTransform())
+			gls := convertLineString(part, r.level, raster.GeoTransform(), rasterNodeCoordinates(raster))
 
 			if gls != nil {
 				fmerged, bmerged, closed := false, false, false
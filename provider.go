@@ -4,6 +4,7 @@ import (
 	"sync"
 
 	"github.com/flywave/go-geo"
+	"github.com/flywave/go-geom"
 
 	vec2d "github.com/flywave/go3d/float64/vec2"
 )
@@ -17,6 +18,8 @@ type TiledRasterProvider struct {
 	coords  [][3]int
 	lock    sync.Mutex
 	index   int
+	mask    geom.Geometry
+	maskSrs geo.Proj
 }
 
 func NewTiledRasterProvider(loader RasterLoader, grid *geo.TileGrid, bbox vec2d.Rect, bboxSrs geo.Proj, level int) RasterProvider {
@@ -25,6 +28,18 @@ func NewTiledRasterProvider(loader RasterLoader, grid *geo.TileGrid, bbox vec2d.
 	return p
 }
 
+// NewMaskedTiledRasterProvider skips the tiles that do not touch the mask
+// polygon and masks the others with a MaskedRaster.
+func NewMaskedTiledRasterProvider(loader RasterLoader, grid *geo.TileGrid, bbox vec2d.Rect, bboxSrs geo.Proj, level int, mask geom.Geometry, maskSrs geo.Proj) RasterProvider {
+	p := &TiledRasterProvider{loader: loader, grid: grid, bbox: bbox, bboxSrs: bboxSrs, level: level, index: 0, mask: mask, maskSrs: maskSrs}
+	p.caclTiles()
+	return p
+}
+
+func (p *TiledRasterProvider) Coords() [][3]int {
+	return p.coords
+}
+
 func (p *TiledRasterProvider) caclTiles() error {
 	bbox := p.bbox
 
@@ -38,6 +53,14 @@ func (p *TiledRasterProvider) caclTiles() error {
 		return err
 	}
 
+	var mask *polygonMask
+	if p.mask != nil {
+		if mask = newPolygonMask(p.mask, p.maskSrs, p.grid.Srs); mask == nil {
+			p.coords = [][3]int{}
+			return nil
+		}
+	}
+
 	p.coords = [][3]int{}
 	minx, miny := 0, 0
 	for {
@@ -51,7 +74,9 @@ func (p *TiledRasterProvider) caclTiles() error {
 			miny = y
 		}
 
-		p.coords = append(p.coords, [3]int{x, y, z})
+		if mask == nil || mask.intersectsRect(p.grid.TileBBox([3]int{x, y, z}, false)) {
+			p.coords = append(p.coords, [3]int{x, y, z})
+		}
 
 		if done {
 			break
@@ -78,7 +103,14 @@ func (p *TiledRasterProvider) Next() Raster {
 	if p.HasNext() {
 		index := p.inc()
 		coord = p.coords[index]
-		return p.loader.Load(coord)
+		r := p.loader.Load(coord)
+		if r == nil || p.mask == nil {
+			return r
+		}
+		if m := NewMaskedRaster(r, p.mask, p.maskSrs); m != nil {
+			return m
+		}
+		return r
 	}
 	return nil
 }
@@ -0,0 +1,356 @@
+package contour
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+
+	"github.com/flywave/go-geo"
+)
+
+const (
+	quantizedMeshHeaderSize = 88
+	quantizedMeshMaxValue   = 32767
+
+	QUANTIZED_MESH_EXT_NORMALS   = 1
+	QUANTIZED_MESH_EXT_WATERMASK = 2
+	QUANTIZED_MESH_EXT_METADATA  = 4
+)
+
+var global_geodetic *geo.TileGrid
+
+func init() {
+	global_geodetic = NewQuantizedMeshTileGrid()
+}
+
+// NewQuantizedMeshTileGrid returns the geodetic tiling of quantized-mesh
+// terrain, two tiles at level 0 and rows counted from the south.
+func NewQuantizedMeshTileGrid() *geo.TileGrid {
+	conf := geo.DefaultTileGridOptions()
+	conf[geo.TILEGRID_SRS] = geo.NewProj(4326)
+	conf[geo.TILEGRID_BBOX] = []float64{-180, -90, 180, 90}
+	conf[geo.TILEGRID_TILE_SIZE] = []uint32{256, 256}
+	conf[geo.TILEGRID_RES_FACTOR] = 2.0
+	conf[geo.TILEGRID_MIN_RES] = 180.0 / 256
+	conf[geo.TILEGRID_ORIGIN] = geo.ORIGIN_LL
+	return geo.NewTileGrid(conf)
+}
+
+type QuantizedMeshHeader struct {
+	Center           [3]float64
+	MinHeight        float32
+	MaxHeight        float32
+	BoundingSphere   [4]float64
+	HorizonOcclusion [3]float64
+}
+
+// QuantizedMesh is a decoded terrain tile, U, V and Height are quantized to
+// 0..32767 across the tile and between the minimum and maximum height.
+type QuantizedMesh struct {
+	Header  QuantizedMeshHeader
+	U       []uint16
+	V       []uint16
+	Height  []uint16
+	Indices []uint32
+	West    []uint32
+	South   []uint32
+	East    []uint32
+	North   []uint32
+	// Normals holds two oct encoded bytes per vertex, WaterMask either one
+	// byte or 256x256 bytes and Metadata the json of the metadata extension.
+	Normals   []byte
+	WaterMask []byte
+	Metadata  []byte
+}
+
+type quantizedMeshReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *quantizedMeshReader) take(n int) []byte {
+	if r.err != nil || n < 0 || r.pos+n > len(r.data) {
+		r.err = errors.New("quantized mesh is truncated")
+		return make([]byte, maxInt(n, 0))
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *quantizedMeshReader) uint32() uint32 {
+	return binary.LittleEndian.Uint32(r.take(4))
+}
+
+func (r *quantizedMeshReader) float64() float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(r.take(8)))
+}
+
+func (r *quantizedMeshReader) align(n int) {
+	if rem := r.pos % n; rem != 0 {
+		r.take(n - rem)
+	}
+}
+
+func (r *quantizedMeshReader) indices(count int, wide bool) []uint32 {
+	ret := make([]uint32, 0, maxInt(count, 0))
+	size := 2
+	if wide {
+		size = 4
+	}
+	b := r.take(count * size)
+	for i := 0; i < count && r.err == nil; i++ {
+		if wide {
+			ret = append(ret, binary.LittleEndian.Uint32(b[4*i:]))
+		} else {
+			ret = append(ret, uint32(binary.LittleEndian.Uint16(b[2*i:])))
+		}
+	}
+	return ret
+}
+
+// zigZagDeltas decodes the zig-zag encoded deltas of a vertex component.
+func zigZagDeltas(b []byte, count int) []uint16 {
+	ret := make([]uint16, count)
+	value := int32(0)
+	for i := range ret {
+		v := int32(binary.LittleEndian.Uint16(b[2*i:]))
+		value += (v >> 1) ^ -(v & 1)
+		ret[i] = uint16(value)
+	}
+	return ret
+}
+
+// DecodeQuantizedMesh parses a quantized-mesh 1.0 tile, gzip compressed
+// tiles are inflated first.
+func DecodeQuantizedMesh(data []byte) (*QuantizedMesh, error) {
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+	r := &quantizedMeshReader{data: data}
+	m := &QuantizedMesh{}
+	h := &m.Header
+	for i := range h.Center {
+		h.Center[i] = r.float64()
+	}
+	h.MinHeight = math.Float32frombits(r.uint32())
+	h.MaxHeight = math.Float32frombits(r.uint32())
+	for i := range h.BoundingSphere {
+		h.BoundingSphere[i] = r.float64()
+	}
+	for i := range h.HorizonOcclusion {
+		h.HorizonOcclusion[i] = r.float64()
+	}
+
+	count := int(r.uint32())
+	if r.err != nil || count*6 > len(data)-r.pos {
+		return nil, errors.New("quantized mesh is truncated")
+	}
+	m.U = zigZagDeltas(r.take(2*count), count)
+	m.V = zigZagDeltas(r.take(2*count), count)
+	m.Height = zigZagDeltas(r.take(2*count), count)
+
+	wide := count > 65536
+	if wide {
+		r.align(4)
+	} else {
+		r.align(2)
+	}
+	triangles := int(r.uint32())
+	m.Indices = r.indices(3*triangles, wide)
+	// indices are high water mark encoded
+	highest := uint32(0)
+	for i, code := range m.Indices {
+		m.Indices[i] = highest - code
+		if code == 0 {
+			highest++
+		}
+	}
+	m.West = r.indices(int(r.uint32()), wide)
+	m.South = r.indices(int(r.uint32()), wide)
+	m.East = r.indices(int(r.uint32()), wide)
+	m.North = r.indices(int(r.uint32()), wide)
+	if r.err != nil {
+		return nil, r.err
+	}
+	for _, i := range m.Indices {
+		if int(i) >= count {
+			return nil, errors.New("quantized mesh index out of range")
+		}
+	}
+
+	for len(data)-r.pos >= 5 {
+		id := r.take(1)[0]
+		ext := r.take(int(r.uint32()))
+		if r.err != nil {
+			return nil, r.err
+		}
+		switch id {
+		case QUANTIZED_MESH_EXT_NORMALS:
+			m.Normals = ext
+		case QUANTIZED_MESH_EXT_WATERMASK:
+			m.WaterMask = ext
+		case QUANTIZED_MESH_EXT_METADATA:
+			if len(ext) >= 4 {
+				n := int(binary.LittleEndian.Uint32(ext))
+				m.Metadata = ext[4:minInt(4+n, len(ext))]
+			}
+		}
+	}
+	return m, nil
+}
+
+func LoadQuantizedMesh(fileName string) (*QuantizedMesh, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeQuantizedMesh(data)
+}
+
+func (m *QuantizedMesh) height(i int) float64 {
+	h := &m.Header
+	return float64(h.MinHeight) + float64(m.Height[i])/quantizedMeshMaxValue*float64(h.MaxHeight-h.MinHeight)
+}
+
+// TIN places the vertices in longitude and latitude inside the tile, so the
+// contours can be traced on the triangles of the terrain itself.
+func (m *QuantizedMesh) TIN(tileid [3]int) *TIN {
+	box := global_geodetic.TileBBox(tileid, false)
+	points := make([]GridPoint, len(m.U))
+	for i := range points {
+		points[i] = GridPoint{
+			X: box.Min[0] + float64(m.U[i])/quantizedMeshMaxValue*(box.Max[0]-box.Min[0]),
+			Y: box.Min[1] + float64(m.V[i])/quantizedMeshMaxValue*(box.Max[1]-box.Min[1]),
+			Z: m.height(i),
+		}
+	}
+	triangles := make([][3]int, len(m.Indices)/3)
+	for i := range triangles {
+		triangles[i] = [3]int{int(m.Indices[3*i]), int(m.Indices[3*i+1]), int(m.Indices[3*i+2])}
+	}
+	return NewTINFromTriangles(points, triangles, srs4326)
+}
+
+// Rasterize samples the triangles at the pixel centers of a size x size grid
+// covering the tile, pixels outside every triangle are nodata.
+func (m *QuantizedMesh) Rasterize(size int, nodata float64) []float64 {
+	data := make([]float64, size*size)
+	for i := range data {
+		data[i] = nodata
+	}
+	// pixel coordinates of the vertices, y down
+	scale := float64(size) / quantizedMeshMaxValue
+	px := func(i uint32) (float64, float64) {
+		return float64(m.U[i]) * scale, float64(size) - float64(m.V[i])*scale
+	}
+	for t := 0; t+2 < len(m.Indices); t += 3 {
+		x0, y0 := px(m.Indices[t])
+		x1, y1 := px(m.Indices[t+1])
+		x2, y2 := px(m.Indices[t+2])
+		det := (y1-y2)*(x0-x2) + (x2-x1)*(y0-y2)
+		if det == 0 {
+			continue
+		}
+		h0, h1, h2 := m.height(int(m.Indices[t])), m.height(int(m.Indices[t+1])), m.height(int(m.Indices[t+2]))
+		minx := maxInt(0, int(math.Floor(math.Min(x0, math.Min(x1, x2))-0.5)))
+		maxx := minInt(size-1, int(math.Ceil(math.Max(x0, math.Max(x1, x2))-0.5)))
+		miny := maxInt(0, int(math.Floor(math.Min(y0, math.Min(y1, y2))-0.5)))
+		maxy := minInt(size-1, int(math.Ceil(math.Max(y0, math.Max(y1, y2))-0.5)))
+		for y := miny; y <= maxy; y++ {
+			cy := float64(y) + 0.5
+			for x := minx; x <= maxx; x++ {
+				cx := float64(x) + 0.5
+				l0 := ((y1-y2)*(cx-x2) + (x2-x1)*(cy-y2)) / det
+				l1 := ((y2-y0)*(cx-x2) + (x0-x2)*(cy-y2)) / det
+				l2 := 1 - l0 - l1
+				if l0 < -1e-9 || l1 < -1e-9 || l2 < -1e-9 {
+					continue
+				}
+				data[y*size+x] = l0*h0 + l1*h1 + l2*h2
+			}
+		}
+	}
+	return data
+}
+
+// QuantizedMeshRaster is a quantized-mesh tile rasterized to a square grid,
+// pixels outside the mesh are NaN and the raster has no nodata value.
+type QuantizedMeshRaster struct {
+	*MemoryRaster
+	mesh   *QuantizedMesh
+	tileid [3]int
+}
+
+func NewQuantizedMeshRaster(fileName string, tileid [3]int, size int) *QuantizedMeshRaster {
+	mesh, err := LoadQuantizedMesh(fileName)
+	if err != nil {
+		return nil
+	}
+	return NewQuantizedMeshRasterFromMesh(mesh, tileid, size)
+}
+
+func NewQuantizedMeshRasterFromMesh(mesh *QuantizedMesh, tileid [3]int, size int) *QuantizedMeshRaster {
+	if mesh == nil || size <= 0 {
+		return nil
+	}
+	box := global_geodetic.TileBBox(tileid, false)
+	gt := [6]float64{box.Min[0], (box.Max[0] - box.Min[0]) / float64(size), 0, box.Max[1], 0, -(box.Max[1] - box.Min[1]) / float64(size)}
+	r := NewMemoryRaster(mesh.Rasterize(size, math.NaN()), size, size, gt, srs4326, nil)
+	if r == nil {
+		return nil
+	}
+	return &QuantizedMeshRaster{MemoryRaster: r, mesh: mesh, tileid: tileid}
+}
+
+func (r *QuantizedMeshRaster) Mesh() *QuantizedMesh {
+	return r.mesh
+}
+
+func (r *QuantizedMeshRaster) TileID() [3]int {
+	return r.tileid
+}
+
+type QuantizedMeshLoader struct {
+	basepath string
+	template string
+	size     int
+}
+
+// NewQuantizedMeshLoader loads .terrain tiles named by a {z}/{x}/{y} template
+// and rasterizes them to size x size pixels.
+func NewQuantizedMeshLoader(basepath string, template string, size int) RasterLoader {
+	if !isTileTemplate(template) || size <= 0 {
+		return nil
+	}
+	return &QuantizedMeshLoader{basepath: basepath, template: template, size: size}
+}
+
+func (l *QuantizedMeshLoader) Load(coord [3]int) Raster {
+	file := tileFileName(l.basepath, l.template, coord)
+
+	if r := NewQuantizedMeshRaster(file, coord, l.size); r != nil {
+		return r
+	}
+	return nil
+}
+
+// QuantizedMeshContourGenerate traces the contours of a tile on its own
+// triangles, in longitude and latitude.
+func QuantizedMeshContourGenerate(mesh *QuantizedMesh, tileid [3]int, wf GeometryWriter, options ContourGenerateOptions) error {
+	if mesh == nil {
+		return errors.New("mesh is nil")
+	}
+	return TINContourGenerate(mesh.TIN(tileid), wf, options)
+}
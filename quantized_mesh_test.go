@@ -0,0 +1,141 @@
+package contour
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildTestQuantizedMesh 编码一个五个顶点、四个三角形的瓦片: 四角高度 0, 中心 100
+func buildTestQuantizedMesh() []byte {
+	le := binary.LittleEndian
+	var b bytes.Buffer
+	header := make([]byte, quantizedMeshHeaderSize)
+	le.PutUint32(header[24:], math.Float32bits(0))
+	le.PutUint32(header[28:], math.Float32bits(100))
+	b.Write(header)
+
+	u := []int{0, 32767, 16384, 32767, 0}
+	v := []int{0, 0, 16384, 32767, 32767}
+	h := []int{0, 0, 32767, 0, 0}
+	binary.Write(&b, le, uint32(len(u)))
+	for _, comp := range [][]int{u, v, h} {
+		prev := 0
+		for _, c := range comp {
+			d := c - prev
+			prev = c
+			binary.Write(&b, le, uint16((d<<1)^(d>>31)))
+		}
+	}
+
+	indices := []uint32{0, 1, 2, 1, 3, 2, 3, 4, 2, 4, 0, 2}
+	binary.Write(&b, le, uint32(len(indices)/3))
+	highest := uint32(0)
+	for _, i := range indices {
+		binary.Write(&b, le, uint16(highest-i))
+		if i == highest {
+			highest++
+		}
+	}
+	for _, edge := range [][]uint16{{0, 4}, {0, 1}, {1, 3}, {4, 3}} {
+		binary.Write(&b, le, uint32(len(edge)))
+		binary.Write(&b, le, edge)
+	}
+
+	b.WriteByte(QUANTIZED_MESH_EXT_METADATA)
+	meta := []byte(`{"available":[]}`)
+	binary.Write(&b, le, uint32(4+len(meta)))
+	binary.Write(&b, le, uint32(len(meta)))
+	b.Write(meta)
+	return b.Bytes()
+}
+
+// 测试 quantized-mesh 解码
+func TestDecodeQuantizedMesh(t *testing.T) {
+	data := buildTestQuantizedMesh()
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(data)
+	zw.Close()
+
+	for _, d := range [][]byte{data, gz.Bytes()} {
+		m, err := DecodeQuantizedMesh(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m.U) != 5 || m.U[1] != 32767 || m.V[2] != 16384 || m.Height[2] != 32767 {
+			t.Fatalf("unexpected vertices %v %v %v", m.U, m.V, m.Height)
+		}
+		want := []uint32{0, 1, 2, 1, 3, 2, 3, 4, 2, 4, 0, 2}
+		for i := range want {
+			if m.Indices[i] != want[i] {
+				t.Fatalf("unexpected indices %v", m.Indices)
+			}
+		}
+		if len(m.West) != 2 || len(m.North) != 2 || string(m.Metadata) != `{"available":[]}` {
+			t.Fatalf("unexpected edges or metadata %v %v %s", m.West, m.North, m.Metadata)
+		}
+	}
+	if _, err := DecodeQuantizedMesh(data[:100]); err == nil {
+		t.Fatal("expected error for truncated tile")
+	}
+}
+
+// 测试瓦片栅格化和加载器
+func TestQuantizedMeshLoader(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "1", "3"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "1", "3", "1.terrain"), buildTestQuantizedMesh(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loader := NewQuantizedMeshLoader(dir, "{z}/{x}/{y}.terrain", 16)
+	r := loader.Load([3]int{3, 1, 1})
+	if r == nil {
+		t.Fatal("expected raster")
+	}
+	bounds := r.Bounds()
+	if math.Abs(bounds.Min[0]-90) > 1e-9 || math.Abs(bounds.Max[0]-180) > 1e-9 || math.Abs(bounds.Min[1]) > 1e-9 || math.Abs(bounds.Max[1]-90) > 1e-9 {
+		t.Fatalf("unexpected bounds %v", bounds)
+	}
+	// 像元中心 (7.5, 7.5) 到中心顶点的距离为 0.5 像元, 金字塔高度线性下降
+	if v := r.Elevation(7, 7); math.Abs(v-100*(1-0.5/8)) > 0.1 {
+		t.Fatalf("unexpected center value %v", v)
+	}
+	if v := r.Elevation(0, 0); v < 0 || v > 10 {
+		t.Fatalf("unexpected corner value %v", v)
+	}
+	if r.NoData() != nil {
+		t.Fatalf("expected no nodata, got %v", *r.NoData())
+	}
+	if loader.Load([3]int{0, 0, 1}) != nil {
+		t.Fatal("expected nil for a missing tile")
+	}
+}
+
+// 测试直接在三角网上生成等值线
+func TestQuantizedMeshContourGenerate(t *testing.T) {
+	m, err := DecodeQuantizedMesh(buildTestQuantizedMesh())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := NewMockGeometryWriter()
+	if err := QuantizedMeshContourGenerate(m, [3]int{3, 1, 1}, writer, ContourGenerateOptions{Interval: 50, Polygonize: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.writtenGeom) != 2 {
+		t.Fatalf("expected 2 bands, got %d", len(writer.writtenGeom))
+	}
+	writer = NewMockGeometryWriter()
+	if err := QuantizedMeshContourGenerate(m, [3]int{3, 1, 1}, writer, ContourGenerateOptions{Interval: 50}); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.writtenGeom) != 1 || writer.writtenMinLevel[0] != 50 {
+		t.Fatalf("expected one line at 50, got %d", len(writer.writtenGeom))
+	}
+}
@@ -1,11 +1,15 @@
 package contour
 
 import (
+	"math"
+
 	"github.com/flywave/go-geo"
 
 	vec2d "github.com/flywave/go3d/float64/vec2"
 )
 
+const defaultNoData = -9999.0
+
 type Raster interface {
 	Size() (w, h int)
 	Elevation(x, y int) float64
@@ -26,3 +30,34 @@ type RasterProvider interface {
 	HasNext() bool
 	Reset()
 }
+
+func geoTransformBounds(gt [6]float64, w, h int) vec2d.Rect {
+	x0, y0 := gt[0], gt[3]
+	x1 := gt[0] + gt[1]*float64(w) + gt[2]*float64(h)
+	y1 := gt[3] + gt[4]*float64(w) + gt[5]*float64(h)
+	return vec2d.Rect{Min: vec2d.T{math.Min(x0, x1), math.Min(y0, y1)}, Max: vec2d.T{math.Max(x0, x1), math.Max(y0, y1)}}
+}
+
+func isNoData(v float64, nodata *float64) bool {
+	return math.IsNaN(v) || (nodata != nil && v == *nodata)
+}
+
+// noDataValue is the value written where there is no data, NaN unless the
+// raster has a nodata value.
+func noDataValue(nodata *float64) float64 {
+	if nodata == nil {
+		return math.NaN()
+	}
+	return *nodata
+}
+
+func invertGeoTransform(gt [6]float64) ([6]float64, bool) {
+	det := gt[1]*gt[5] - gt[2]*gt[4]
+	if det == 0 {
+		return [6]float64{}, false
+	}
+	inv := [6]float64{0, gt[5] / det, -gt[2] / det, 0, -gt[4] / det, gt[1] / det}
+	inv[0] = -inv[1]*gt[0] - inv[2]*gt[3]
+	inv[3] = -inv[4]*gt[0] - inv[5]*gt[3]
+	return inv, true
+}
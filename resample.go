@@ -0,0 +1,246 @@
+package contour
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/flywave/go-geo"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+// ResampledRaster exposes a raster on a coarser or finer grid over the same
+// extent. Average, min and max aggregate every source pixel under a target
+// pixel, the other methods interpolate at its center. Pixels without data
+// take the source nodata, or NaN when it has none.
+type ResampledRaster struct {
+	src          Raster
+	width        int
+	height       int
+	scaleX       float64
+	scaleY       float64
+	method       ResampleMethod
+	nodata       *float64
+	srcNoData    *float64
+	geoTransform [6]float64
+	sampler      *rasterSampler
+	rng          *[2]float64
+	lock         sync.Mutex
+}
+
+// NewResampledRaster divides the resolution of src by factor, a factor above
+// one gives a coarser grid. Curvilinear sources are not supported.
+func NewResampledRaster(src Raster, factor float64, method ResampleMethod) *ResampledRaster {
+	if src == nil || factor <= 0 {
+		return nil
+	}
+	w, h := src.Size()
+	return NewResampledRasterWithSize(src, maxInt(1, int(math.Round(float64(w)/factor))), maxInt(1, int(math.Round(float64(h)/factor))), method)
+}
+
+func NewResampledRasterWithSize(src Raster, width, height int, method ResampleMethod) *ResampledRaster {
+	if src == nil || width <= 0 || height <= 0 || rasterNodeCoordinates(src) != nil {
+		return nil
+	}
+	w, h := src.Size()
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+	r := &ResampledRaster{src: src, width: width, height: height, method: method, srcNoData: src.NoData()}
+	r.scaleX, r.scaleY = float64(w)/float64(width), float64(h)/float64(height)
+
+	gt := src.GeoTransform()
+	r.geoTransform = [6]float64{gt[0], gt[1] * r.scaleX, gt[2] * r.scaleY, gt[3], gt[4] * r.scaleX, gt[5] * r.scaleY}
+
+	if nodata := src.NoData(); nodata != nil {
+		v := *nodata
+		r.nodata = &v
+	}
+	r.sampler = newRasterSampler(src, int(math.Ceil(r.scaleY))+4)
+	return r
+}
+
+func (r *ResampledRaster) Source() Raster {
+	return r.src
+}
+
+func (r *ResampledRaster) Method() ResampleMethod {
+	return r.method
+}
+
+func (r *ResampledRaster) aggregating() bool {
+	return r.method == RESAMPLE_AVERAGE || r.method == RESAMPLE_MIN || r.method == RESAMPLE_MAX
+}
+
+// footprint returns the source pixels [x0, x1) x [y0, y1) under a target pixel.
+func (r *ResampledRaster) footprint(x, y int) (x0, y0, x1, y1 int) {
+	w, h := r.sampler.width, r.sampler.height
+	x0 = int(math.Floor(float64(x)*r.scaleX + 1e-9))
+	y0 = int(math.Floor(float64(y)*r.scaleY + 1e-9))
+	x1 = maxInt(x0+1, int(math.Ceil(float64(x+1)*r.scaleX-1e-9)))
+	y1 = maxInt(y0+1, int(math.Ceil(float64(y+1)*r.scaleY-1e-9)))
+	return x0, y0, minInt(x1, w), minInt(y1, h)
+}
+
+func (r *ResampledRaster) aggregate(x0, y0, x1, y1 int, lines [][]float64) float64 {
+	sum, count := 0.0, 0
+	min, max := math.MaxFloat64, -math.MaxFloat64
+	for j := y0; j < y1; j++ {
+		line := lines[j-y0]
+		for i := x0; i < x1; i++ {
+			v := line[i]
+			if isNoData(v, r.srcNoData) {
+				continue
+			}
+			sum += v
+			count++
+			min, max = math.Min(min, v), math.Max(max, v)
+		}
+	}
+	if count == 0 {
+		return noDataValue(r.nodata)
+	}
+	switch r.method {
+	case RESAMPLE_MIN:
+		return min
+	case RESAMPLE_MAX:
+		return max
+	}
+	return sum / float64(count)
+}
+
+func (r *ResampledRaster) rows(y0, y1 int) ([][]float64, error) {
+	lines := make([][]float64, y1-y0)
+	for j := y0; j < y1; j++ {
+		line, err := r.sampler.cache.line(j)
+		if err != nil {
+			return nil, err
+		}
+		lines[j-y0] = line
+	}
+	return lines, nil
+}
+
+func (r *ResampledRaster) interpolate(x, y int) float64 {
+	if v, ok := r.sampler.sample((float64(x)+0.5)*r.scaleX, (float64(y)+0.5)*r.scaleY, r.method); ok {
+		return v
+	}
+	return noDataValue(r.nodata)
+}
+
+func (r *ResampledRaster) Size() (w, h int) {
+	return r.width, r.height
+}
+
+func (r *ResampledRaster) Elevation(x, y int) float64 {
+	if x < 0 || y < 0 || x >= r.width || y >= r.height {
+		return math.NaN()
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.aggregating() {
+		return r.interpolate(x, y)
+	}
+	x0, y0, x1, y1 := r.footprint(x, y)
+	lines, err := r.rows(y0, y1)
+	if err != nil {
+		return math.NaN()
+	}
+	return r.aggregate(x0, y0, x1, y1, lines)
+}
+
+func (r *ResampledRaster) FetchLine(y int, line []float64) error {
+	if y < 0 || y >= r.height {
+		return errors.New("line out of range")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.aggregating() {
+		for x := range line {
+			if x >= r.width {
+				break
+			}
+			line[x] = r.interpolate(x, y)
+		}
+		return nil
+	}
+
+	_, y0, _, y1 := r.footprint(0, y)
+	lines, err := r.rows(y0, y1)
+	if err != nil {
+		return err
+	}
+	for x := range line {
+		if x >= r.width {
+			break
+		}
+		x0, _, x1, _ := r.footprint(x, y)
+		line[x] = r.aggregate(x0, y0, x1, y1, lines)
+	}
+	return nil
+}
+
+func (r *ResampledRaster) Srs() geo.Proj {
+	return r.src.Srs()
+}
+
+func (r *ResampledRaster) Bounds() vec2d.Rect {
+	return geoTransformBounds(r.geoTransform, r.width, r.height)
+}
+
+func (r *ResampledRaster) NoData() *float64 {
+	return r.nodata
+}
+
+func (r *ResampledRaster) GeoTransform() [6]float64 {
+	return r.geoTransform
+}
+
+func (r *ResampledRaster) Range() [2]float64 {
+	if r.rng != nil {
+		return *r.rng
+	}
+	min, max := math.MaxFloat64, -math.MaxFloat64
+	line := make([]float64, r.width)
+	for y := 0; y < r.height; y++ {
+		if err := r.FetchLine(y, line); err != nil {
+			return [2]float64{}
+		}
+		for _, d := range line {
+			if isNoData(d, r.nodata) {
+				continue
+			}
+			min, max = math.Min(min, d), math.Max(max, d)
+		}
+	}
+	r.rng = &[2]float64{min, max}
+	return *r.rng
+}
+
+// ResampledLoader resamples every raster of another loader, so the tiles of a
+// TiledRasterProvider can be contoured at a lower resolution.
+type ResampledLoader struct {
+	loader RasterLoader
+	factor float64
+	method ResampleMethod
+}
+
+func NewResampledLoader(loader RasterLoader, factor float64, method ResampleMethod) RasterLoader {
+	if loader == nil || factor <= 0 {
+		return nil
+	}
+	return &ResampledLoader{loader: loader, factor: factor, method: method}
+}
+
+func (l *ResampledLoader) Load(coord [3]int) Raster {
+	src := l.loader.Load(coord)
+	if src == nil {
+		return nil
+	}
+	if r := NewResampledRaster(src, l.factor, l.method); r != nil {
+		return r
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package contour
+
+import (
+	"math"
+	"testing"
+
+	"github.com/flywave/go-geo"
+)
+
+// 测试降采样的聚合方式和地理变换
+func TestResampledRaster(t *testing.T) {
+	nodata := -1.0
+	data := []float64{
+		0, 1, 2, 3,
+		4, 5, 6, 7,
+		8, 9, -1, -1,
+		12, 13, -1, -1,
+	}
+	src := NewMemoryRaster(data, 4, 4, [6]float64{100, 10, 0, 200, 0, -10}, geo.NewProj(3857), &nodata)
+
+	cases := []struct {
+		method   ResampleMethod
+		expected []float64
+	}{
+		{RESAMPLE_AVERAGE, []float64{2.5, 4.5, 10.5, -1}},
+		{RESAMPLE_MIN, []float64{0, 2, 8, -1}},
+		{RESAMPLE_MAX, []float64{5, 7, 13, -1}},
+	}
+	for _, c := range cases {
+		r := NewResampledRaster(src, 2, c.method)
+		if r == nil {
+			t.Fatal("failed to resample")
+		}
+		if w, h := r.Size(); w != 2 || h != 2 {
+			t.Fatalf("unexpected size %dx%d", w, h)
+		}
+		if r.GeoTransform() != [6]float64{100, 20, 0, 200, 0, -20} {
+			t.Errorf("unexpected geotransform %v", r.GeoTransform())
+		}
+		if r.Bounds() != src.Bounds() {
+			t.Errorf("unexpected bounds %v", r.Bounds())
+		}
+		line := make([]float64, 2)
+		for y := 0; y < 2; y++ {
+			if err := r.FetchLine(y, line); err != nil {
+				t.Fatal(err)
+			}
+			for x := 0; x < 2; x++ {
+				if line[x] != c.expected[y*2+x] || r.Elevation(x, y) != line[x] {
+					t.Errorf("method %d pixel %d,%d: expected %f, got %f", c.method, x, y, c.expected[y*2+x], line[x])
+				}
+			}
+		}
+	}
+
+	up := NewResampledRaster(src, 0.5, RESAMPLE_BILINEAR)
+	if w, h := up.Size(); w != 8 || h != 8 {
+		t.Fatalf("unexpected size %dx%d", w, h)
+	}
+	if gt := up.GeoTransform(); gt[1] != 5 || gt[5] != -5 {
+		t.Errorf("unexpected geotransform %v", gt)
+	}
+	// (1.5,1.5) 像元中心位于源像元 0,1,4,5 的中间
+	if v := up.Elevation(1, 1); math.Abs(v-1.25) > 1e-9 {
+		t.Errorf("expected 1.25, got %f", v)
+	}
+	if v := up.Elevation(6, 6); v != -1 {
+		t.Errorf("expected nodata, got %f", v)
+	}
+}
+
+// 测试源栅格没有无效值时, 无数据的像元为 NaN, -9999 仍是有效值
+func TestResampledRasterWithoutNoData(t *testing.T) {
+	nan := math.NaN()
+	data := []float64{
+		-9999, -9999, 1, 1,
+		-9999, -9999, 1, 1,
+		nan, nan, 2, 2,
+		nan, nan, 2, 2,
+	}
+	src := NewMemoryRaster(data, 4, 4, [6]float64{100, 10, 0, 200, 0, -10}, geo.NewProj(3857), nil)
+	r := NewResampledRaster(src, 2, RESAMPLE_AVERAGE)
+	if r == nil {
+		t.Fatal("failed to resample")
+	}
+	if r.NoData() != nil {
+		t.Fatalf("expected no nodata, got %v", *r.NoData())
+	}
+	if v := r.Elevation(0, 0); v != -9999 || isNoData(v, r.NoData()) {
+		t.Errorf("expected a valid -9999, got %f", v)
+	}
+	if v := r.Elevation(0, 1); !math.IsNaN(v) {
+		t.Errorf("expected NaN, got %f", v)
+	}
+	if rng := r.Range(); rng[0] != -9999 || rng[1] != 2 {
+		t.Errorf("unexpected range %v", rng)
+	}
+}
+
+// 测试降采样后的栅格可以生成等值线，并通过瓦片加载器使用
+func TestResampledRasterContourGenerate(t *testing.T) {
+	r := NewResampledRaster(newConeRaster(64, nil), 4, RESAMPLE_AVERAGE)
+	writer := NewMockGeometryWriter()
+	if err := ContourGenerate(r, writer, ContourGenerateOptions{Base: 0, Interval: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.writtenGeom) == 0 {
+		t.Error("expected contours from resampled raster")
+	}
+
+	loader := NewResampledLoader(NewMapBoxDemLoader("./data", "{z}_{x}_{y}.webp"), 2, RESAMPLE_AVERAGE)
+	tile := loader.Load([3]int{13565, 6403, 14})
+	if tile == nil {
+		t.Fatal("failed to load resampled tile")
+	}
+	full := NewMapBoxDemLoader("./data", "{z}_{x}_{y}.webp").Load([3]int{13565, 6403, 14})
+	w, h := tile.Size()
+	fw, fh := full.Size()
+	if w != fw/2 || h != fh/2 {
+		t.Errorf("unexpected tile size %dx%d", w, h)
+	}
+	if b, fb := tile.Bounds(), full.Bounds(); math.Abs(b.Min[0]-fb.Min[0]) > 1e-6 || math.Abs(b.Max[1]-fb.Max[1]) > 1e-6 || math.Abs(b.Max[0]-fb.Max[0]) > 1e-6 || math.Abs(b.Min[1]-fb.Min[1]) > 1e-6 {
+		t.Errorf("unexpected tile bounds %v", tile.Bounds())
+	}
+}
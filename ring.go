@@ -8,6 +8,7 @@ type Ring struct {
 	closestExterior *Ring
 }
 
+// isIn reports whether the first point of r lies within the polygon of o.
 func (r *Ring) isIn(o *Ring) bool {
 	if len(o.points) < 4 {
 		return false
@@ -34,7 +35,7 @@ func (r *Ring) isIn(o *Ring) bool {
 		return false
 	}
 
-	return poly.Within(gpt)
+	return gpt.Within(poly)
 }
 
 func (r *Ring) checkInclusionWith(other *Ring) {
@@ -0,0 +1,30 @@
+package contour
+
+import "testing"
+
+func squareRing(min, max float64) *Ring {
+	return &Ring{points: LineString{{min, min}, {max, min}, {max, max}, {min, max}, {min, min}}}
+}
+
+// 测试嵌套环的洞归属: 点在多边形内才算包含, 以前多边形在点内的判断使所有环都成为外环
+func TestRingInclusion(t *testing.T) {
+	outer, hole, island := squareRing(0, 10), squareRing(2, 8), squareRing(4, 6)
+	if !hole.isIn(outer) || outer.isIn(hole) {
+		t.Fatal("expected the inner square to be in the outer one only")
+	}
+
+	rings := []*Ring{outer, hole, island}
+	for _, r := range rings {
+		for _, o := range rings {
+			if r != o {
+				r.checkInclusionWith(o)
+			}
+		}
+	}
+	if outer.isInnerRing() || !hole.isInnerRing() || island.isInnerRing() {
+		t.Fatalf("expected only the middle ring to be a hole, got %v %v %v", outer.isInnerRing(), hole.isInnerRing(), island.isInnerRing())
+	}
+	if hole.closestExterior != outer || island.closestExterior != hole {
+		t.Fatal("expected each ring to be assigned its closest exterior")
+	}
+}
@@ -100,6 +100,20 @@ func (s *SegmentMerger) addSegment(levelIdx int, start, end Point, border bool)
 	*newLine = append(*newLine, start, end)
 	merged := false
 
+	// 线段连接两条不同的线时, 把两条线经由该线段连起来
+	startElem, found := endMap[start.Key()]
+	if !found {
+		startElem = startMap[start.Key()]
+	}
+	endElem, found := startMap[end.Key()]
+	if !found {
+		endElem = endMap[end.Key()]
+	}
+	if startElem != nil && endElem != nil && startElem != endElem && !s.closesLine(startElem, start, end) {
+		s.joinLines(levelIdx, startElem, endElem, start, end)
+		return
+	}
+
 	if elem, found := endMap[start.Key()]; found {
 		merged = s.mergeLines(elem, newLine, true, levelIdx)
 	}
@@ -232,6 +246,51 @@ func (s *SegmentMerger) mergeTailTail(existingElem *list.Element, newLine *LineS
 	return true
 }
 
+// closesLine reports whether the segment from start to end connects both ends
+// of the line in elem.
+func (s *SegmentMerger) closesLine(elem *list.Element, start, end Point) bool {
+	ls := *elem.Value.(*LineString)
+	return (ls.IsBack(&start) && ls.IsFront(&end)) || (ls.IsFront(&start) && ls.IsBack(&end))
+}
+
+// joinLines replaces the lines of a and b by a single line running through
+// a, the segment from start to end and b, a closed result is emitted.
+func (s *SegmentMerger) joinLines(levelIdx int, a, b *list.Element, start, end Point) {
+	startMap := s.startMap[levelIdx]
+	endMap := s.endMap[levelIdx]
+
+	for _, e := range []*list.Element{a, b} {
+		ls := e.Value.(*LineString)
+		for _, m := range []map[string]*list.Element{startMap, endMap} {
+			for _, p := range []*Point{ls.front(), ls.back()} {
+				if m[p.Key()] == e {
+					delete(m, p.Key())
+				}
+			}
+		}
+	}
+
+	la := append(LineString{}, *a.Value.(*LineString)...)
+	lb := append(LineString{}, *b.Value.(*LineString)...)
+	if !la.IsBack(&start) {
+		la.Reverse()
+	}
+	if !lb.IsFront(&end) {
+		lb.Reverse()
+	}
+	merged := s.getLineString()
+	*merged = append(la, lb...)
+	a.Value = merged
+	s.lines[levelIdx].Remove(b)
+
+	if s.polygonize && merged.IsClosed() {
+		s.emitLine(levelIdx, a, true)
+		return
+	}
+	startMap[(*merged)[0].Key()] = a
+	endMap[(*merged)[len(*merged)-1].Key()] = a
+}
+
 func (s *SegmentMerger) emitLine(levelIdx int, elem *list.Element, closed bool) {
 	lsPtr := elem.Value.(*LineString)
 	s.lineWriter.AddLine(s.levelGenerator.Level(levelIdx), *lsPtr, closed)
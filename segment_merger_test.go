@@ -238,3 +238,61 @@ func TestSegmentMergerCloseUnclosedContours(t *testing.T) {
 		t.Error("Expected emitted line to be unclosed")
 	}
 }
+
+func checkMergedLine(t *testing.T, merger *SegmentMerger, expected []Point) {
+	t.Helper()
+	if merger.lines[0].Len() != 1 {
+		t.Fatalf("Expected 1 line after joining, got %d", merger.lines[0].Len())
+	}
+	line := *merger.lines[0].Front().Value.(*LineString)
+	if len(line) != len(expected) {
+		t.Fatalf("Expected %d points, got %v", len(expected), line)
+	}
+	for i, pt := range expected {
+		if !line[i].Eq(&pt, EPS) {
+			t.Errorf("Point %d mismatch: expected %v, got %v", i, pt, line[i])
+		}
+	}
+	if len(merger.startMap[0]) != 1 || len(merger.endMap[0]) != 1 {
+		t.Errorf("Expected one start and end entry, got %v %v", merger.startMap[0], merger.endMap[0])
+	}
+}
+
+// 测试线段把一条线的尾和另一条线的头连成一条线
+func TestSegmentMergerJoinHeadTail(t *testing.T) {
+	merger := NewSegmentMerger(false, &MockLineWriter{}, &MockLevelGenerator{levels: []float64{10.0}})
+	merger.AddSegment(0, Point{0, 0}, Point{1, 0})
+	merger.AddSegment(0, Point{2, 0}, Point{3, 0})
+	merger.AddSegment(0, Point{1, 0}, Point{2, 0})
+	checkMergedLine(t, merger, []Point{{0, 0}, {1, 0}, {2, 0}, {3, 0}})
+}
+
+// 测试线段把两条线的头连成一条线
+func TestSegmentMergerJoinHeadHead(t *testing.T) {
+	merger := NewSegmentMerger(false, &MockLineWriter{}, &MockLevelGenerator{levels: []float64{10.0}})
+	merger.AddSegment(0, Point{1, 0}, Point{0, 0})
+	merger.AddSegment(0, Point{2, 0}, Point{3, 0})
+	merger.AddSegment(0, Point{1, 0}, Point{2, 0})
+	checkMergedLine(t, merger, []Point{{0, 0}, {1, 0}, {2, 0}, {3, 0}})
+}
+
+// 测试连接后的线被最后一条线段闭合时只输出一次
+func TestSegmentMergerJoinClosesRing(t *testing.T) {
+	mockWriter := &MockLineWriter{}
+	merger := NewSegmentMerger(true, mockWriter, &MockLevelGenerator{levels: []float64{10.0}})
+	merger.AddSegment(0, Point{0, 0}, Point{1, 0})
+	merger.AddSegment(0, Point{1, 1}, Point{0, 1})
+	merger.AddSegment(0, Point{5, 5}, Point{6, 6})
+	merger.AddSegment(0, Point{1, 0}, Point{1, 1})
+	merger.AddSegment(0, Point{0, 1}, Point{0, 0})
+
+	if len(mockWriter.lines) != 1 || !mockWriter.lines[0].closed || len(mockWriter.lines[0].ls) != 5 {
+		t.Fatalf("Expected one closed ring of 5 points, got %v", mockWriter.lines)
+	}
+	if merger.lines[0].Len() != 1 {
+		t.Errorf("Expected only the unrelated line to remain, got %d", merger.lines[0].Len())
+	}
+	if len(merger.startMap[0]) != 1 || len(merger.endMap[0]) != 1 {
+		t.Errorf("Expected no orphan entries, got %v %v", merger.startMap[0], merger.endMap[0])
+	}
+}
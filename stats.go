@@ -0,0 +1,215 @@
+package contour
+
+import (
+	"math"
+	"reflect"
+	"sync"
+)
+
+const defaultStatisticsCacheSize = 256
+
+// RasterStatistics describes the valid pixels of a raster, NoData and NaN are skipped.
+type RasterStatistics struct {
+	Min        float64
+	Max        float64
+	Mean       float64
+	StdDev     float64
+	ValidCount int64
+}
+
+func (s RasterStatistics) Range() [2]float64 {
+	return [2]float64{s.Min, s.Max}
+}
+
+type rasterStatisticsEntry struct {
+	stats      *RasterStatistics
+	histograms map[int][]int64
+}
+
+// StatisticsCache keeps the statistics and histograms of up to capacity
+// rasters. It is owned by the caller, so cached rasters are released together
+// with it.
+type StatisticsCache struct {
+	entries *lruCache[Raster, *rasterStatisticsEntry]
+	lock    sync.Mutex
+}
+
+func NewStatisticsCache(capacity int) *StatisticsCache {
+	if capacity <= 0 {
+		capacity = defaultStatisticsCacheSize
+	}
+	return &StatisticsCache{entries: newLRUCache[Raster, *rasterStatisticsEntry](capacity)}
+}
+
+// entry returns nil for rasters that can not be used as map keys.
+func (c *StatisticsCache) entry(r Raster) *rasterStatisticsEntry {
+	if !reflect.TypeOf(r).Comparable() {
+		return nil
+	}
+	if e, ok := c.entries.get(r); ok {
+		return e
+	}
+	e := &rasterStatisticsEntry{histograms: make(map[int][]int64)}
+	c.entries.put(r, e)
+	return e
+}
+
+func computeStatistics(r Raster) (*RasterStatistics, error) {
+	w, h := r.Size()
+	nodata := r.NoData()
+	line := make([]float64, w)
+
+	// Welford's online algorithm keeps the variance stable on large rasters
+	stats := &RasterStatistics{Min: math.MaxFloat64, Max: -math.MaxFloat64}
+	mean, m2 := 0.0, 0.0
+	for y := 0; y < h; y++ {
+		if err := r.FetchLine(y, line); err != nil {
+			return nil, err
+		}
+		for _, v := range line {
+			if isNoData(v, nodata) || math.IsInf(v, 0) {
+				continue
+			}
+			stats.ValidCount++
+			stats.Min, stats.Max = math.Min(stats.Min, v), math.Max(stats.Max, v)
+			d := v - mean
+			mean += d / float64(stats.ValidCount)
+			m2 += d * (v - mean)
+		}
+	}
+	if stats.ValidCount == 0 {
+		return &RasterStatistics{}, nil
+	}
+	stats.Mean = mean
+	stats.StdDev = math.Sqrt(m2 / float64(stats.ValidCount))
+	return stats, nil
+}
+
+func computeHistogram(r Raster, stats *RasterStatistics, bins int) ([]int64, error) {
+	w, h := r.Size()
+	nodata := r.NoData()
+	line := make([]float64, w)
+	hist := make([]int64, bins)
+	if stats.ValidCount == 0 {
+		return hist, nil
+	}
+	width := (stats.Max - stats.Min) / float64(bins)
+	for y := 0; y < h; y++ {
+		if err := r.FetchLine(y, line); err != nil {
+			return nil, err
+		}
+		for _, v := range line {
+			if isNoData(v, nodata) || math.IsInf(v, 0) {
+				continue
+			}
+			i := bins - 1
+			if width > 0 {
+				i = minInt(int((v-stats.Min)/width), bins-1)
+			}
+			hist[maxInt(i, 0)]++
+		}
+	}
+	return hist, nil
+}
+
+// Statistics scans all pixels of the raster, use a StatisticsCache to keep
+// the result.
+func Statistics(r Raster) (RasterStatistics, error) {
+	stats, err := computeStatistics(r)
+	if err != nil {
+		return RasterStatistics{}, err
+	}
+	return *stats, nil
+}
+
+// Histogram counts the valid pixels in bins equal intervals between the
+// minimum and the maximum.
+func Histogram(r Raster, bins int) ([]int64, error) {
+	if bins <= 0 {
+		return nil, nil
+	}
+	stats, err := computeStatistics(r)
+	if err != nil {
+		return nil, err
+	}
+	return computeHistogram(r, stats, bins)
+}
+
+func (c *StatisticsCache) Statistics(r Raster) (RasterStatistics, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.statistics(r)
+}
+
+func (c *StatisticsCache) statistics(r Raster) (RasterStatistics, error) {
+	e := c.entry(r)
+	if e != nil && e.stats != nil {
+		return *e.stats, nil
+	}
+	stats, err := computeStatistics(r)
+	if err != nil {
+		return RasterStatistics{}, err
+	}
+	if e != nil {
+		e.stats = stats
+	}
+	return *stats, nil
+}
+
+func (c *StatisticsCache) Histogram(r Raster, bins int) ([]int64, error) {
+	if bins <= 0 {
+		return nil, nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	stats, err := c.statistics(r)
+	if err != nil {
+		return nil, err
+	}
+	e := c.entry(r)
+	if e != nil {
+		if hist, ok := e.histograms[bins]; ok {
+			return hist, nil
+		}
+	}
+	hist, err := computeHistogram(r, &stats, bins)
+	if err != nil {
+		return nil, err
+	}
+	if e != nil {
+		e.histograms[bins] = hist
+	}
+	return hist, nil
+}
+
+// Clear drops the cached statistics of a raster whose data changed.
+func (c *StatisticsCache) Clear(r Raster) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if reflect.TypeOf(r).Comparable() {
+		c.entries.remove(r)
+	}
+}
+
+// rasterRange is the value range used for contour levels. The rasters cache
+// Range or read it from metadata, so it is asked first, a full statistics
+// pass is only made when it reports nodata or NaN. The pass is kept in cache
+// when it is set.
+func rasterRange(r Raster, cache *StatisticsCache) [2]float64 {
+	rng := r.Range()
+	if !isNoData(rng[0], r.NoData()) && !isNoData(rng[1], r.NoData()) {
+		return rng
+	}
+	var stats RasterStatistics
+	var err error
+	if cache != nil {
+		stats, err = cache.Statistics(r)
+	} else {
+		stats, err = Statistics(r)
+	}
+	if err != nil || stats.ValidCount == 0 {
+		return rng
+	}
+	return stats.Range()
+}
@@ -0,0 +1,116 @@
+package contour
+
+import (
+	"math"
+	"testing"
+)
+
+// rangeRaster 报告给定的范围并统计读取的行数
+type rangeRaster struct {
+	*MemoryRaster
+	rng     [2]float64
+	fetches int
+}
+
+func (r *rangeRaster) Range() [2]float64 {
+	return r.rng
+}
+
+func (r *rangeRaster) FetchLine(y int, line []float64) error {
+	r.fetches++
+	return r.MemoryRaster.FetchLine(y, line)
+}
+
+// 测试统计信息跳过无效值和 NaN，并且由调用方的缓存按栅格缓存
+func TestStatistics(t *testing.T) {
+	nodata := -9999.0
+	data := []float64{1, 2, -9999, 3, math.NaN(), 4, 5, -9999, 6}
+	r := NewMemoryRaster(data, 3, 3, [6]float64{0, 1, 0, 3, 0, -1}, nil, &nodata)
+
+	stats, err := Statistics(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.ValidCount != 6 || stats.Min != 1 || stats.Max != 6 {
+		t.Errorf("unexpected statistics %+v", stats)
+	}
+	if math.Abs(stats.Mean-3.5) > 1e-12 || math.Abs(stats.StdDev-math.Sqrt(17.5/6)) > 1e-12 {
+		t.Errorf("unexpected mean %f or stddev %f", stats.Mean, stats.StdDev)
+	}
+
+	hist, err := Histogram(r, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []int64{1, 1, 1, 1, 2}
+	for i := range expected {
+		if hist[i] != expected[i] {
+			t.Fatalf("unexpected histogram %v", hist)
+		}
+	}
+
+	cache := NewStatisticsCache(2)
+	if stats, _ := cache.Statistics(r); stats.Min != 1 {
+		t.Errorf("unexpected cached statistics %+v", stats)
+	}
+	if hist, _ := cache.Histogram(r, 5); len(hist) != 5 || hist[4] != 2 {
+		t.Errorf("unexpected cached histogram %v", hist)
+	}
+	data[0] = -100
+	if stats, _ := cache.Statistics(r); stats.Min != 1 {
+		t.Error("expected cached statistics")
+	}
+	if stats, _ := Statistics(r); stats.Min != -100 {
+		t.Errorf("expected uncached statistics to see the change, got %+v", stats)
+	}
+	cache.Clear(r)
+	if stats, _ := cache.Statistics(r); stats.Min != -100 {
+		t.Errorf("expected recomputed statistics, got %+v", stats)
+	}
+
+	empty := NewMemoryRaster([]float64{-9999, -9999}, 2, 1, [6]float64{0, 1, 0, 1, 0, -1}, nil, &nodata)
+	if stats, _ := Statistics(empty); stats.ValidCount != 0 {
+		t.Errorf("expected no valid pixels, got %+v", stats)
+	}
+}
+
+// 测试等值线范围优先使用栅格自身的范围, 仅在其包含无效值时扫描统计
+func TestRasterRange(t *testing.T) {
+	nodata := -9999.0
+	data := []float64{1, 2, -9999, 3, 4, 5}
+	src := NewMemoryRaster(data, 3, 2, [6]float64{0, 1, 0, 2, 0, -1}, nil, &nodata)
+
+	cheap := &rangeRaster{MemoryRaster: src, rng: [2]float64{-10, 10}}
+	if rng := rasterRange(cheap, nil); rng != [2]float64{-10, 10} || cheap.fetches != 0 {
+		t.Errorf("expected the raster range without reading lines, got %v after %d reads", rng, cheap.fetches)
+	}
+	withNoData := &rangeRaster{MemoryRaster: src, rng: [2]float64{-9999, 5}}
+	if rng := rasterRange(withNoData, nil); rng != [2]float64{1, 5} || withNoData.fetches == 0 {
+		t.Errorf("expected the range from statistics, got %v", rng)
+	}
+}
+
+// 测试生成等值线时范围只扫描一次, 传入的缓存在多次调用间保留范围
+func TestContourGenerateRangeScannedOnce(t *testing.T) {
+	nodata := -9999.0
+	data := []float64{1, 2, 3, 4, -9999, 6, 7, 8, 9}
+	src := NewMemoryRaster(data, 3, 3, [6]float64{0, 1, 0, 3, 0, -1}, nil, &nodata)
+	options := ContourGenerateOptions{Polygonize: true, FixedLevels: []float64{2.5, 5.5}}
+
+	clean := &rangeRaster{MemoryRaster: src, rng: [2]float64{1, 9}}
+	ContourGenerate(clean, NewMockGeometryWriter(), options)
+
+	leaky := &rangeRaster{MemoryRaster: src, rng: [2]float64{-9999, 9}}
+	ContourGenerate(leaky, NewMockGeometryWriter(), options)
+	if leaky.fetches != clean.fetches+3 {
+		t.Errorf("expected one statistics pass of 3 lines, got %d reads against %d", leaky.fetches, clean.fetches)
+	}
+
+	options.Statistics = NewStatisticsCache(1)
+	cached := &rangeRaster{MemoryRaster: src, rng: [2]float64{-9999, 9}}
+	ContourGenerate(cached, NewMockGeometryWriter(), options)
+	ContourGenerate(cached, NewMockGeometryWriter(), options)
+	if cached.fetches != 2*clean.fetches+3 {
+		t.Errorf("expected the cached range to be reused, got %d reads against %d", cached.fetches, clean.fetches)
+	}
+}
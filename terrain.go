@@ -0,0 +1,299 @@
+package contour
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/flywave/go-geo"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+type TerrainDerivative uint8
+
+const (
+	TERRAIN_SLOPE_DEGREES TerrainDerivative = iota
+	TERRAIN_SLOPE_PERCENT
+	TERRAIN_ASPECT
+	TERRAIN_PROFILE_CURVATURE
+	TERRAIN_PLAN_CURVATURE
+	TERRAIN_HILLSHADE
+)
+
+// metersPerDegree is the length of one degree on the WGS84 equator.
+const metersPerDegree = 2 * math.Pi * 6378137 / 360
+
+type TerrainOptions struct {
+	// ZFactor scales elevations into the horizontal unit, 0 means 1.
+	ZFactor float64
+	// Azimuth and Altitude of the light source for hillshade in degrees,
+	// both 0 mean the usual 315 and 45.
+	Azimuth  float64
+	Altitude float64
+}
+
+// TerrainRaster derives slope, aspect, curvature or hillshade from the 3x3
+// window of every pixel while streaming the lines of its source. Geographic
+// sources have their cell size converted to meters per row, curvilinear
+// sources take it from the spacing of their nodes. Missing
+// neighbours are extrapolated from the opposite one or take the center
+// value, nodata centers become defaultNoData.
+type TerrainRaster struct {
+	src        Raster
+	derivative TerrainDerivative
+	options    TerrainOptions
+	width      int
+	height     int
+	cache      *lineCache
+	coords     *NodeCoordinates
+	rows       [3][]float64
+	window     [3][3]float64
+	nodata     *float64
+	rng        *[2]float64
+	lock       sync.Mutex
+}
+
+func NewTerrainRaster(src Raster, derivative TerrainDerivative, options TerrainOptions) *TerrainRaster {
+	if src == nil || derivative > TERRAIN_HILLSHADE {
+		return nil
+	}
+	if options.ZFactor == 0 {
+		options.ZFactor = 1
+	}
+	if options.Azimuth == 0 && options.Altitude == 0 {
+		options.Azimuth, options.Altitude = 315, 45
+	}
+	nodata := defaultNoData
+	w, h := src.Size()
+	return &TerrainRaster{src: src, derivative: derivative, options: options, width: w, height: h, cache: newLineCache(src, 4), coords: rasterNodeCoordinates(src), nodata: &nodata}
+}
+
+func (r *TerrainRaster) Source() Raster {
+	return r.src
+}
+
+func (r *TerrainRaster) Derivative() TerrainDerivative {
+	return r.derivative
+}
+
+func (r *TerrainRaster) load(y int) error {
+	for dy := -1; dy <= 1; dy++ {
+		r.rows[dy+1] = nil
+		if y+dy < 0 || y+dy >= r.height {
+			continue
+		}
+		line, err := r.cache.line(y + dy)
+		if err != nil {
+			return err
+		}
+		r.rows[dy+1] = line
+	}
+	return nil
+}
+
+// cellSize returns the pixel size at x, y in the horizontal unit.
+func (r *TerrainRaster) cellSize(x, y int) (float64, float64) {
+	if r.coords != nil {
+		return r.coords.cellSize(x, y)
+	}
+	gt := r.src.GeoTransform()
+	dx, dy := math.Hypot(gt[1], gt[4]), math.Hypot(gt[2], gt[5])
+	if srs := r.src.Srs(); srs != nil && srs.IsLatLong() {
+		lat := gt[3] + gt[5]*(float64(y)+0.5)
+		dx *= metersPerDegree * math.Cos(lat*math.Pi/180)
+		dy *= metersPerDegree
+	}
+	return dx, dy
+}
+
+// value computes the derivative at x of the loaded rows.
+func (r *TerrainRaster) value(x int, dx, dy float64) float64 {
+	srcNoData := r.src.NoData()
+	center := r.rows[1][x]
+	if isNoData(center, srcNoData) {
+		return *r.nodata
+	}
+	// window is oriented north up and east right
+	gt := r.src.GeoTransform()
+	for j := 0; j < 3; j++ {
+		row := r.rows[j]
+		if gt[5] > 0 {
+			row = r.rows[2-j]
+		}
+		for i := 0; i < 3; i++ {
+			c := x + i - 1
+			if gt[1] < 0 {
+				c = x + 1 - i
+			}
+			v := math.NaN()
+			if row != nil && c >= 0 && c < r.width && !isNoData(row[c], srcNoData) {
+				v = row[c]
+			}
+			r.window[j][i] = v
+		}
+	}
+	z := &r.window
+	valid := *z
+	for j := 0; j < 3; j++ {
+		for i := 0; i < 3; i++ {
+			if o := valid[2-j][2-i]; math.IsNaN(z[j][i]) && !math.IsNaN(o) {
+				z[j][i] = 2*center - o
+			}
+		}
+	}
+	for j := 0; j < 3; j++ {
+		for i := 0; i < 3; i++ {
+			if !math.IsNaN(z[j][i]) {
+				continue
+			}
+			// corners without an opposite neighbour follow the plane of
+			// their row and column
+			if v := z[j][1] + z[1][i] - center; j != 1 && i != 1 && !math.IsNaN(v) {
+				z[j][i] = v
+			} else {
+				z[j][i] = center
+			}
+		}
+	}
+	for j := 0; j < 3; j++ {
+		for i := 0; i < 3; i++ {
+			z[j][i] *= r.options.ZFactor
+		}
+	}
+	if r.derivative == TERRAIN_PROFILE_CURVATURE || r.derivative == TERRAIN_PLAN_CURVATURE {
+		return zevenbergenCurvature(z, dx, dy, r.derivative == TERRAIN_PLAN_CURVATURE)
+	}
+
+	// Horn's gradient towards east and north
+	p := ((z[0][2] + 2*z[1][2] + z[2][2]) - (z[0][0] + 2*z[1][0] + z[2][0])) / (8 * dx)
+	q := ((z[0][0] + 2*z[0][1] + z[0][2]) - (z[2][0] + 2*z[2][1] + z[2][2])) / (8 * dy)
+	gradient := math.Hypot(p, q)
+	switch r.derivative {
+	case TERRAIN_SLOPE_DEGREES:
+		return math.Atan(gradient) * 180 / math.Pi
+	case TERRAIN_SLOPE_PERCENT:
+		return gradient * 100
+	case TERRAIN_ASPECT:
+		if gradient == 0 {
+			return *r.nodata
+		}
+		return downslopeAzimuth(p, q) * 180 / math.Pi
+	}
+	zenith := (90 - r.options.Altitude) * math.Pi / 180
+	azimuth := r.options.Azimuth * math.Pi / 180
+	slope := math.Atan(gradient)
+	shade := math.Cos(zenith) * math.Cos(slope)
+	if gradient > 0 {
+		shade += math.Sin(zenith) * math.Sin(slope) * math.Cos(azimuth-downslopeAzimuth(p, q))
+	}
+	return 255 * math.Max(0, shade)
+}
+
+// downslopeAzimuth is the direction a slope faces, clockwise from north in
+// radians.
+func downslopeAzimuth(p, q float64) float64 {
+	a := math.Atan2(-p, -q)
+	if a < 0 {
+		a += 2 * math.Pi
+	}
+	return a
+}
+
+// zevenbergenCurvature returns the profile or plan curvature of the
+// Zevenbergen and Thorne surface in 1/unit with their signs: profile
+// curvature is positive where the surface is convex along the slope, as on a
+// dome, and negative where it is concave, as in a bowl. Plan curvature is
+// positive where the contours bend around a hollow, as in a bowl, and
+// negative around a dome or spur.
+func zevenbergenCurvature(z *[3][3]float64, dx, dy float64, plan bool) float64 {
+	d := ((z[1][0]+z[1][2])/2 - z[1][1]) / (dx * dx)
+	e := ((z[0][1]+z[2][1])/2 - z[1][1]) / (dy * dy)
+	f := (-z[0][0] + z[0][2] + z[2][0] - z[2][2]) / (4 * dx * dy)
+	g := (z[1][2] - z[1][0]) / (2 * dx)
+	h := (z[0][1] - z[2][1]) / (2 * dy)
+	n := g*g + h*h
+	if n == 0 {
+		return 0
+	}
+	if plan {
+		return 2 * (d*h*h + e*g*g - f*g*h) / n
+	}
+	return -2 * (d*g*g + e*h*h + f*g*h) / n
+}
+
+func (r *TerrainRaster) Size() (w, h int) {
+	return r.width, r.height
+}
+
+func (r *TerrainRaster) Elevation(x, y int) float64 {
+	if x < 0 || y < 0 || x >= r.width || y >= r.height {
+		return math.NaN()
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err := r.load(y); err != nil {
+		return math.NaN()
+	}
+	dx, dy := r.cellSize(x, y)
+	return r.value(x, dx, dy)
+}
+
+func (r *TerrainRaster) FetchLine(y int, line []float64) error {
+	if y < 0 || y >= r.height {
+		return errors.New("line out of range")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err := r.load(y); err != nil {
+		return err
+	}
+	dx, dy := r.cellSize(0, y)
+	for x := range line {
+		if x >= r.width {
+			break
+		}
+		if r.coords != nil {
+			dx, dy = r.cellSize(x, y)
+		}
+		line[x] = r.value(x, dx, dy)
+	}
+	return nil
+}
+
+func (r *TerrainRaster) Srs() geo.Proj {
+	return r.src.Srs()
+}
+
+func (r *TerrainRaster) Bounds() vec2d.Rect {
+	return r.src.Bounds()
+}
+
+func (r *TerrainRaster) NoData() *float64 {
+	return r.nodata
+}
+
+func (r *TerrainRaster) GeoTransform() [6]float64 {
+	return r.src.GeoTransform()
+}
+
+func (r *TerrainRaster) Range() [2]float64 {
+	if r.rng != nil {
+		return *r.rng
+	}
+	min, max := math.MaxFloat64, -math.MaxFloat64
+	line := make([]float64, r.width)
+	for y := 0; y < r.height; y++ {
+		if err := r.FetchLine(y, line); err != nil {
+			return [2]float64{}
+		}
+		for _, d := range line {
+			if isNoData(d, r.nodata) {
+				continue
+			}
+			min, max = math.Min(min, d), math.Max(max, d)
+		}
+	}
+	r.rng = &[2]float64{min, max}
+	return *r.rng
+}
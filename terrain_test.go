@@ -0,0 +1,114 @@
+package contour
+
+import (
+	"math"
+	"testing"
+)
+
+func newFuncRaster(w, h int, gt [6]float64, f func(x, y float64) float64) *MemoryRaster {
+	data := make([]float64, w*h)
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			data[j*w+i] = f(gt[0]+gt[1]*(float64(i)+0.5), gt[3]+gt[5]*(float64(j)+0.5))
+		}
+	}
+	nodata := defaultNoData
+	return NewMemoryRaster(data, w, h, gt, nil, &nodata)
+}
+
+// 测试平面上的坡度, 坡向和山体阴影, 包括边缘像元
+func TestTerrainRasterPlane(t *testing.T) {
+	// 向西下降的平面, 坡度 0.5
+	src := newFuncRaster(5, 4, [6]float64{0, 10, 0, 100, 0, -10}, func(x, y float64) float64 { return 0.5 * x })
+	cases := []struct {
+		derivative TerrainDerivative
+		want       float64
+	}{
+		{TERRAIN_SLOPE_DEGREES, math.Atan(0.5) * 180 / math.Pi},
+		{TERRAIN_SLOPE_PERCENT, 50},
+		{TERRAIN_ASPECT, 270},
+		{TERRAIN_HILLSHADE, 255 * (math.Cos(math.Pi/4)*math.Cos(math.Atan(0.5)) + math.Sin(math.Pi/4)*math.Sin(math.Atan(0.5))*math.Cos(math.Pi/4))},
+		{TERRAIN_PROFILE_CURVATURE, 0},
+	}
+	line := make([]float64, 5)
+	for _, c := range cases {
+		r := NewTerrainRaster(src, c.derivative, TerrainOptions{})
+		for y := 0; y < 4; y++ {
+			if err := r.FetchLine(y, line); err != nil {
+				t.Fatal(err)
+			}
+			for x, v := range line {
+				if math.Abs(v-c.want) > 1e-9 {
+					t.Fatalf("derivative %d at %d,%d: expected %v, got %v", c.derivative, x, y, c.want, v)
+				}
+			}
+		}
+	}
+	if v := NewTerrainRaster(src, TERRAIN_SLOPE_PERCENT, TerrainOptions{ZFactor: 2}).Elevation(2, 2); math.Abs(v-100) > 1e-9 {
+		t.Fatalf("expected z factor to double the slope, got %v", v)
+	}
+}
+
+// 测试无效值像元及其邻域
+func TestTerrainRasterNoData(t *testing.T) {
+	src := newFuncRaster(5, 5, [6]float64{0, 1, 0, 5, 0, -1}, func(x, y float64) float64 { return y })
+	src.data64[2*5+2] = defaultNoData
+	r := NewTerrainRaster(src, TERRAIN_SLOPE_PERCENT, TerrainOptions{})
+	if v := r.Elevation(2, 2); !isNoData(v, r.NoData()) {
+		t.Fatalf("expected nodata, got %v", v)
+	}
+	for _, p := range [][2]int{{1, 2}, {2, 1}, {3, 3}} {
+		if v := r.Elevation(p[0], p[1]); math.Abs(v-100) > 1e-9 {
+			t.Fatalf("expected 100 next to nodata at %v, got %v", p, v)
+		}
+	}
+	if v := NewTerrainRaster(src, TERRAIN_ASPECT, TerrainOptions{}).Elevation(0, 0); math.Abs(v-180) > 1e-9 {
+		t.Fatalf("expected south facing aspect, got %v", v)
+	}
+}
+
+// 测试地理坐标下按纬度换算像元大小
+func TestTerrainRasterGeographic(t *testing.T) {
+	gt := [6]float64{10, 0.001, 0, 60.002, 0, -0.001}
+	src := newFuncRaster(4, 4, gt, func(x, y float64) float64 { return (x - 10) * 1000 })
+	src.srs = srs4326
+	r := NewTerrainRaster(src, TERRAIN_SLOPE_PERCENT, TerrainOptions{})
+	lat := gt[3] + gt[5]*1.5
+	want := 100 * 1000 / (metersPerDegree * math.Cos(lat*math.Pi/180))
+	if v := r.Elevation(1, 1); math.Abs(v-want)/want > 1e-9 {
+		t.Fatalf("expected %v, got %v", want, v)
+	}
+}
+
+// 测试碗状和穹顶曲面的剖面与平面曲率符号, 并按坡度分级生成等值线
+func TestTerrainRasterCurvature(t *testing.T) {
+	src := newFuncRaster(9, 9, [6]float64{-4.5, 1, 0, 4.5, 0, -1}, func(x, y float64) float64 { return x*x + y*y })
+	profile := NewTerrainRaster(src, TERRAIN_PROFILE_CURVATURE, TerrainOptions{})
+	plan := NewTerrainRaster(src, TERRAIN_PLAN_CURVATURE, TerrainOptions{})
+	if v := profile.Elevation(6, 4); math.Abs(v+2) > 1e-9 {
+		t.Fatalf("expected profile curvature -2, got %v", v)
+	}
+	if v := plan.Elevation(4, 2); math.Abs(v-2) > 1e-9 {
+		t.Fatalf("expected plan curvature 2, got %v", v)
+	}
+	// 穹顶沿坡向上凸, 剖面曲率为正, 平面曲率为负
+	dome := newFuncRaster(9, 9, [6]float64{-4.5, 1, 0, 4.5, 0, -1}, func(x, y float64) float64 { return -x*x - y*y })
+	if v := NewTerrainRaster(dome, TERRAIN_PROFILE_CURVATURE, TerrainOptions{}).Elevation(6, 4); math.Abs(v-2) > 1e-9 {
+		t.Fatalf("expected dome profile curvature 2, got %v", v)
+	}
+	if v := NewTerrainRaster(dome, TERRAIN_PLAN_CURVATURE, TerrainOptions{}).Elevation(4, 2); math.Abs(v+2) > 1e-9 {
+		t.Fatalf("expected dome plan curvature -2, got %v", v)
+	}
+
+	slope := NewTerrainRaster(src, TERRAIN_SLOPE_DEGREES, TerrainOptions{})
+	if rng := slope.Range(); rng[0] < 0 || rng[1] > 90 {
+		t.Fatalf("unexpected slope range %v", rng)
+	}
+	writer := NewMockGeometryWriter()
+	if err := ContourGenerate(slope, writer, ContourGenerateOptions{FixedLevels: []float64{45, 75}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.writtenGeom) == 0 {
+		t.Fatal("expected slope class lines")
+	}
+}
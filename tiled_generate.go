@@ -1,16 +1,28 @@
 package contour
 
+import "io"
+
+// TiledContourGenerate contours each raster of the provider in turn, the
+// rasters are closed once their tile is written.
 func TiledContourGenerate(pr RasterProvider, wf GeometryWriter, options ContourGenerateOptions) error {
+	// a tile only needs its range while it is contoured
+	if options.Statistics == nil {
+		options.Statistics = NewStatisticsCache(1)
+	}
 	if options.Polygonize {
 		writer := newTilePolygonMergerWriter(wf)
+		writer.stats = options.Statistics
 		for pr.HasNext() {
 			r := pr.Next()
+			if r == nil {
+				continue
+			}
 			nodata := r.NoData()
 			w, h := r.Size()
 			suppressWarnings := true
 			appender := writer.StartOfTile(r)
 			if len(options.FixedLevels) > 0 {
-				levels := newFixedLevelRangeIterator(options.FixedLevels, r.Range()[1])
+				levels := newFixedLevelRangeIterator(options.FixedLevels, rasterRange(r, options.Statistics)[1])
 				swriter := NewSegmentMerger(true, appender, levels)
 				cg := newContourGenerator(w, h, nodata, swriter, levels, true)
 				cg.Process(r)
@@ -32,12 +44,21 @@ func TiledContourGenerate(pr RasterProvider, wf GeometryWriter, options ContourG
 				swriter.SetSuppressUnclosedWarnings(suppressWarnings)
 			}
 			writer.EndOfTile(r, appender)
+			if c, ok := r.(io.Closer); ok {
+				c.Close()
+			}
 		}
 		writer.Close()
 	} else {
 		for pr.HasNext() {
 			r := pr.Next()
+			if r == nil {
+				continue
+			}
 			ContourGenerate(r, wf, options)
+			if c, ok := r.(io.Closer); ok {
+				c.Close()
+			}
 		}
 	}
 	return nil
@@ -124,3 +124,50 @@ func TestTiledContourGenerate(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+type closingRaster struct {
+	*MemoryRaster
+	closed *int
+}
+
+func (r *closingRaster) Close() error {
+	*r.closed++
+	return nil
+}
+
+type sliceRasterProvider struct {
+	rasters []Raster
+	i       int
+}
+
+func (p *sliceRasterProvider) Next() Raster {
+	r := p.rasters[p.i]
+	p.i++
+	return r
+}
+
+func (p *sliceRasterProvider) HasNext() bool { return p.i < len(p.rasters) }
+
+func (p *sliceRasterProvider) Reset() { p.i = 0 }
+
+// 测试逐瓦片生成后关闭每个瓦片的栅格
+func TestTiledContourGenerateClosesRasters(t *testing.T) {
+	closed := 0
+	pr := &sliceRasterProvider{}
+	for i := 0; i < 3; i++ {
+		data := []float64{0, 10, 20, 10, 30, 10, 20, 10, 0}
+		gt := [6]float64{float64(i) * 3, 1, 0, 3, 0, -1}
+		pr.rasters = append(pr.rasters, &closingRaster{NewMemoryRaster(data, 3, 3, gt, geo.NewProj(4326), nil), &closed})
+	}
+	for _, polygonize := range []bool{false, true} {
+		closed = 0
+		pr.Reset()
+		options := ContourGenerateOptions{Polygonize: polygonize, Base: 0, Interval: 10}
+		if err := TiledContourGenerate(pr, NewMockGeometryWriter(), options); err != nil {
+			t.Fatal(err)
+		}
+		if closed != 3 {
+			t.Fatalf("polygonize %v: expected 3 closed rasters, got %d", polygonize, closed)
+		}
+	}
+}
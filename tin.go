@@ -0,0 +1,694 @@
+package contour
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/flywave/go-geo"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+// tinTriangle stores its vertices counter clockwise, n[i] is the neighbour
+// across the edge v[i]-v[i+1] or -1 on the hull.
+type tinTriangle struct {
+	v           [3]int
+	n           [3]int
+	constrained [3]bool
+}
+
+// TIN is a Delaunay triangulation of scattered points. Breaklines are kept as
+// triangle edges, so the surface and its contours follow them.
+type TIN struct {
+	points    []GridPoint
+	triangles []tinTriangle
+	vertexTri []int
+	last      int
+	srs       geo.Proj
+	rng       [2]float64
+	bbox      vec2d.Rect
+}
+
+// NewTIN triangulates the points and the vertices of the breaklines, points
+// with the same x and y are only used once.
+func NewTIN(points []GridPoint, breaklines [][]GridPoint, srs geo.Proj) *TIN {
+	t := &TIN{srs: srs, rng: [2]float64{math.MaxFloat64, -math.MaxFloat64}, bbox: vec2d.Rect{Min: vec2d.MaxVal, Max: vec2d.MinVal}}
+	index := make(map[[2]float64]int)
+	add := func(p GridPoint) int {
+		key := [2]float64{p.X, p.Y}
+		if i, ok := index[key]; ok {
+			return i
+		}
+		index[key] = len(t.points)
+		t.points = append(t.points, p)
+		t.rng[0], t.rng[1] = math.Min(t.rng[0], p.Z), math.Max(t.rng[1], p.Z)
+		t.bbox.Extend(&vec2d.T{p.X, p.Y})
+		return len(t.points) - 1
+	}
+	for _, p := range points {
+		add(p)
+	}
+	lines := make([][]int, len(breaklines))
+	for i, line := range breaklines {
+		for _, p := range line {
+			lines[i] = append(lines[i], add(p))
+		}
+	}
+	n := len(t.points)
+	size := math.Max(t.bbox.Max[0]-t.bbox.Min[0], t.bbox.Max[1]-t.bbox.Min[1])
+	if n < 3 || size == 0 {
+		return nil
+	}
+
+	// a super triangle encloses every point while they are inserted
+	cx, cy := (t.bbox.Min[0]+t.bbox.Max[0])/2, (t.bbox.Min[1]+t.bbox.Max[1])/2
+	t.points = append(t.points, GridPoint{X: cx - 20*size, Y: cy - size}, GridPoint{X: cx + 20*size, Y: cy - size}, GridPoint{X: cx, Y: cy + 20*size})
+	t.vertexTri = make([]int, n+3)
+	t.triangles = []tinTriangle{{}}
+	t.setTriangle(0, tinTriangle{v: [3]int{n, n + 1, n + 2}, n: [3]int{-1, -1, -1}})
+
+	for _, i := range t.insertionOrder(n) {
+		t.insert(i)
+	}
+	for _, line := range lines {
+		for i := 0; i+1 < len(line); i++ {
+			t.constrain(line[i], line[i+1])
+		}
+	}
+	if !t.removeSuperTriangle(n) {
+		return nil
+	}
+	t.fillHull()
+
+	stack := [][2]int{}
+	for ti, tri := range t.triangles {
+		for k := 0; k < 3; k++ {
+			if tri.n[k] > ti {
+				stack = append(stack, [2]int{ti, k})
+			}
+		}
+	}
+	t.legalize(stack)
+	return t
+}
+
+// NewTINFromTriangles keeps the triangles of an existing mesh as they are,
+// only degenerate triangles are dropped and the others turned counter clockwise.
+func NewTINFromTriangles(points []GridPoint, triangles [][3]int, srs geo.Proj) *TIN {
+	if len(points) < 3 {
+		return nil
+	}
+	t := &TIN{points: points, srs: srs, rng: [2]float64{math.MaxFloat64, -math.MaxFloat64}, bbox: vec2d.Rect{Min: vec2d.MaxVal, Max: vec2d.MinVal}}
+	for _, p := range points {
+		t.rng[0], t.rng[1] = math.Min(t.rng[0], p.Z), math.Max(t.rng[1], p.Z)
+		t.bbox.Extend(&vec2d.T{p.X, p.Y})
+	}
+	edges := make(map[[2]int][2]int)
+	for _, v := range triangles {
+		if v[0] < 0 || v[1] < 0 || v[2] < 0 || v[0] >= len(points) || v[1] >= len(points) || v[2] >= len(points) {
+			continue
+		}
+		o := t.orient(v[0], v[1], v[2])
+		if o == 0 {
+			continue
+		}
+		if o < 0 {
+			v[1], v[2] = v[2], v[1]
+		}
+		ti := len(t.triangles)
+		tri := tinTriangle{v: v, n: [3]int{-1, -1, -1}}
+		for k := 0; k < 3; k++ {
+			a, b := v[k], v[(k+1)%3]
+			if e, ok := edges[[2]int{b, a}]; ok && t.triangles[e[0]].n[e[1]] < 0 {
+				tri.n[k] = e[0]
+				t.triangles[e[0]].n[e[1]] = ti
+			}
+			edges[[2]int{a, b}] = [2]int{ti, k}
+		}
+		t.triangles = append(t.triangles, tri)
+	}
+	if len(t.triangles) == 0 {
+		return nil
+	}
+	t.vertexTri = make([]int, len(points))
+	for i := range t.vertexTri {
+		t.vertexTri[i] = -1
+	}
+	for ti, tri := range t.triangles {
+		t.setTriangle(ti, tri)
+	}
+	return t
+}
+
+// insertionOrder sorts the points along a snake through columns of cells, so
+// the walk from the previous triangle to the next point stays short.
+func (t *TIN) insertionOrder(n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	cols := math.Max(1, math.Ceil(math.Sqrt(float64(n))/2))
+	width := (t.bbox.Max[0] - t.bbox.Min[0]) / cols
+	column := func(i int) int {
+		if width == 0 {
+			return 0
+		}
+		return int((t.points[i].X - t.bbox.Min[0]) / width)
+	}
+	sort.Slice(order, func(a, b int) bool {
+		ca, cb := column(order[a]), column(order[b])
+		if ca != cb {
+			return ca < cb
+		}
+		if ca%2 == 1 {
+			return t.points[order[a]].Y > t.points[order[b]].Y
+		}
+		return t.points[order[a]].Y < t.points[order[b]].Y
+	})
+	return order
+}
+
+func (t *TIN) xy(i int) vec2d.T {
+	return vec2d.T{t.points[i].X, t.points[i].Y}
+}
+
+func orient2d(a, b, c vec2d.T) float64 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
+
+func (t *TIN) orient(a, b, c int) float64 {
+	return orient2d(t.xy(a), t.xy(b), t.xy(c))
+}
+
+// inCircle is true when d lies clearly inside the circumcircle of the counter
+// clockwise triangle abc, cocircular points are left alone.
+func (t *TIN) inCircle(a, b, c, d int) bool {
+	pd := t.xy(d)
+	adx, ady := t.points[a].X-pd[0], t.points[a].Y-pd[1]
+	bdx, bdy := t.points[b].X-pd[0], t.points[b].Y-pd[1]
+	cdx, cdy := t.points[c].X-pd[0], t.points[c].Y-pd[1]
+	alift, blift, clift := adx*adx+ady*ady, bdx*bdx+bdy*bdy, cdx*cdx+cdy*cdy
+	bc, ca, ab := bdx*cdy-bdy*cdx, cdx*ady-cdy*adx, adx*bdy-ady*bdx
+	det := alift*bc + blift*ca + clift*ab
+	return det > 1e-10*(math.Abs(alift*bc)+math.Abs(blift*ca)+math.Abs(clift*ab))
+}
+
+func (t *TIN) setTriangle(ti int, tri tinTriangle) {
+	t.triangles[ti] = tri
+	for _, v := range tri.v {
+		t.vertexTri[v] = ti
+	}
+}
+
+func (t *TIN) replaceNeighbour(ti, old, new int) {
+	if ti < 0 {
+		return
+	}
+	for k := 0; k < 3; k++ {
+		if t.triangles[ti].n[k] == old {
+			t.triangles[ti].n[k] = new
+			return
+		}
+	}
+}
+
+func (t *TIN) neighbourIndex(ti, of int) int {
+	for k := 0; k < 3; k++ {
+		if t.triangles[ti].n[k] == of {
+			return k
+		}
+	}
+	return -1
+}
+
+// locate returns the triangle containing p and the edge p lies on, or -1.
+func (t *TIN) locate(p vec2d.T) (int, int) {
+	ti := t.last
+next:
+	for steps := 0; steps <= len(t.triangles); steps++ {
+		tri := &t.triangles[ti]
+		edge := -1
+		for k := 0; k < 3; k++ {
+			o := orient2d(t.xy(tri.v[k]), t.xy(tri.v[(k+1)%3]), p)
+			if o < 0 && tri.n[k] >= 0 {
+				ti = tri.n[k]
+				continue next
+			}
+			if o == 0 {
+				edge = k
+			}
+		}
+		return ti, edge
+	}
+
+	for ti, tri := range t.triangles {
+		edge := -1
+		inside := true
+		for k := 0; k < 3 && inside; k++ {
+			o := orient2d(t.xy(tri.v[k]), t.xy(tri.v[(k+1)%3]), p)
+			inside = o >= 0
+			if o == 0 {
+				edge = k
+			}
+		}
+		if inside {
+			return ti, edge
+		}
+	}
+	return -1, -1
+}
+
+func (t *TIN) insert(p int) {
+	ti, edge := t.locate(t.xy(p))
+	if ti < 0 {
+		return
+	}
+	if edge >= 0 {
+		t.splitEdge(ti, edge, p)
+	} else {
+		t.splitTriangle(ti, p)
+	}
+	t.last = t.vertexTri[p]
+}
+
+func (t *TIN) splitTriangle(ti, p int) {
+	tri := t.triangles[ti]
+	a, b, c := tri.v[0], tri.v[1], tri.v[2]
+	t1, t2 := len(t.triangles), len(t.triangles)+1
+	t.triangles = append(t.triangles, tinTriangle{}, tinTriangle{})
+	t.setTriangle(ti, tinTriangle{v: [3]int{a, b, p}, n: [3]int{tri.n[0], t1, t2}, constrained: [3]bool{tri.constrained[0], false, false}})
+	t.setTriangle(t1, tinTriangle{v: [3]int{b, c, p}, n: [3]int{tri.n[1], t2, ti}, constrained: [3]bool{tri.constrained[1], false, false}})
+	t.setTriangle(t2, tinTriangle{v: [3]int{c, a, p}, n: [3]int{tri.n[2], ti, t1}, constrained: [3]bool{tri.constrained[2], false, false}})
+	t.replaceNeighbour(tri.n[1], ti, t1)
+	t.replaceNeighbour(tri.n[2], ti, t2)
+	t.legalize([][2]int{{ti, 0}, {t1, 0}, {t2, 0}})
+}
+
+// splitEdge inserts p on the edge i of triangle ti and on the neighbour
+// sharing it.
+func (t *TIN) splitEdge(ti, i, p int) {
+	tri := t.triangles[ti]
+	a, b, c := tri.v[i], tri.v[(i+1)%3], tri.v[(i+2)%3]
+	ce := tri.constrained[i]
+	ui := tri.n[i]
+	t2 := len(t.triangles)
+	t.triangles = append(t.triangles, tinTriangle{})
+	u1, u2 := -1, -1
+	if ui >= 0 {
+		u1, u2 = ui, len(t.triangles)
+		t.triangles = append(t.triangles, tinTriangle{})
+	}
+
+	t.setTriangle(ti, tinTriangle{v: [3]int{a, p, c}, n: [3]int{u2, t2, tri.n[(i+2)%3]}, constrained: [3]bool{ce, false, tri.constrained[(i+2)%3]}})
+	t.setTriangle(t2, tinTriangle{v: [3]int{p, b, c}, n: [3]int{u1, tri.n[(i+1)%3], ti}, constrained: [3]bool{ce, tri.constrained[(i+1)%3], false}})
+	t.replaceNeighbour(tri.n[(i+1)%3], ti, t2)
+	stack := [][2]int{{ti, 2}, {t2, 1}}
+
+	if ui >= 0 {
+		u := t.triangles[ui]
+		j := t.neighbourIndex(ui, ti)
+		d := u.v[(j+2)%3]
+		t.setTriangle(u1, tinTriangle{v: [3]int{b, p, d}, n: [3]int{t2, u2, u.n[(j+2)%3]}, constrained: [3]bool{ce, false, u.constrained[(j+2)%3]}})
+		t.setTriangle(u2, tinTriangle{v: [3]int{p, a, d}, n: [3]int{ti, u.n[(j+1)%3], u1}, constrained: [3]bool{ce, u.constrained[(j+1)%3], false}})
+		t.replaceNeighbour(u.n[(j+1)%3], ui, u2)
+		stack = append(stack, [2]int{u1, 2}, [2]int{u2, 1})
+	}
+	t.legalize(stack)
+}
+
+// flip replaces the edge i of triangle ti by the other diagonal of the
+// quadrilateral it forms with its neighbour.
+func (t *TIN) flip(ti, i int) (int, int) {
+	tri := t.triangles[ti]
+	ui := tri.n[i]
+	u := t.triangles[ui]
+	j := t.neighbourIndex(ui, ti)
+	a, b, c := tri.v[i], tri.v[(i+1)%3], tri.v[(i+2)%3]
+	d := u.v[(j+2)%3]
+	tb, ta := tri.n[(i+1)%3], tri.n[(i+2)%3]
+	ua, ub := u.n[(j+1)%3], u.n[(j+2)%3]
+	t.setTriangle(ti, tinTriangle{v: [3]int{c, a, d}, n: [3]int{ta, ua, ui}, constrained: [3]bool{tri.constrained[(i+2)%3], u.constrained[(j+1)%3], false}})
+	t.setTriangle(ui, tinTriangle{v: [3]int{d, b, c}, n: [3]int{ub, tb, ti}, constrained: [3]bool{u.constrained[(j+2)%3], tri.constrained[(i+1)%3], false}})
+	t.replaceNeighbour(ua, ui, ti)
+	t.replaceNeighbour(tb, ti, ui)
+	return ti, ui
+}
+
+// convexQuad tells whether the edge i of triangle ti can be flipped.
+func (t *TIN) convexQuad(ti, i int) bool {
+	tri := t.triangles[ti]
+	ui := tri.n[i]
+	if ui < 0 {
+		return false
+	}
+	a, b, c := tri.v[i], tri.v[(i+1)%3], tri.v[(i+2)%3]
+	d := t.triangles[ui].v[(t.neighbourIndex(ui, ti)+2)%3]
+	return t.orient(c, d, a)*t.orient(c, d, b) < 0
+}
+
+// legalize flips the edges on the stack, and the edges around every flip,
+// until they all satisfy the empty circumcircle rule.
+func (t *TIN) legalize(stack [][2]int) {
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		ti, i := e[0], e[1]
+		tri := t.triangles[ti]
+		ui := tri.n[i]
+		if ui < 0 || tri.constrained[i] {
+			continue
+		}
+		d := t.triangles[ui].v[(t.neighbourIndex(ui, ti)+2)%3]
+		if !t.inCircle(tri.v[0], tri.v[1], tri.v[2], d) || !t.convexQuad(ti, i) {
+			continue
+		}
+		t.flip(ti, i)
+		stack = append(stack, [2]int{ti, 0}, [2]int{ti, 1}, [2]int{ui, 0}, [2]int{ui, 1})
+	}
+}
+
+// edgeOf finds a triangle having the edge a-b in either direction.
+func (t *TIN) edgeOf(a, b int) (int, int, bool) {
+	start := t.vertexTri[a]
+	if start < 0 {
+		return -1, -1, false
+	}
+	visited := map[int]bool{start: true}
+	queue := []int{start}
+	for len(queue) > 0 {
+		ti := queue[0]
+		queue = queue[1:]
+		tri := &t.triangles[ti]
+		for k := 0; k < 3; k++ {
+			if tri.v[k] != a {
+				continue
+			}
+			if tri.v[(k+1)%3] == b {
+				return ti, k, true
+			}
+			if tri.v[(k+2)%3] == b {
+				return ti, (k + 2) % 3, true
+			}
+			for _, n := range []int{tri.n[k], tri.n[(k+2)%3]} {
+				if n >= 0 && !visited[n] {
+					visited[n] = true
+					queue = append(queue, n)
+				}
+			}
+		}
+	}
+	return -1, -1, false
+}
+
+func (t *TIN) crosses(a, b, p, q int) bool {
+	return t.orient(p, q, a)*t.orient(p, q, b) < 0 && t.orient(a, b, p)*t.orient(a, b, q) < 0
+}
+
+// constrain makes p-q an edge by flipping the edges crossing it, a vertex
+// lying on the segment splits it in two.
+func (t *TIN) constrain(p, q int) {
+	if p == q {
+		return
+	}
+	dx, dy := t.points[q].X-t.points[p].X, t.points[q].Y-t.points[p].Y
+	length := dx*dx + dy*dy
+	on, onDist := -1, math.MaxFloat64
+	for r := 0; r < len(t.vertexTri)-3; r++ {
+		if r == p || r == q || math.Abs(t.orient(p, q, r)) > 1e-9*length {
+			continue
+		}
+		s := ((t.points[r].X-t.points[p].X)*dx + (t.points[r].Y-t.points[p].Y)*dy) / length
+		if s > 0 && s < 1 && s < onDist {
+			on, onDist = r, s
+		}
+	}
+	if on >= 0 {
+		t.constrain(p, on)
+		t.constrain(on, q)
+		return
+	}
+
+	crossing := [][2]int{}
+	for ti, tri := range t.triangles {
+		for k := 0; k < 3; k++ {
+			a, b := tri.v[k], tri.v[(k+1)%3]
+			if tri.n[k] > ti && t.crosses(a, b, p, q) {
+				crossing = append(crossing, [2]int{a, b})
+			}
+		}
+	}
+	for iter := 0; len(crossing) > 0 && iter < 4*len(t.triangles); iter++ {
+		e := crossing[0]
+		crossing = crossing[1:]
+		ti, i, ok := t.edgeOf(e[0], e[1])
+		if !ok {
+			continue
+		}
+		if !t.convexQuad(ti, i) {
+			crossing = append(crossing, e)
+			continue
+		}
+		t.flip(ti, i)
+		c, d := t.triangles[ti].v[0], t.triangles[ti].v[2]
+		if t.crosses(c, d, p, q) {
+			crossing = append(crossing, [2]int{c, d})
+		}
+	}
+
+	if ti, i, ok := t.edgeOf(p, q); ok {
+		t.triangles[ti].constrained[i] = true
+		if ui := t.triangles[ti].n[i]; ui >= 0 {
+			t.triangles[ui].constrained[t.neighbourIndex(ui, ti)] = true
+		}
+	}
+}
+
+// removeSuperTriangle drops the triangles using a vertex of the super
+// triangle, n is the number of real points.
+func (t *TIN) removeSuperTriangle(n int) bool {
+	remap := make([]int, len(t.triangles))
+	kept := 0
+	for ti, tri := range t.triangles {
+		remap[ti] = -1
+		if tri.v[0] < n && tri.v[1] < n && tri.v[2] < n {
+			remap[ti] = kept
+			kept++
+		}
+	}
+	if kept == 0 {
+		return false
+	}
+	triangles := make([]tinTriangle, 0, kept)
+	for ti, tri := range t.triangles {
+		if remap[ti] < 0 {
+			continue
+		}
+		for k := 0; k < 3; k++ {
+			if tri.n[k] >= 0 {
+				tri.n[k] = remap[tri.n[k]]
+			}
+		}
+		triangles = append(triangles, tri)
+	}
+	t.points = t.points[:n]
+	t.triangles = triangles
+	t.vertexTri = make([]int, n)
+	for i := range t.vertexTri {
+		t.vertexTri[i] = -1
+	}
+	for ti, tri := range t.triangles {
+		t.setTriangle(ti, tri)
+	}
+	t.last = 0
+	return true
+}
+
+// fillHull closes the concave pockets the super triangle can leave along the
+// hull, so the triangulation covers the convex hull of the points.
+func (t *TIN) fillHull() {
+	type hullEdge struct {
+		to, tri, edge int
+	}
+	next := make(map[int]hullEdge)
+	for ti, tri := range t.triangles {
+		for k := 0; k < 3; k++ {
+			if tri.n[k] < 0 {
+				next[tri.v[k]] = hullEdge{tri.v[(k+1)%3], ti, k}
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		keys := make([]int, 0, len(next))
+		for k := range next {
+			keys = append(keys, k)
+		}
+		sort.Ints(keys)
+		for _, a := range keys {
+			e1, ok := next[a]
+			if !ok {
+				continue
+			}
+			b := e1.to
+			e2, ok := next[b]
+			if !ok {
+				continue
+			}
+			c := e2.to
+			if c == a || t.orient(a, b, c) >= 0 {
+				continue
+			}
+			blocked := false
+			for r := range next {
+				if r != a && r != b && r != c && t.orient(a, c, r) >= 0 && t.orient(c, b, r) >= 0 && t.orient(b, a, r) >= 0 {
+					blocked = true
+					break
+				}
+			}
+			if blocked {
+				continue
+			}
+			ni := len(t.triangles)
+			t.triangles = append(t.triangles, tinTriangle{})
+			t.setTriangle(ni, tinTriangle{v: [3]int{a, c, b}, n: [3]int{-1, e2.tri, e1.tri}})
+			t.triangles[e2.tri].n[e2.edge] = ni
+			t.triangles[e1.tri].n[e1.edge] = ni
+			next[a] = hullEdge{c, ni, 0}
+			delete(next, b)
+			changed = true
+		}
+	}
+}
+
+func (t *TIN) Points() []GridPoint {
+	return t.points
+}
+
+// Triangles returns the point indices of every triangle, counter clockwise.
+func (t *TIN) Triangles() [][3]int {
+	ret := make([][3]int, len(t.triangles))
+	for i := range t.triangles {
+		ret[i] = t.triangles[i].v
+	}
+	return ret
+}
+
+func (t *TIN) Srs() geo.Proj {
+	return t.srs
+}
+
+func (t *TIN) Bounds() vec2d.Rect {
+	return t.bbox
+}
+
+func (t *TIN) Range() [2]float64 {
+	return t.rng
+}
+
+func (t *TIN) interpolate(a, b int, level float64) Point {
+	pa, pb := &t.points[a], &t.points[b]
+	return Point{interpolate_(level, pa.X, pb.X, pa.Z, pb.Z, true), interpolate_(level, pa.Y, pb.Y, pa.Z, pb.Z, true)}
+}
+
+// segment traces the level through a triangle with the higher side on the left.
+func (t *TIN) segment(tri *tinTriangle, level float64) (Point, Point, bool) {
+	var high [3]bool
+	count := 0
+	for k, v := range tri.v {
+		high[k] = level < fudge(level, t.points[v].Z)
+		if high[k] {
+			count++
+		}
+	}
+	if count == 0 || count == 3 {
+		return Point{}, Point{}, false
+	}
+	o := 0
+	for k := 0; k < 3; k++ {
+		if high[k] != high[(k+1)%3] && high[k] != high[(k+2)%3] {
+			o = k
+		}
+	}
+	v, v1, v2 := tri.v[o], tri.v[(o+1)%3], tri.v[(o+2)%3]
+	p1, p2 := t.interpolate(v, v1, level), t.interpolate(v, v2, level)
+	if high[o] {
+		return p1, p2, true
+	}
+	return p2, p1, true
+}
+
+// borderSegments splits a hull edge into the pieces of every band it crosses,
+// the band below level i is stored with index i.
+func (t *TIN) borderSegments(a, b int, levels LevelGenerator, writer ContourWriter) {
+	if t.points[a].Z > t.points[b].Z {
+		a, b = b, a
+	}
+	r := levels.Range(t.points[a].Z, t.points[b].Z)
+	last := Point(t.xy(a))
+	it, end := r.Begin(), r.End()
+	for ; it.neq(end); it.inc() {
+		idx, level := it.value()
+		p := t.interpolate(a, b, level)
+		writer.AddBorderSegment(idx, last, p)
+		last = p
+	}
+	idx, _ := end.value()
+	writer.AddBorderSegment(idx, last, Point(t.xy(b)))
+}
+
+// process runs marching triangles over the network, polygonized output gets
+// each segment in the bands on both of its sides.
+func (t *TIN) process(levels LevelGenerator, writer ContourWriter) {
+	for ti := range t.triangles {
+		tri := &t.triangles[ti]
+		min, max := math.MaxFloat64, -math.MaxFloat64
+		for k := 0; k < 3; k++ {
+			z := t.points[tri.v[k]].Z
+			min, max = math.Min(min, z), math.Max(max, z)
+			if writer.Polygonize() && tri.n[k] < 0 {
+				t.borderSegments(tri.v[k], tri.v[(k+1)%3], levels, writer)
+			}
+		}
+		r := levels.Range(min, max)
+		it, end := r.Begin(), r.End()
+		for ; it.neq(end); it.inc() {
+			idx, level := it.value()
+			p1, p2, ok := t.segment(tri, level)
+			if !ok {
+				continue
+			}
+			writer.AddSegment(idx, p1, p2)
+			if writer.Polygonize() {
+				writer.AddSegment(idx+1, p1, p2)
+			}
+		}
+	}
+}
+
+// TINContourGenerate traces the contours of a TIN, the output vertices are in
+// the coordinates of the points.
+func TINContourGenerate(t *TIN, wf GeometryWriter, options ContourGenerateOptions) error {
+	if t == nil {
+		return errors.New("tin is nil")
+	}
+	if len(options.FixedLevels) == 0 && options.ExpBase <= 0 && options.Interval <= 0 {
+		return errors.New("no contour levels")
+	}
+	identity := [6]float64{0, 1, 0, 0, 0, 1}
+	levels := contourLevelGenerator(options, t.rng[1])
+	if options.Polygonize {
+		wr := &GeomPolygonContourWriter{polyWriter: wf, geoTransform: identity, srs: t.srs, previousLevel: t.rng[0]}
+		appender := newPolygonRingWriter(wr)
+		writer := NewSegmentMerger(true, appender, levels)
+		t.process(levels, writer)
+		writer.Close()
+		appender.Flush()
+	} else {
+		appender := &GeomLineStringContourWriter{lsWriter: wf, geoTransform: identity, srs: t.srs}
+		writer := NewSegmentMerger(false, appender, levels)
+		t.process(levels, writer)
+		writer.Close()
+	}
+	return nil
+}
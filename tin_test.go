@@ -0,0 +1,181 @@
+package contour
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/flywave/go-geom"
+)
+
+func checkDelaunay(t *testing.T, tin *TIN) {
+	for ti, tri := range tin.triangles {
+		if tin.orient(tri.v[0], tri.v[1], tri.v[2]) <= 0 {
+			t.Fatalf("triangle %d is not counter clockwise", ti)
+		}
+		for k := 0; k < 3; k++ {
+			n := tri.n[k]
+			if n < 0 {
+				// 凸包边: 所有点都在左侧
+				for p := range tin.points {
+					if tin.orient(tri.v[k], tri.v[(k+1)%3], p) < -1e-9 {
+						t.Fatalf("hull edge of triangle %d is not convex", ti)
+					}
+				}
+				continue
+			}
+			if tin.neighbourIndex(n, ti) < 0 {
+				t.Fatalf("triangle %d and %d are not linked both ways", ti, n)
+			}
+			if tri.constrained[k] {
+				continue
+			}
+			d := tin.triangles[n].v[(tin.neighbourIndex(n, ti)+2)%3]
+			if tin.inCircle(tri.v[0], tri.v[1], tri.v[2], d) {
+				t.Fatalf("edge %d of triangle %d is not delaunay", k, ti)
+			}
+		}
+	}
+}
+
+// 测试规则网格点的三角剖分
+func TestTINGrid(t *testing.T) {
+	points := []GridPoint{}
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 5; x++ {
+			points = append(points, GridPoint{X: float64(x), Y: float64(y), Z: float64(x + y)})
+		}
+	}
+	tin := NewTIN(points, nil, srs4326)
+	if tin == nil {
+		t.Fatal("expected tin")
+	}
+	if len(tin.Triangles()) != 32 {
+		t.Fatalf("expected 32 triangles, got %d", len(tin.Triangles()))
+	}
+	checkDelaunay(t, tin)
+	if rng := tin.Range(); rng[0] != 0 || rng[1] != 8 {
+		t.Fatalf("unexpected range %v", rng)
+	}
+}
+
+// 测试随机点的 Delaunay 性质
+func TestTINRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	points := make([]GridPoint, 500)
+	for i := range points {
+		points[i] = GridPoint{X: rnd.Float64() * 100, Y: rnd.Float64() * 50, Z: rnd.Float64()}
+	}
+	tin := NewTIN(points, nil, nil)
+	if tin == nil {
+		t.Fatal("expected tin")
+	}
+	checkDelaunay(t, tin)
+
+	if NewTIN([]GridPoint{{X: 0, Y: 0}, {X: 1, Y: 1}}, nil, nil) != nil {
+		t.Fatal("expected nil for two points")
+	}
+}
+
+// 测试约束断线
+func TestTINBreakline(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	points := make([]GridPoint, 300)
+	for i := range points {
+		points[i] = GridPoint{X: rnd.Float64() * 100, Y: rnd.Float64() * 100}
+	}
+	breakline := []GridPoint{{X: 5, Y: 5, Z: 1}, {X: 95, Y: 90, Z: 2}, {X: 20, Y: 80, Z: 3}}
+	tin := NewTIN(points, [][]GridPoint{breakline}, nil)
+	if tin == nil {
+		t.Fatal("expected tin")
+	}
+	checkDelaunay(t, tin)
+
+	n := len(points)
+	for i := 0; i+1 < len(breakline); i++ {
+		p, q := n+i, n+i+1
+		for ti, tri := range tin.triangles {
+			for k := 0; k < 3; k++ {
+				if tin.crosses(tri.v[k], tri.v[(k+1)%3], p, q) {
+					t.Fatalf("edge %d of triangle %d crosses the breakline", k, ti)
+				}
+			}
+		}
+	}
+}
+
+// 测试 TIN 等值线生成
+func TestTINContourGenerateLines(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	points := []GridPoint{}
+	for i := 0; i < 400; i++ {
+		x, y := rnd.Float64()*10, rnd.Float64()*10
+		points = append(points, GridPoint{X: x, Y: y, Z: x})
+	}
+	tin := NewTIN(points, nil, srs4326)
+	writer := NewMockGeometryWriter()
+	if err := TINContourGenerate(tin, writer, ContourGenerateOptions{Interval: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.writtenGeom) == 0 {
+		t.Fatal("expected contour lines")
+	}
+	for i, g := range writer.writtenGeom {
+		ls, ok := g.(geom.LineString)
+		if !ok {
+			t.Fatalf("expected line string, got %T", g)
+		}
+		level := writer.writtenMinLevel[i]
+		for _, p := range ls.Data() {
+			if math.Abs(p[0]-level) > 1e-9 {
+				t.Fatalf("vertex %v is not on level %v", p, level)
+			}
+		}
+	}
+	if err := TINContourGenerate(tin, writer, ContourGenerateOptions{}); err == nil {
+		t.Fatal("expected error without levels")
+	}
+}
+
+func ringArea(ring [][]float64) float64 {
+	area := 0.0
+	for i := 0; i+1 < len(ring); i++ {
+		area += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	return math.Abs(area) / 2
+}
+
+// 测试 TIN 多边形化: 各等值带面积之和等于覆盖范围
+func TestTINContourGeneratePolygons(t *testing.T) {
+	points := []GridPoint{}
+	for y := 0; y <= 10; y++ {
+		for x := 0; x <= 10; x++ {
+			points = append(points, GridPoint{X: float64(x), Y: float64(y), Z: float64(x+y) + 0.3*math.Sin(float64(x*y))})
+		}
+	}
+	tin := NewTIN(points, nil, srs4326)
+	writer := NewMockGeometryWriter()
+	if err := TINContourGenerate(tin, writer, ContourGenerateOptions{Interval: 2.5, Polygonize: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.writtenGeom) == 0 {
+		t.Fatal("expected polygons")
+	}
+	total := 0.0
+	for _, g := range writer.writtenGeom {
+		poly, ok := g.(geom.Polygon)
+		if !ok {
+			t.Fatalf("expected polygon, got %T", g)
+		}
+		for i, ring := range poly.Data() {
+			a := ringArea(ring)
+			if i > 0 {
+				a = -a
+			}
+			total += a
+		}
+	}
+	if math.Abs(total-100) > 1e-6 {
+		t.Fatalf("expected bands to cover 100, got %v", total)
+	}
+}
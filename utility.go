@@ -1,6 +1,9 @@
 package contour
 
-import "math"
+import (
+	"container/list"
+	"math"
+)
 
 func fudge(level, value float64) float64 {
 	if math.IsNaN(value) {
@@ -11,3 +14,98 @@ func fudge(level, value float64) float64 {
 	}
 	return value
 }
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// lruCache keeps up to capacity values, dropping the least recently used one
+// first. onEvict, when set, sees every value that is dropped or removed.
+type lruCache[K comparable, V any] struct {
+	capacity int
+	items    map[K]*list.Element
+	lru      *list.List
+	onEvict  func(K, V)
+}
+
+func newLRUCache[K comparable, V any](capacity int) *lruCache[K, V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &lruCache[K, V]{capacity: capacity, items: make(map[K]*list.Element), lru: list.New()}
+}
+
+func (c *lruCache[K, V]) get(key K) (V, bool) {
+	if elem, ok := c.items[key]; ok {
+		c.lru.MoveToFront(elem)
+		return elem.Value.(*lruEntry[K, V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+func (c *lruCache[K, V]) put(key K, value V) {
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*lruEntry[K, V]).value = value
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.lru.PushFront(&lruEntry[K, V]{key: key, value: value})
+	for c.lru.Len() > c.capacity {
+		c.removeOldest()
+	}
+}
+
+func (c *lruCache[K, V]) remove(key K) {
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// removeOldest drops the least recently used value and returns it.
+func (c *lruCache[K, V]) removeOldest() (K, V, bool) {
+	elem := c.lru.Back()
+	if elem == nil {
+		var key K
+		var value V
+		return key, value, false
+	}
+	e := c.removeElement(elem)
+	return e.key, e.value, true
+}
+
+func (c *lruCache[K, V]) removeElement(elem *list.Element) *lruEntry[K, V] {
+	e := elem.Value.(*lruEntry[K, V])
+	delete(c.items, e.key)
+	c.lru.Remove(elem)
+	if c.onEvict != nil {
+		c.onEvict(e.key, e.value)
+	}
+	return e
+}
+
+func (c *lruCache[K, V]) len() int {
+	return c.lru.Len()
+}
+
+// clear removes all values, calling onEvict for each.
+func (c *lruCache[K, V]) clear() {
+	for c.lru.Len() > 0 {
+		c.removeOldest()
+	}
+}
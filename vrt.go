@@ -0,0 +1,455 @@
+package contour
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/flywave/go-geo"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+const defaultVrtOpenSources = 16
+
+var (
+	epsgCodePattern      = regexp.MustCompile(`(?i)^\s*EPSG:(\d+)\s*$`)
+	epsgAuthorityPattern = regexp.MustCompile(`AUTHORITY\[\s*"EPSG"\s*,\s*"?(\d+)"?\s*\]`)
+	epsgIdPattern        = regexp.MustCompile(`ID\[\s*"EPSG"\s*,\s*(\d+)\s*\]`)
+)
+
+type vrtRect struct {
+	XOff  float64 `xml:"xOff,attr"`
+	YOff  float64 `xml:"yOff,attr"`
+	XSize float64 `xml:"xSize,attr"`
+	YSize float64 `xml:"ySize,attr"`
+}
+
+type vrtSourceFilename struct {
+	RelativeToVRT int    `xml:"relativeToVRT,attr"`
+	Name          string `xml:",chardata"`
+}
+
+type vrtSourceXML struct {
+	XMLName        xml.Name
+	SourceFilename vrtSourceFilename `xml:"SourceFilename"`
+	SourceBand     int               `xml:"SourceBand"`
+	SrcRect        *vrtRect          `xml:"SrcRect"`
+	DstRect        *vrtRect          `xml:"DstRect"`
+	NoData         *string           `xml:"NODATA"`
+	ScaleOffset    *float64          `xml:"ScaleOffset"`
+	ScaleRatio     *float64          `xml:"ScaleRatio"`
+}
+
+type vrtBandXML struct {
+	Band        int            `xml:"band,attr"`
+	NoDataValue *string        `xml:"NoDataValue"`
+	Offset      *float64       `xml:"Offset"`
+	Scale       *float64       `xml:"Scale"`
+	Sources     []vrtSourceXML `xml:",any"`
+}
+
+type vrtDatasetXML struct {
+	XMLName      xml.Name     `xml:"VRTDataset"`
+	RasterXSize  int          `xml:"rasterXSize,attr"`
+	RasterYSize  int          `xml:"rasterYSize,attr"`
+	SRS          string       `xml:"SRS"`
+	GeoTransform string       `xml:"GeoTransform"`
+	Bands        []vrtBandXML `xml:"VRTRasterBand"`
+}
+
+type vrtSource struct {
+	fileName string
+	band     int
+	src      vrtRect
+	dst      vrtRect
+	nodata   *float64
+	scale    float64
+	offset   float64
+	raster   Raster
+	failed   bool
+	line     []float64
+}
+
+// window returns the destination columns and rows covered by the source.
+func (s *vrtSource) window() (x0, y0, x1, y1 int) {
+	return int(math.Round(s.dst.XOff)), int(math.Round(s.dst.YOff)), int(math.Round(s.dst.XOff + s.dst.XSize)), int(math.Round(s.dst.YOff + s.dst.YSize))
+}
+
+// outside reports whether x, y lies outside a known destination window, a
+// negative x checks the row only. Sources without a DstRect are only known
+// once opened.
+func (s *vrtSource) outside(x, y int) bool {
+	if s.dst.XSize <= 0 || s.dst.YSize <= 0 {
+		return false
+	}
+	x0, y0, x1, y1 := s.window()
+	return y < y0 || y >= y1 || (x >= 0 && (x < x0 || x >= x1))
+}
+
+func (s *vrtSource) srcX(x int) int {
+	return int(math.Floor(s.src.XOff + (float64(x)+0.5-s.dst.XOff)*s.src.XSize/s.dst.XSize))
+}
+
+func (s *vrtSource) srcY(y int) int {
+	return int(math.Floor(s.src.YOff + (float64(y)+0.5-s.dst.YOff)*s.src.YSize/s.dst.YSize))
+}
+
+func (s *vrtSource) open(srs geo.Proj) Raster {
+	if s.raster != nil || s.failed {
+		return s.raster
+	}
+	s.raster = openRasterFile(s.fileName, s.band, srs)
+	if s.raster == nil {
+		s.failed = true
+		return nil
+	}
+	w, h := s.raster.Size()
+	if s.src.XSize <= 0 || s.src.YSize <= 0 {
+		s.src = vrtRect{XSize: float64(w), YSize: float64(h)}
+	}
+	if s.dst.XSize <= 0 || s.dst.YSize <= 0 {
+		s.dst = s.src
+	}
+	s.line = make([]float64, w)
+	if s.nodata == nil {
+		s.nodata = s.raster.NoData()
+	}
+	return s.raster
+}
+
+func (s *vrtSource) close() {
+	if c, ok := s.raster.(io.Closer); ok {
+		c.Close()
+	}
+	s.raster = nil
+}
+
+// openRasterFile picks a reader from the file extension, band is zero based.
+func openRasterFile(fileName string, band int, srs geo.Proj) Raster {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".asc":
+		if r := NewAsciiGridRaster(fileName, srs); r != nil {
+			return r
+		}
+	case ".hgt":
+		if r := NewHgtRaster(fileName); r != nil {
+			return r
+		}
+	case ".bil", ".bip", ".bsq", ".flt", ".img":
+		if r := NewBilRaster(fileName, band, srs); r != nil {
+			return r
+		}
+	case ".vrt":
+		if r := NewVrtRasterBand(fileName, band); r != nil {
+			return r
+		}
+	default:
+		if r := NewGeoTiffRasterBand(fileName, band); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// parseSrs understands EPSG codes, WKT with an EPSG authority and proj4 strings.
+func parseSrs(def string) geo.Proj {
+	def = strings.TrimSpace(def)
+	if def == "" {
+		return nil
+	}
+	code := 0
+	if m := epsgCodePattern.FindStringSubmatch(def); m != nil {
+		code, _ = strconv.Atoi(m[1])
+	} else if m := epsgAuthorityPattern.FindAllStringSubmatch(def, -1); m != nil {
+		code, _ = strconv.Atoi(m[len(m)-1][1])
+	} else if m := epsgIdPattern.FindAllStringSubmatch(def, -1); m != nil {
+		code, _ = strconv.Atoi(m[len(m)-1][1])
+	} else if strings.HasPrefix(def, "+") {
+		return geo.NewProj(def)
+	}
+	if code == 0 {
+		return nil
+	}
+	return geo.NewProj(code)
+}
+
+func parseVrtNoData(s *string) *float64 {
+	if s == nil {
+		return nil
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(*s), 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// VrtRaster draws the sources of one band in order. At most a bounded number
+// of sources stay open, the least recently used one is closed first. The band
+// Scale and Offset are metadata like in GDAL, only the ScaleRatio and
+// ScaleOffset of complex sources change the pixel values.
+type VrtRaster struct {
+	fileName     string
+	width        int
+	height       int
+	geoTransform [6]float64
+	srs          geo.Proj
+	band         int
+	nodata       *float64
+	scale        float64
+	offset       float64
+	sources      []*vrtSource
+	opened       *lruCache[*vrtSource, Raster]
+	rng          *[2]float64
+	lock         sync.Mutex
+}
+
+func NewVrtRaster(fileName string) *VrtRaster {
+	return NewVrtRasterBand(fileName, 0)
+}
+
+// band is zero based, the band attribute of VRTRasterBand is one based.
+func NewVrtRasterBand(fileName string, band int) *VrtRaster {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var ds vrtDatasetXML
+	if err := xml.NewDecoder(f).Decode(&ds); err != nil {
+		return nil
+	}
+	if ds.RasterXSize <= 0 || ds.RasterYSize <= 0 || band < 0 || band >= len(ds.Bands) {
+		return nil
+	}
+
+	r := &VrtRaster{fileName: fileName, width: ds.RasterXSize, height: ds.RasterYSize, band: band, scale: 1, geoTransform: [6]float64{0, 1, 0, 0, 0, 1}}
+	r.SetMaxOpenSources(defaultVrtOpenSources)
+	if ds.GeoTransform != "" {
+		parts := strings.Split(ds.GeoTransform, ",")
+		if len(parts) != 6 {
+			return nil
+		}
+		for i := range parts {
+			if r.geoTransform[i], err = strconv.ParseFloat(strings.TrimSpace(parts[i]), 64); err != nil {
+				return nil
+			}
+		}
+	}
+	r.srs = parseSrs(ds.SRS)
+
+	b := ds.Bands[band]
+	for i := range ds.Bands {
+		if ds.Bands[i].Band == band+1 {
+			b = ds.Bands[i]
+			break
+		}
+	}
+	r.nodata = parseVrtNoData(b.NoDataValue)
+	if b.Scale != nil {
+		r.scale = *b.Scale
+	}
+	if b.Offset != nil {
+		r.offset = *b.Offset
+	}
+
+	dir := filepath.Dir(fileName)
+	add := func(sx vrtSourceXML) {
+		name := strings.TrimSpace(sx.SourceFilename.Name)
+		if sx.SourceFilename.RelativeToVRT != 0 && !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		s := &vrtSource{fileName: name, band: sx.SourceBand - 1, nodata: parseVrtNoData(sx.NoData), scale: 1}
+		if sx.SourceBand <= 0 {
+			s.band = 0
+		}
+		if sx.SrcRect != nil {
+			s.src = *sx.SrcRect
+		}
+		if sx.DstRect != nil {
+			s.dst = *sx.DstRect
+		}
+		if sx.ScaleRatio != nil {
+			s.scale = *sx.ScaleRatio
+		}
+		if sx.ScaleOffset != nil {
+			s.offset = *sx.ScaleOffset
+		}
+		r.sources = append(r.sources, s)
+	}
+	for _, sx := range b.Sources {
+		switch sx.XMLName.Local {
+		case "SimpleSource", "ComplexSource", "AveragedSource":
+			add(sx)
+		}
+	}
+	return r
+}
+
+func (r *VrtRaster) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.opened.clear()
+	for _, s := range r.sources {
+		s.failed = false
+	}
+	return nil
+}
+
+// SetMaxOpenSources bounds how many source files are kept open.
+func (r *VrtRaster) SetMaxOpenSources(n int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.opened != nil {
+		r.opened.clear()
+	}
+	r.opened = newLRUCache[*vrtSource, Raster](n)
+	r.opened.onEvict = func(s *vrtSource, _ Raster) {
+		s.close()
+	}
+}
+
+// ScaleOffset returns the band Scale and Offset metadata, pixel values are
+// not changed by them.
+func (r *VrtRaster) ScaleOffset() (float64, float64) {
+	return r.scale, r.offset
+}
+
+// source opens s, closing the least recently used source when too many are
+// open.
+func (r *VrtRaster) source(s *vrtSource) Raster {
+	if src, ok := r.opened.get(s); ok {
+		return src
+	}
+	src := s.open(r.srs)
+	if src != nil {
+		r.opened.put(s, src)
+	}
+	return src
+}
+
+func (r *VrtRaster) fill() float64 {
+	if r.nodata != nil {
+		return *r.nodata
+	}
+	return 0
+}
+
+func (r *VrtRaster) Size() (w, h int) {
+	return r.width, r.height
+}
+
+func (r *VrtRaster) Elevation(x, y int) float64 {
+	if x < 0 || y < 0 || x >= r.width || y >= r.height {
+		return math.NaN()
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// later sources are drawn over earlier ones
+	for i := len(r.sources) - 1; i >= 0; i-- {
+		s := r.sources[i]
+		if s.outside(x, y) {
+			continue
+		}
+		src := r.source(s)
+		if src == nil || s.outside(x, y) {
+			continue
+		}
+		v := src.Elevation(s.srcX(x), s.srcY(y))
+		if math.IsNaN(v) || isNoData(v, s.nodata) {
+			continue
+		}
+		return v*s.scale + s.offset
+	}
+	return r.fill()
+}
+
+func (r *VrtRaster) FetchLine(y int, line []float64) error {
+	if y < 0 || y >= r.height {
+		return errors.New("line out of range")
+	}
+	fill := r.fill()
+	for i := range line {
+		line[i] = fill
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, s := range r.sources {
+		if s.outside(-1, y) {
+			continue
+		}
+		src := r.source(s)
+		if src == nil || s.outside(-1, y) {
+			continue
+		}
+		x0, _, x1, _ := s.window()
+		sy := s.srcY(y)
+		w, h := src.Size()
+		if sy < 0 || sy >= h {
+			continue
+		}
+		if err := src.FetchLine(sy, s.line); err != nil {
+			return err
+		}
+		for x := maxInt(x0, 0); x < x1 && x < len(line); x++ {
+			sx := s.srcX(x)
+			if sx < 0 || sx >= w {
+				continue
+			}
+			v := s.line[sx]
+			if isNoData(v, s.nodata) {
+				continue
+			}
+			line[x] = v*s.scale + s.offset
+		}
+	}
+	return nil
+}
+
+func (r *VrtRaster) Srs() geo.Proj {
+	return r.srs
+}
+
+func (r *VrtRaster) Bounds() vec2d.Rect {
+	return geoTransformBounds(r.geoTransform, r.width, r.height)
+}
+
+func (r *VrtRaster) NoData() *float64 {
+	return r.nodata
+}
+
+func (r *VrtRaster) GeoTransform() [6]float64 {
+	return r.geoTransform
+}
+
+func (r *VrtRaster) Range() [2]float64 {
+	if r.rng != nil {
+		return *r.rng
+	}
+	min, max := math.MaxFloat64, -math.MaxFloat64
+	line := make([]float64, r.width)
+	for y := 0; y < r.height; y++ {
+		if err := r.FetchLine(y, line); err != nil {
+			return [2]float64{}
+		}
+		for _, d := range line {
+			if isNoData(d, r.nodata) {
+				continue
+			}
+			min, max = math.Min(min, d), math.Max(max, d)
+		}
+	}
+	r.rng = &[2]float64{min, max}
+	return *r.rng
+}
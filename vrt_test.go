@@ -0,0 +1,145 @@
+package contour
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 测试 VRT 的源窗口、无效值、源缩放以及作为元数据的波段缩放/偏移
+func TestVrtRaster(t *testing.T) {
+	left := writeTestTiff(t, 3, 2, 32, tiffSampleFormatFloat, [][]float64{{1, 2, 3, 4, 5, 6}}, "", "")
+	right := writeTestTiff(t, 2, 2, 16, tiffSampleFormatInt, [][]float64{{5, -32768, 7, 8}}, "", "-32768")
+
+	vrt := fmt.Sprintf(`<VRTDataset rasterXSize="5" rasterYSize="3">
+  <SRS>PROJCS["WGS 84 / UTM zone 50N",GEOGCS["WGS 84",AUTHORITY["EPSG","4326"]],AUTHORITY["EPSG","32650"]]</SRS>
+  <GeoTransform> 5.0e+05, 10, 0, 4.0e+06, 0, -10</GeoTransform>
+  <VRTRasterBand dataType="Float32" band="1">
+    <NoDataValue>-9999</NoDataValue>
+    <Offset>1</Offset>
+    <Scale>2</Scale>
+    <SimpleSource>
+      <SourceFilename relativeToVRT="1">%s</SourceFilename>
+      <SourceBand>1</SourceBand>
+      <SrcRect xOff="0" yOff="0" xSize="3" ySize="2"/>
+      <DstRect xOff="0" yOff="0" xSize="3" ySize="2"/>
+    </SimpleSource>
+    <ComplexSource>
+      <SourceFilename relativeToVRT="0">%s</SourceFilename>
+      <SourceBand>1</SourceBand>
+      <ScaleRatio>10</ScaleRatio>
+      <SrcRect xOff="0" yOff="0" xSize="2" ySize="2"/>
+      <DstRect xOff="3" yOff="1" xSize="2" ySize="2"/>
+    </ComplexSource>
+    <SimpleSource>
+      <SourceFilename relativeToVRT="1">%s</SourceFilename>
+      <SrcRect xOff="0" yOff="0" xSize="1" ySize="1"/>
+      <DstRect xOff="0" yOff="2" xSize="2" ySize="1"/>
+    </SimpleSource>
+  </VRTRasterBand>
+</VRTDataset>`, filepath.Base(left), right, filepath.Base(left))
+
+	file := filepath.Join(filepath.Dir(left), "test.vrt")
+	if err := os.WriteFile(file, []byte(vrt), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewVrtRaster(file)
+	if r == nil {
+		t.Fatal("failed to open vrt")
+	}
+	defer r.Close()
+
+	if w, h := r.Size(); w != 5 || h != 3 {
+		t.Fatalf("unexpected size %dx%d", w, h)
+	}
+	if r.GeoTransform() != [6]float64{500000, 10, 0, 4000000, 0, -10} {
+		t.Errorf("unexpected geotransform %v", r.GeoTransform())
+	}
+	if r.Srs() == nil {
+		t.Error("expected srs from wkt authority")
+	}
+
+	expected := [][]float64{
+		{1, 2, 3, -9999, -9999},
+		{4, 5, 6, 50, -9999},
+		{1, 1, -9999, 70, 80},
+	}
+	line := make([]float64, 5)
+	for y := range expected {
+		if err := r.FetchLine(y, line); err != nil {
+			t.Fatal(err)
+		}
+		for x := range expected[y] {
+			if line[x] != expected[y][x] {
+				t.Errorf("line %d: expected %v, got %v", y, expected[y], line)
+				break
+			}
+			if v := r.Elevation(x, y); v != expected[y][x] {
+				t.Errorf("pixel %d,%d: expected %f, got %f", x, y, expected[y][x], v)
+			}
+		}
+	}
+	if rng := r.Range(); rng[0] != 1 || rng[1] != 80 {
+		t.Errorf("unexpected range %v", rng)
+	}
+	if scale, offset := r.ScaleOffset(); scale != 2 || offset != 1 {
+		t.Errorf("unexpected scale/offset %f %f", scale, offset)
+	}
+	if NewVrtRasterBand(file, 1) != nil {
+		t.Error("expected nil raster for missing band")
+	}
+}
+
+// 测试 VRT 同时打开的源文件数量有上限
+func TestVrtRasterOpenSources(t *testing.T) {
+	var sources string
+	for i := 0; i < 4; i++ {
+		file := writeTestTiff(t, 1, 1, 32, tiffSampleFormatFloat, [][]float64{{float64(i + 1)}}, "", "")
+		sources += fmt.Sprintf(`
+    <SimpleSource>
+      <SourceFilename relativeToVRT="0">%s</SourceFilename>
+      <DstRect xOff="%d" yOff="0" xSize="1" ySize="1"/>
+    </SimpleSource>`, file, i)
+	}
+	vrt := `<VRTDataset rasterXSize="4" rasterYSize="1">
+  <VRTRasterBand dataType="Float32" band="1">` + sources + `
+  </VRTRasterBand>
+</VRTDataset>`
+	file := filepath.Join(t.TempDir(), "sources.vrt")
+	if err := os.WriteFile(file, []byte(vrt), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewVrtRaster(file)
+	if r == nil {
+		t.Fatal("failed to open vrt")
+	}
+	defer r.Close()
+	r.SetMaxOpenSources(2)
+
+	line := make([]float64, 4)
+	for i := 0; i < 2; i++ {
+		if err := r.FetchLine(0, line); err != nil {
+			t.Fatal(err)
+		}
+		for x, v := range line {
+			if v != float64(x+1) {
+				t.Fatalf("expected %d at %d, got %v", x+1, x, line)
+			}
+		}
+	}
+	open := 0
+	for _, s := range r.sources {
+		if s.raster != nil {
+			open++
+		}
+	}
+	if open != 2 || r.opened.len() != 2 {
+		t.Errorf("expected 2 open sources, got %d", open)
+	}
+	if v := r.Elevation(0, 0); v != 1 {
+		t.Errorf("expected reopened source value 1, got %f", v)
+	}
+}
@@ -0,0 +1,459 @@
+package contour
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/flywave/go-geo"
+
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+type ResampleMethod uint8
+
+const (
+	RESAMPLE_NEAREST ResampleMethod = iota
+	RESAMPLE_BILINEAR
+	RESAMPLE_CUBIC
+	RESAMPLE_AVERAGE
+	RESAMPLE_MIN
+	RESAMPLE_MAX
+)
+
+const defaultWarpCacheLines = 64
+
+// rasterSampler reads a raster at fractional pixel positions, px and py are
+// measured from the upper left corner of the first pixel.
+type rasterSampler struct {
+	cache  *lineCache
+	width  int
+	height int
+	nodata *float64
+}
+
+func newRasterSampler(r Raster, cacheLines int) *rasterSampler {
+	w, h := r.Size()
+	return &rasterSampler{cache: newLineCache(r, cacheLines), width: w, height: h, nodata: r.NoData()}
+}
+
+func (s *rasterSampler) value(i, j int) (float64, bool) {
+	i = maxInt(0, minInt(i, s.width-1))
+	j = maxInt(0, minInt(j, s.height-1))
+	line, err := s.cache.line(j)
+	if err != nil {
+		return 0, false
+	}
+	v := line[i]
+	if isNoData(v, s.nodata) {
+		return 0, false
+	}
+	return v, true
+}
+
+func (s *rasterSampler) inside(px, py float64) bool {
+	return px >= 0 && py >= 0 && px < float64(s.width) && py < float64(s.height)
+}
+
+// sample interpolates at a point. Average, min and max are computed over a
+// footprint by aggregate instead, here they fall back to nearest.
+func (s *rasterSampler) sample(px, py float64, method ResampleMethod) (float64, bool) {
+	if !s.inside(px, py) {
+		return 0, false
+	}
+	switch method {
+	case RESAMPLE_BILINEAR:
+		return s.bilinear(px, py)
+	case RESAMPLE_CUBIC:
+		return s.cubic(px, py)
+	default:
+		return s.value(int(px), int(py))
+	}
+}
+
+// footprintAccumulator collects the valid pixels of one footprint for
+// average, min and max.
+type footprintAccumulator struct {
+	sum   float64
+	count int
+	min   float64
+	max   float64
+}
+
+func (a *footprintAccumulator) reset() {
+	*a = footprintAccumulator{min: math.MaxFloat64, max: -math.MaxFloat64}
+}
+
+func (a *footprintAccumulator) add(v float64) {
+	a.sum += v
+	a.count++
+	a.min, a.max = math.Min(a.min, v), math.Max(a.max, v)
+}
+
+func (a *footprintAccumulator) result(method ResampleMethod) (float64, bool) {
+	if a.count == 0 {
+		return 0, false
+	}
+	switch method {
+	case RESAMPLE_MIN:
+		return a.min, true
+	case RESAMPLE_MAX:
+		return a.max, true
+	}
+	return a.sum / float64(a.count), true
+}
+
+// aggregate returns the average, min or max of the valid pixels in
+// [x0, x1) x [y0, y1), reading one row at a time.
+func (s *rasterSampler) aggregate(x0, y0, x1, y1 int, method ResampleMethod) (float64, bool) {
+	var acc footprintAccumulator
+	acc.reset()
+	for j := y0; j < y1; j++ {
+		line, err := s.cache.line(j)
+		if err != nil {
+			return 0, false
+		}
+		for i := x0; i < x1; i++ {
+			if v := line[i]; !isNoData(v, s.nodata) {
+				acc.add(v)
+			}
+		}
+	}
+	return acc.result(method)
+}
+
+// bilinear skips nodata neighbours and renormalizes the remaining weights,
+// but a pixel whose own value is nodata stays nodata.
+func (s *rasterSampler) bilinear(px, py float64) (float64, bool) {
+	if _, ok := s.value(int(px), int(py)); !ok {
+		return 0, false
+	}
+	u, v := px-0.5, py-0.5
+	i0, j0 := int(math.Floor(u)), int(math.Floor(v))
+	fx, fy := u-float64(i0), v-float64(j0)
+
+	sum, wsum := 0.0, 0.0
+	for dj := 0; dj < 2; dj++ {
+		wy := 1 - fy
+		if dj == 1 {
+			wy = fy
+		}
+		for di := 0; di < 2; di++ {
+			wx := 1 - fx
+			if di == 1 {
+				wx = fx
+			}
+			w := wx * wy
+			if w == 0 {
+				continue
+			}
+			if d, ok := s.value(i0+di, j0+dj); ok {
+				sum += d * w
+				wsum += w
+			}
+		}
+	}
+	if wsum == 0 {
+		return 0, false
+	}
+	return sum / wsum, true
+}
+
+func cubicWeight(t float64) float64 {
+	t = math.Abs(t)
+	switch {
+	case t <= 1:
+		return 1.5*t*t*t - 2.5*t*t + 1
+	case t < 2:
+		return -0.5*t*t*t + 2.5*t*t - 4*t + 2
+	}
+	return 0
+}
+
+// cubic uses Catmull-Rom weights and falls back to bilinear when the 4x4
+// neighbourhood holds nodata.
+func (s *rasterSampler) cubic(px, py float64) (float64, bool) {
+	u, v := px-0.5, py-0.5
+	i0, j0 := int(math.Floor(u)), int(math.Floor(v))
+	fx, fy := u-float64(i0), v-float64(j0)
+
+	sum := 0.0
+	for dj := -1; dj <= 2; dj++ {
+		wy := cubicWeight(float64(dj) - fy)
+		for di := -1; di <= 2; di++ {
+			d, ok := s.value(i0+di, j0+dj)
+			if !ok {
+				return s.bilinear(px, py)
+			}
+			sum += d * wy * cubicWeight(float64(di)-fx)
+		}
+	}
+	return sum, true
+}
+
+// WarpedRaster resamples a raster onto a grid in another srs. Average, min and
+// max aggregate the source pixels within the bounding box of the transformed
+// corners of each target pixel, the other methods interpolate at its center.
+// Pixels without data take the source nodata, or NaN when it has none.
+type WarpedRaster struct {
+	src          Raster
+	srs          geo.Proj
+	width        int
+	height       int
+	geoTransform [6]float64
+	method       ResampleMethod
+	nodata       *float64
+	srcInverse   [6]float64
+	sampler      *rasterSampler
+	points       []vec2d.T
+	corners      []vec2d.T
+	boxes        [][4]int
+	accs         []footprintAccumulator
+	rng          *[2]float64
+	lock         sync.Mutex
+}
+
+// NewWarpedRaster covers the whole source extent with square pixels of res in
+// srs. Curvilinear sources are not supported, their GeoTransform only
+// approximates the grid.
+func NewWarpedRaster(src Raster, srs geo.Proj, res float64, method ResampleMethod) *WarpedRaster {
+	if src == nil || src.Srs() == nil || srs == nil || res <= 0 {
+		return nil
+	}
+	bbox := src.Bounds()
+	if !src.Srs().Eq(srs) {
+		bbox = src.Srs().TransformRectTo(srs, bbox, 16)
+	}
+	width := int(math.Ceil((bbox.Max[0] - bbox.Min[0]) / res))
+	height := int(math.Ceil((bbox.Max[1] - bbox.Min[1]) / res))
+	return NewWarpedRasterWithGrid(src, srs, [6]float64{bbox.Min[0], res, 0, bbox.Max[1], 0, -res}, width, height, method)
+}
+
+func NewWarpedRasterWithGrid(src Raster, srs geo.Proj, geoTransform [6]float64, width, height int, method ResampleMethod) *WarpedRaster {
+	if src == nil || src.Srs() == nil || srs == nil || width <= 0 || height <= 0 || rasterNodeCoordinates(src) != nil {
+		return nil
+	}
+	inv, ok := invertGeoTransform(src.GeoTransform())
+	if !ok {
+		return nil
+	}
+	r := &WarpedRaster{src: src, srs: srs, width: width, height: height, geoTransform: geoTransform, method: method, srcInverse: inv}
+	if nodata := src.NoData(); nodata != nil {
+		v := *nodata
+		r.nodata = &v
+	}
+	r.sampler = newRasterSampler(src, defaultWarpCacheLines)
+	return r
+}
+
+func (r *WarpedRaster) Source() Raster {
+	return r.src
+}
+
+func (r *WarpedRaster) Method() ResampleMethod {
+	return r.method
+}
+
+// sourcePixels maps the centers of the given pixels to source pixel positions.
+func (r *WarpedRaster) sourcePixels(points []vec2d.T) []vec2d.T {
+	gt := r.geoTransform
+	for i := range points {
+		x, y := points[i][0], points[i][1]
+		points[i] = vec2d.T{gt[0] + gt[1]*x + gt[2]*y, gt[3] + gt[4]*x + gt[5]*y}
+	}
+	if !r.srs.Eq(r.src.Srs()) {
+		points = r.srs.TransformTo(r.src.Srs(), points)
+	}
+	inv := r.srcInverse
+	for i := range points {
+		x, y := points[i][0], points[i][1]
+		points[i] = vec2d.T{inv[0] + inv[1]*x + inv[2]*y, inv[3] + inv[4]*x + inv[5]*y}
+	}
+	return points
+}
+
+func (r *WarpedRaster) aggregating() bool {
+	return r.method == RESAMPLE_AVERAGE || r.method == RESAMPLE_MIN || r.method == RESAMPLE_MAX
+}
+
+// footprintBox returns the source pixels [x0, x1) x [y0, y1) within the
+// bounding box of the source positions of a target pixel's corners.
+func (r *WarpedRaster) footprintBox(corners ...vec2d.T) ([4]int, bool) {
+	minX, minY := math.MaxFloat64, math.MaxFloat64
+	maxX, maxY := -math.MaxFloat64, -math.MaxFloat64
+	for _, p := range corners {
+		if math.IsNaN(p[0]) || math.IsNaN(p[1]) || math.IsInf(p[0], 0) || math.IsInf(p[1], 0) {
+			return [4]int{}, false
+		}
+		minX, maxX = math.Min(minX, p[0]), math.Max(maxX, p[0])
+		minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+	}
+	x0, y0 := int(math.Floor(minX+1e-9)), int(math.Floor(minY+1e-9))
+	x1 := maxInt(x0+1, int(math.Ceil(maxX-1e-9)))
+	y1 := maxInt(y0+1, int(math.Ceil(maxY-1e-9)))
+	x0, y0 = maxInt(x0, 0), maxInt(y0, 0)
+	x1, y1 = minInt(x1, r.sampler.width), minInt(y1, r.sampler.height)
+	return [4]int{x0, y0, x1, y1}, x0 < x1 && y0 < y1
+}
+
+// footprint aggregates the source pixels under a target pixel.
+func (r *WarpedRaster) footprint(corners ...vec2d.T) float64 {
+	box, ok := r.footprintBox(corners...)
+	if !ok {
+		return noDataValue(r.nodata)
+	}
+	if v, ok := r.sampler.aggregate(box[0], box[1], box[2], box[3], r.method); ok {
+		return v
+	}
+	return noDataValue(r.nodata)
+}
+
+// aggregateLine aggregates the footprints of a target line whose corners run
+// along its top and bottom edge. Every source row under the line is read once
+// and added to the footprints covering it, however tall they are.
+func (r *WarpedRaster) aggregateLine(corners []vec2d.T, line []float64) error {
+	n := r.width + 1
+	if len(r.boxes) != r.width {
+		r.boxes = make([][4]int, r.width)
+		r.accs = make([]footprintAccumulator, r.width)
+	}
+	y0, y1 := r.sampler.height, 0
+	for x := range r.boxes {
+		box, ok := r.footprintBox(corners[x], corners[x+1], corners[n+x], corners[n+x+1])
+		if !ok {
+			box = [4]int{}
+		}
+		r.boxes[x] = box
+		r.accs[x].reset()
+		if ok {
+			y0, y1 = minInt(y0, box[1]), maxInt(y1, box[3])
+		}
+	}
+	for j := y0; j < y1; j++ {
+		src, err := r.sampler.cache.line(j)
+		if err != nil {
+			return err
+		}
+		for x, box := range r.boxes {
+			if j < box[1] || j >= box[3] {
+				continue
+			}
+			for i := box[0]; i < box[2]; i++ {
+				if v := src[i]; !isNoData(v, r.sampler.nodata) {
+					r.accs[x].add(v)
+				}
+			}
+		}
+	}
+	for x := range line {
+		if x >= r.width {
+			break
+		}
+		line[x] = noDataValue(r.nodata)
+		if v, ok := r.accs[x].result(r.method); ok {
+			line[x] = v
+		}
+	}
+	return nil
+}
+
+func (r *WarpedRaster) sample(p vec2d.T) float64 {
+	if math.IsNaN(p[0]) || math.IsNaN(p[1]) || math.IsInf(p[0], 0) || math.IsInf(p[1], 0) {
+		return noDataValue(r.nodata)
+	}
+	if v, ok := r.sampler.sample(p[0], p[1], r.method); ok {
+		return v
+	}
+	return noDataValue(r.nodata)
+}
+
+func (r *WarpedRaster) Size() (w, h int) {
+	return r.width, r.height
+}
+
+func (r *WarpedRaster) Elevation(x, y int) float64 {
+	if x < 0 || y < 0 || x >= r.width || y >= r.height {
+		return math.NaN()
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.aggregating() {
+		fx, fy := float64(x), float64(y)
+		return r.footprint(r.sourcePixels([]vec2d.T{{fx, fy}, {fx + 1, fy}, {fx, fy + 1}, {fx + 1, fy + 1}})...)
+	}
+	p := r.sourcePixels([]vec2d.T{{float64(x) + 0.5, float64(y) + 0.5}})
+	return r.sample(p[0])
+}
+
+func (r *WarpedRaster) FetchLine(y int, line []float64) error {
+	if y < 0 || y >= r.height {
+		return errors.New("line out of range")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.aggregating() {
+		// the corners along the top and the bottom edge of the line
+		n := r.width + 1
+		if len(r.corners) != 2*n {
+			r.corners = make([]vec2d.T, 2*n)
+		}
+		for x := 0; x < n; x++ {
+			r.corners[x] = vec2d.T{float64(x), float64(y)}
+			r.corners[n+x] = vec2d.T{float64(x), float64(y + 1)}
+		}
+		return r.aggregateLine(r.sourcePixels(r.corners), line)
+	}
+
+	if len(r.points) != r.width {
+		r.points = make([]vec2d.T, r.width)
+	}
+	for x := range r.points {
+		r.points[x] = vec2d.T{float64(x) + 0.5, float64(y) + 0.5}
+	}
+	points := r.sourcePixels(r.points)
+	for x := range line {
+		if x >= len(points) {
+			break
+		}
+		line[x] = r.sample(points[x])
+	}
+	return nil
+}
+
+func (r *WarpedRaster) Srs() geo.Proj {
+	return r.srs
+}
+
+func (r *WarpedRaster) Bounds() vec2d.Rect {
+	return geoTransformBounds(r.geoTransform, r.width, r.height)
+}
+
+func (r *WarpedRaster) NoData() *float64 {
+	return r.nodata
+}
+
+func (r *WarpedRaster) GeoTransform() [6]float64 {
+	return r.geoTransform
+}
+
+func (r *WarpedRaster) Range() [2]float64 {
+	if r.rng != nil {
+		return *r.rng
+	}
+	min, max := math.MaxFloat64, -math.MaxFloat64
+	line := make([]float64, r.width)
+	for y := 0; y < r.height; y++ {
+		if err := r.FetchLine(y, line); err != nil {
+			return [2]float64{}
+		}
+		for _, d := range line {
+			if isNoData(d, r.nodata) {
+				continue
+			}
+			min, max = math.Min(min, d), math.Max(max, d)
+		}
+	}
+	r.rng = &[2]float64{min, max}
+	return *r.rng
+}
@@ -0,0 +1,253 @@
+package contour
+
+import (
+	"math"
+	"testing"
+
+	"github.com/flywave/go-geo"
+	vec2d "github.com/flywave/go3d/float64/vec2"
+)
+
+func newPlaneRaster(size int, gt [6]float64, srs geo.Proj, nodata *float64) *MemoryRaster {
+	data := make([]float64, size*size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			wx := gt[0] + gt[1]*(float64(x)+0.5)
+			wy := gt[3] + gt[5]*(float64(y)+0.5)
+			data[y*size+x] = 0.001*(wx-gt[0]) + 0.002*(wy-gt[3])
+		}
+	}
+	return NewMemoryRaster(data, size, size, gt, srs, nodata)
+}
+
+// 测试相同坐标系和网格下的重采样保持原值
+func TestWarpedRasterIdentity(t *testing.T) {
+	srs := geo.NewProj(3857)
+	src := newPlaneRaster(16, [6]float64{1000, 10, 0, 2000, 0, -10}, srs, nil)
+	for _, method := range []ResampleMethod{RESAMPLE_NEAREST, RESAMPLE_BILINEAR, RESAMPLE_CUBIC} {
+		r := NewWarpedRaster(src, srs, 10, method)
+		if r == nil {
+			t.Fatal("failed to warp")
+		}
+		if w, h := r.Size(); w != 16 || h != 16 {
+			t.Fatalf("unexpected size %dx%d", w, h)
+		}
+		line, expected := make([]float64, 16), make([]float64, 16)
+		for y := 0; y < 16; y++ {
+			r.FetchLine(y, line)
+			src.FetchLine(y, expected)
+			for x := range line {
+				if math.Abs(line[x]-expected[x]) > 1e-9 {
+					t.Fatalf("method %d pixel %d,%d: expected %f, got %f", method, x, y, expected[x], line[x])
+				}
+			}
+		}
+	}
+}
+
+// 测试投影变换后线性面的插值结果
+func TestWarpedRasterReproject(t *testing.T) {
+	src := newPlaneRaster(64, [6]float64{12000000, 100, 0, 4000000, 0, -100}, geo.NewProj(3857), nil)
+	target := geo.NewProj(4326)
+	for _, c := range []struct {
+		method ResampleMethod
+		tol    float64
+	}{
+		{RESAMPLE_NEAREST, 0.15 + 1e-9},
+		{RESAMPLE_BILINEAR, 1e-6},
+		{RESAMPLE_CUBIC, 1e-6},
+	} {
+		r := NewWarpedRaster(src, target, 0.0005, c.method)
+		if r == nil {
+			t.Fatal("failed to warp")
+		}
+		if !r.Srs().Eq(target) {
+			t.Error("unexpected srs")
+		}
+		gt := r.GeoTransform()
+		w, h := r.Size()
+		line := make([]float64, w)
+		checked := 0
+		for y := 0; y < h; y += 7 {
+			r.FetchLine(y, line)
+			for x := 0; x < w; x += 5 {
+				if isNoData(line[x], r.NoData()) {
+					continue
+				}
+				p := target.TransformTo(src.Srs(), []vec2d.T{{gt[0] + gt[1]*(float64(x)+0.5), gt[3] + gt[5]*(float64(y)+0.5)}})[0]
+				// 只检查离边缘至少一个像元的点，避免边缘外推
+				if p[0] < 12000000+100 || p[0] > 12000000+6300 || p[1] > 4000000-100 || p[1] < 4000000-6300 {
+					continue
+				}
+				expected := 0.001*(p[0]-12000000) + 0.002*(p[1]-4000000)
+				if math.Abs(line[x]-expected) > c.tol {
+					t.Fatalf("method %d pixel %d,%d: expected %f, got %f", c.method, x, y, expected, line[x])
+				}
+				if v := r.Elevation(x, y); v != line[x] {
+					t.Fatalf("method %d: elevation %f differs from line %f", c.method, v, line[x])
+				}
+				checked++
+			}
+		}
+		if checked == 0 {
+			t.Fatalf("method %d: no pixels checked", c.method)
+		}
+	}
+}
+
+// 测试无效值的传递
+func TestWarpedRasterNoData(t *testing.T) {
+	srs := geo.NewProj(3857)
+	nodata := -1.0
+	data := []float64{
+		1, 1, 1, 1,
+		1, -1, 1, 1,
+		1, 1, 1, 1,
+		1, 1, 1, 1,
+	}
+	src := NewMemoryRaster(data, 4, 4, [6]float64{0, 10, 0, 40, 0, -10}, srs, &nodata)
+
+	r := NewWarpedRasterWithGrid(src, srs, [6]float64{-10, 5, 0, 50, 0, -5}, 12, 12, RESAMPLE_CUBIC)
+	if r == nil {
+		t.Fatal("failed to warp")
+	}
+	if nd := r.NoData(); nd == nil || *nd != -1 {
+		t.Fatalf("unexpected nodata %v", nd)
+	}
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 12; x++ {
+			v := r.Elevation(x, y)
+			outside := x < 2 || y < 2 || x >= 10 || y >= 10
+			hole := x >= 4 && x < 6 && y >= 4 && y < 6
+			switch {
+			case outside || hole:
+				if v != -1 {
+					t.Errorf("pixel %d,%d: expected nodata, got %f", x, y, v)
+				}
+			case math.Abs(v-1) > 1e-9:
+				t.Errorf("pixel %d,%d: expected 1, got %f", x, y, v)
+			}
+		}
+	}
+	if rng := r.Range(); rng[0] != 1 || rng[1] != 1 {
+		t.Errorf("unexpected range %v", rng)
+	}
+}
+
+// 测试源栅格没有无效值时, 无覆盖的像元为 NaN, -9999 仍是有效值
+func TestWarpedRasterWithoutNoData(t *testing.T) {
+	srs := geo.NewProj(3857)
+	src := NewMemoryRaster([]float64{-9999, 1, 1, 1}, 2, 2, [6]float64{0, 10, 0, 20, 0, -10}, srs, nil)
+	for _, method := range []ResampleMethod{RESAMPLE_NEAREST, RESAMPLE_AVERAGE} {
+		r := NewWarpedRasterWithGrid(src, srs, [6]float64{-10, 10, 0, 30, 0, -10}, 4, 4, method)
+		if r == nil {
+			t.Fatal("failed to warp")
+		}
+		if r.NoData() != nil {
+			t.Fatalf("method %d: expected no nodata, got %v", method, *r.NoData())
+		}
+		line := make([]float64, 4)
+		for y := 0; y < 4; y++ {
+			if err := r.FetchLine(y, line); err != nil {
+				t.Fatal(err)
+			}
+			for x, v := range line {
+				switch {
+				case x == 0 || y == 0 || x == 3 || y == 3:
+					if !math.IsNaN(v) {
+						t.Errorf("method %d pixel %d,%d: expected NaN, got %f", method, x, y, v)
+					}
+				case x == 1 && y == 1:
+					if v != -9999 {
+						t.Errorf("method %d: expected -9999, got %f", method, v)
+					}
+				case v != 1:
+					t.Errorf("method %d pixel %d,%d: expected 1, got %f", method, x, y, v)
+				}
+			}
+		}
+	}
+}
+
+// 测试平均、最小、最大值在目标像元覆盖的源像元上聚合
+func TestWarpedRasterAggregate(t *testing.T) {
+	srs := geo.NewProj(3857)
+	src := newPlaneRaster(16, [6]float64{1000, 10, 0, 2000, 0, -10}, srs, nil)
+	for _, method := range []ResampleMethod{RESAMPLE_AVERAGE, RESAMPLE_MIN, RESAMPLE_MAX} {
+		r := NewWarpedRaster(src, srs, 20, method)
+		expected := NewResampledRaster(src, 2, method)
+		if r == nil || expected == nil {
+			t.Fatal("failed to warp")
+		}
+		line, want := make([]float64, 8), make([]float64, 8)
+		for y := 0; y < 8; y++ {
+			r.FetchLine(y, line)
+			expected.FetchLine(y, want)
+			for x := range line {
+				if math.Abs(line[x]-want[x]) > 1e-9 {
+					t.Fatalf("method %d pixel %d,%d: expected %f, got %f", method, x, y, want[x], line[x])
+				}
+				if v := r.Elevation(x, y); v != line[x] {
+					t.Fatalf("method %d: elevation %f differs from line %f", method, v, line[x])
+				}
+			}
+		}
+	}
+
+	// 投影变换后最近邻值落在最小值与最大值之间
+	src = newPlaneRaster(64, [6]float64{12000000, 100, 0, 4000000, 0, -100}, srs, nil)
+	target := geo.NewProj(4326)
+	rasters := map[ResampleMethod]*WarpedRaster{}
+	for _, method := range []ResampleMethod{RESAMPLE_NEAREST, RESAMPLE_AVERAGE, RESAMPLE_MIN, RESAMPLE_MAX} {
+		rasters[method] = NewWarpedRaster(src, target, 0.002, method)
+	}
+	w, h := rasters[RESAMPLE_MIN].Size()
+	lines := map[ResampleMethod][]float64{}
+	for method := range rasters {
+		lines[method] = make([]float64, w)
+	}
+	checked := 0
+	for y := 0; y < h; y++ {
+		for method, r := range rasters {
+			r.FetchLine(y, lines[method])
+		}
+		for x := 0; x < w; x++ {
+			nearest, avg := lines[RESAMPLE_NEAREST][x], lines[RESAMPLE_AVERAGE][x]
+			min, max := lines[RESAMPLE_MIN][x], lines[RESAMPLE_MAX][x]
+			if math.IsNaN(nearest) {
+				continue
+			}
+			if min > nearest || nearest > max || min > avg || avg > max || min == max {
+				t.Fatalf("pixel %d,%d: expected min %f <= nearest %f, average %f <= max %f", x, y, min, nearest, avg, max)
+			}
+			checked++
+		}
+	}
+	if checked == 0 {
+		t.Fatal("no pixels checked")
+	}
+}
+
+// 测试目标像元覆盖的源行数超过行缓存时, 每个源行在一条目标线内只读取一次
+func TestWarpedRasterAggregateTallFootprint(t *testing.T) {
+	srs := geo.NewProj(3857)
+	w, h := 8, 4*defaultWarpCacheLines
+	data := make([]float64, w*h)
+	for i := range data {
+		data[i] = float64(i / w)
+	}
+	src := &rangeRaster{MemoryRaster: NewMemoryRaster(data, w, h, [6]float64{0, 1, 0, float64(h), 0, -1}, srs, nil)}
+	r := NewWarpedRasterWithGrid(src, srs, [6]float64{0, 2, 0, float64(h), 0, -float64(h)}, w/2, 1, RESAMPLE_MAX)
+	line := make([]float64, w/2)
+	if err := r.FetchLine(0, line); err != nil {
+		t.Fatal(err)
+	}
+	if src.fetches != h {
+		t.Fatalf("expected %d source reads, got %d", h, src.fetches)
+	}
+	for x, v := range line {
+		if v != float64(h-1) {
+			t.Fatalf("pixel %d: expected max %d, got %v", x, h-1, v)
+		}
+	}
+}